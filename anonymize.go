@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+
+	"db-example/dbutils"
+)
+
+// anonymizeKeyEnv names the environment variable with the secret key of the
+// hash and fakename anonymizers.
+const anonymizeKeyEnv = "DB_ANONYMIZE_KEY"
+
+// anonymize rewrites personal data of a production copy according to the
+// rules in args[0], see dbutils.ParseAnonymizeRules. The key is read from
+// $DB_ANONYMIZE_KEY.
+func anonymize(ctx context.Context, dbh *sqlx.DB, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: anonymize table.column=hash|fakename|null,...")
+	}
+
+	rules, err := dbutils.ParseAnonymizeRules(args[0], []byte(os.Getenv(anonymizeKeyEnv)))
+	if err != nil {
+		return err
+	}
+	if err := dbutils.Anonymize(ctx, dbh, rules); err != nil {
+		return err
+	}
+
+	log.Printf("anonymized %d tables", len(rules))
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"db-example/dbutils"
+)
+
+// backup is the backup command, dumping the database into a file, "-" for
+// stdout, in the custom format of pg_dump:
+//
+//	backup [-- pg_dump args] file
+func backup(ctx context.Context, cfg dbutils.Config, args []string) error {
+	file, extra, err := toolArgs("backup", args)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if file != "-" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := dbutils.Backup(ctx, cfg, w, extra...); err != nil {
+		return err
+	}
+	if f, ok := w.(*os.File); ok && f != os.Stdout {
+		if err := f.Close(); err != nil {
+			return err
+		}
+		log.Printf("backed up into %s", file)
+	}
+	return nil
+}
+
+// restore is the restore command, restoring a dump made by backup from a
+// file, "-" for stdin:
+//
+//	restore [-- pg_restore args] file
+func restore(ctx context.Context, cfg dbutils.Config, args []string) error {
+	file, extra, err := toolArgs("restore", args)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	if err := dbutils.Restore(ctx, cfg, r, extra...); err != nil {
+		return err
+	}
+	log.Printf("restored from %s", file)
+	return nil
+}
+
+// toolArgs splits the arguments of backup and restore into the file, the
+// last one, and the arguments of the client program before it.
+func toolArgs(cmd string, args []string) (file string, extra []string, err error) {
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return "", nil, err
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("usage: %s [-- args] file", cmd)
+	}
+	return args[len(args)-1], args[:len(args)-1], nil
+}
@@ -0,0 +1,62 @@
+package dbutils
+
+import (
+	"context"
+	"time"
+)
+
+// Backend is a server process as seen in pg_stat_activity.
+type Backend struct {
+	PID             int32      `db:"pid" json:"pid"`
+	ApplicationName string     `db:"application_name" json:"applicationName"`
+	State           string     `db:"state" json:"state"`
+	Query           string     `db:"query" json:"query"`
+	WaitEventType   string     `db:"wait_event_type" json:"waitEventType,omitempty"`
+	WaitEvent       string     `db:"wait_event" json:"waitEvent,omitempty"`
+	XactStart       *time.Time `db:"xact_start" json:"xactStart,omitempty"`
+	QueryStart      *time.Time `db:"query_start" json:"queryStart,omitempty"`
+	StateChange     *time.Time `db:"state_change" json:"stateChange,omitempty"`
+	// Duration is how long the backend is in its state, e.g. how long the
+	// query runs or the transaction idles.
+	Duration time.Duration `db:"-" json:"duration"`
+}
+
+// ActivityFilter selects backends for Activity, zero fields match all.
+type ActivityFilter struct {
+	ApplicationName string
+	// State is e.g. "active" or "idle in transaction".
+	State string
+	// MinDuration skips backends in their state for a shorter time.
+	MinDuration time.Duration
+}
+
+// Activity returns the client backends of the database other than the one
+// running the query, longest in their state first. Seeing queries of other
+// users requires pg_read_all_stats.
+func Activity(ctx context.Context, db Queryer, filter ActivityFilter) ([]Backend, error) {
+	var rows []struct {
+		Backend
+		Seconds float64 `db:"seconds"`
+	}
+	q := `SELECT pid, application_name, coalesce(state, '') AS state, coalesce(query, '') AS query,
+			coalesce(wait_event_type, '') AS wait_event_type, coalesce(wait_event, '') AS wait_event,
+			xact_start, query_start, state_change,
+			coalesce(extract(epoch FROM now() - state_change), 0)::float8 AS seconds
+		FROM pg_stat_activity
+		WHERE datname = current_database() AND backend_type = 'client backend'
+			AND pid <> pg_backend_pid()
+			AND ($1 = '' OR application_name = $1)
+			AND ($2 = '' OR state = $2)
+			AND coalesce(now() - state_change, '0'::interval) >= make_interval(secs => $3)
+		ORDER BY state_change NULLS LAST`
+	if err := Select(ctx, db, &rows, q, filter.ApplicationName, filter.State, filter.MinDuration.Seconds()); err != nil {
+		return nil, err
+	}
+
+	ret := make([]Backend, len(rows))
+	for i, r := range rows {
+		ret[i] = r.Backend
+		ret[i].Duration = time.Duration(r.Seconds * float64(time.Second))
+	}
+	return ret, nil
+}
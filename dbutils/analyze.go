@@ -0,0 +1,37 @@
+package dbutils
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var analyzeMinRows int64
+
+// SetAnalyzeAfterLoad makes InsertMany, CopyFrom and LoadTempTable run
+// ANALYZE on the table after loading more than minRows rows, since plans
+// made with the statistics from before a big load can be terrible until
+// autovacuum catches up, and autovacuum never analyzes temporary tables.
+// 0, the default, turns it off.
+func SetAnalyzeAfterLoad(minRows int64) {
+	atomic.StoreInt64(&analyzeMinRows, minRows)
+}
+
+// analyzeAfterLoad analyzes table if n rows were loaded into it. A failure
+// is logged, the rows are loaded anyway.
+func analyzeAfterLoad(ctx context.Context, db Execer, table string, n int64) {
+	min := atomic.LoadInt64(&analyzeMinRows)
+	if min <= 0 || n <= min {
+		return
+	}
+
+	q := `ANALYZE ` + pgx.Identifier(strings.Split(table, ".")).Sanitize()
+	if _, err := Exec(ctx, db, q); err != nil {
+		log.Printf("analyze %s after loading %d rows: %v", table, n, err)
+		return
+	}
+	log.Printf("analyzed %s after loading %d rows", table, n)
+}
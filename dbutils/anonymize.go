@@ -0,0 +1,234 @@
+package dbutils
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Anonymizer replaces values of a column holding personal data. The SQL and
+// Go forms produce the same results for text values.
+type Anonymizer interface {
+	// Expr returns an SQL expression computing the replacement of column,
+	// which is already quoted. arg binds a value as a parameter of the
+	// statement and returns its placeholder, so secrets stay out of the
+	// query text.
+	Expr(column string, arg func(v interface{}) string) string
+	// Apply computes the replacement of v, for rows already fetched.
+	Apply(v interface{}) interface{}
+}
+
+// Hash returns an anonymizer replacing values with the hex HMAC-SHA256 of
+// their text with key. Equal values stay equal, so joins and uniqueness
+// keep working; without the key the values can't be recovered by hashing
+// guesses, as with a plain hash of emails or phone numbers.
+func Hash(key []byte) Anonymizer {
+	return hashAnonymizer{key: key}
+}
+
+// FakeName returns an anonymizer replacing values with a name picked by
+// their HMAC-SHA256 with key.
+func FakeName(key []byte) Anonymizer {
+	return fakeNameAnonymizer{key: key}
+}
+
+// Nullify replaces values with NULL.
+var Nullify Anonymizer = nullAnonymizer{}
+
+// anonymizers are the names of the anonymizers in ParseAnonymizeRules.
+var anonymizers = map[string]func(key []byte) Anonymizer{
+	"hash":     Hash,
+	"fakename": FakeName,
+	"null":     func([]byte) Anonymizer { return Nullify },
+}
+
+func valueText(v interface{}) []byte {
+	if b, ok := v.([]byte); ok {
+		return b
+	}
+	return []byte(fmt.Sprint(v))
+}
+
+// textHMAC is the HMAC-SHA256 of the text of v with key.
+func textHMAC(key []byte, v interface{}) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(valueText(v))
+	return mac.Sum(nil)
+}
+
+// sqlTextHMAC is textHMAC in SQL, built from the sha256 function as
+// PostgreSQL has no HMAC without pgcrypto. The padded keys are parameters.
+func sqlTextHMAC(key []byte, column string, arg func(interface{}) string) string {
+	if len(key) > sha256.BlockSize {
+		sum := sha256.Sum256(key)
+		key = sum[:]
+	}
+	ipad := make([]byte, sha256.BlockSize)
+	opad := make([]byte, sha256.BlockSize)
+	copy(ipad, key)
+	copy(opad, key)
+	for i := range ipad {
+		ipad[i] ^= 0x36
+		opad[i] ^= 0x5c
+	}
+	return fmt.Sprintf("sha256(%s::bytea || sha256(%s::bytea || convert_to(%s::text, 'UTF8')))",
+		arg(opad), arg(ipad), column)
+}
+
+type hashAnonymizer struct {
+	key []byte
+}
+
+func (a hashAnonymizer) Expr(column string, arg func(interface{}) string) string {
+	return fmt.Sprintf("encode(%s, 'hex')", sqlTextHMAC(a.key, column, arg))
+}
+
+func (a hashAnonymizer) Apply(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return hex.EncodeToString(textHMAC(a.key, v))
+}
+
+var fakeNames = []string{
+	"Alice Smith", "Bob Johnson", "Carol Williams", "Dave Brown",
+	"Eve Jones", "Frank Miller", "Grace Davis", "Heidi Wilson",
+	"Ivan Moore", "Judy Taylor", "Mallory Anderson", "Oscar Thomas",
+	"Peggy Jackson", "Rupert White", "Sybil Harris", "Trent Martin",
+}
+
+type fakeNameAnonymizer struct {
+	key []byte
+}
+
+func (a fakeNameAnonymizer) Expr(column string, arg func(interface{}) string) string {
+	names := make([]string, len(fakeNames))
+	for i, n := range fakeNames {
+		names[i] = "'" + n + "'"
+	}
+	return fmt.Sprintf("(ARRAY[%s])[1 + get_byte(%s, 0) %% %d]",
+		strings.Join(names, ", "), sqlTextHMAC(a.key, column, arg), len(fakeNames))
+}
+
+func (a fakeNameAnonymizer) Apply(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return fakeNames[int(textHMAC(a.key, v)[0])%len(fakeNames)]
+}
+
+type nullAnonymizer struct{}
+
+func (nullAnonymizer) Expr(string, func(interface{}) string) string { return "NULL" }
+func (nullAnonymizer) Apply(interface{}) interface{}                { return nil }
+
+// AnonymizeRules maps table names to the anonymizers of their columns.
+type AnonymizeRules map[string]map[string]Anonymizer
+
+// ParseAnonymizeRules parses rules written as comma separated
+// "table.column=anonymizer" items, where anonymizer is hash, fakename or
+// null: "users.name=fakename,users.email=hash,users.phone=null". Tables may
+// be schema qualified. key is the secret of hash and fakename, see Hash; it
+// must not be empty unless only null is used.
+func ParseAnonymizeRules(spec string, key []byte) (AnonymizeRules, error) {
+	rules := AnonymizeRules{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		target, name, ok := strings.Cut(item, "=")
+		dot := strings.LastIndex(target, ".")
+		if !ok || dot <= 0 || dot == len(target)-1 {
+			return nil, fmt.Errorf("anonymize rule %q: want table.column=anonymizer", item)
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		newAnonymizer, ok := anonymizers[name]
+		if !ok {
+			return nil, fmt.Errorf("anonymize rule %q: unknown anonymizer %q", item, name)
+		}
+		if name != "null" && len(key) == 0 {
+			return nil, fmt.Errorf("anonymize rule %q: %s needs a key", item, name)
+		}
+		a := newAnonymizer(key)
+
+		table, column := strings.TrimSpace(target[:dot]), strings.TrimSpace(target[dot+1:])
+		if rules[table] == nil {
+			rules[table] = map[string]Anonymizer{}
+		}
+		rules[table][column] = a
+	}
+	return rules, nil
+}
+
+// Anonymize rewrites the columns covered by rules in place, one UPDATE per
+// table, all in one transaction. It's meant for copies of production
+// databases, never run it against production.
+func Anonymize(ctx context.Context, db TxStarter, rules AnonymizeRules) error {
+	tables := make([]string, 0, len(rules))
+	for t := range rules {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+
+	return RunTx(ctx, db, func(tx *sqlx.Tx) error {
+		for _, t := range tables {
+			query, args, err := anonymizeQuery(t, rules[t])
+			if err != nil {
+				return err
+			}
+			if query == "" {
+				continue
+			}
+			if _, err := Exec(ctx, tx, query, args...); err != nil {
+				return fmt.Errorf("anonymize %s: %w", t, err)
+			}
+		}
+		return nil
+	})
+}
+
+func anonymizeQuery(table string, columns map[string]Anonymizer) (string, []interface{}, error) {
+	qt, err := QuoteIdent(table)
+	if err != nil {
+		return "", nil, err
+	}
+
+	names := make([]string, 0, len(columns))
+	for c := range columns {
+		names = append(names, c)
+	}
+	sort.Strings(names)
+
+	var args argList
+	set := make([]string, 0, len(names))
+	for _, c := range names {
+		qc, err := QuoteIdent(c)
+		if err != nil {
+			return "", nil, err
+		}
+		set = append(set, qc+" = "+columns[c].Expr(qc, args.add))
+	}
+	if len(set) == 0 {
+		return "", nil, nil
+	}
+
+	return "UPDATE " + qt + " SET " + strings.Join(set, ", "), args.args, nil
+}
+
+// AnonymizeMap applies the rules of table to a row fetched with SelectMaps
+// or GetMap in place, for anonymizing export streams.
+func AnonymizeMap(rules AnonymizeRules, table string, m map[string]interface{}) {
+	for c, a := range rules[table] {
+		if v, ok := m[c]; ok {
+			m[c] = a.Apply(v)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package dbutils
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// arrayMaps decode arrays, a Map isn't safe for concurrent use.
+var arrayMaps = sync.Pool{New: func() interface{} { return pgtype.NewMap() }}
+
+// arrayScanner scans an array, which database/sql returns in its text
+// form like "{1,2}", into a slice like []int64 or []string, e.g. the result
+// of array_agg. Arrays with NULL elements need slices of pointers like
+// []*string.
+type arrayScanner struct {
+	dest interface{}
+}
+
+func (s arrayScanner) Scan(src interface{}) error {
+	m := arrayMaps.Get().(*pgtype.Map)
+	defer arrayMaps.Put(m)
+	return m.SQLScanner(s.dest).Scan(src)
+}
+
+// isArrayField tells if a field of type t is scanned with arrayScanner.
+func isArrayField(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 &&
+		!reflect.PtrTo(t).Implements(scannerType)
+}
+
+// arrayColumns returns the array types of the array columns of a result
+// by column name.
+func arrayColumns(cts []*sql.ColumnType) map[string]string {
+	var ret map[string]string
+	for _, ct := range cts {
+		if name := ct.DatabaseTypeName(); strings.HasPrefix(name, "_") {
+			if ret == nil {
+				ret = map[string]string{}
+			}
+			ret[ct.Name()] = strings.ToLower(name)
+		}
+	}
+	return ret
+}
+
+// decodeArrays replaces the text form of the array columns in a map result
+// with []interface{} of the elements.
+func decodeArrays(m map[string]interface{}, arrays map[string]string) error {
+	if len(arrays) == 0 {
+		return nil
+	}
+
+	tm := arrayMaps.Get().(*pgtype.Map)
+	defer arrayMaps.Put(tm)
+
+	for col, typ := range arrays {
+		var src []byte
+		switch v := m[col].(type) {
+		case string:
+			src = []byte(v)
+		case []byte:
+			src = v
+		default:
+			continue
+		}
+		t, ok := tm.TypeForName(typ)
+		if !ok {
+			continue
+		}
+		v, err := t.Codec.DecodeValue(tm, t.OID, pgtype.TextFormatCode, src)
+		if err != nil {
+			return fmt.Errorf("decode column %q: %w", col, err)
+		}
+		m[col] = v
+	}
+	return nil
+}
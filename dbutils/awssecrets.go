@@ -0,0 +1,51 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// AWSSecretSource reads secrets from AWS Secrets Manager. Paths are secret
+// names or ARNs; keys are fields of secrets stored as JSON, as RDS stores
+// its credentials.
+type AWSSecretSource struct {
+	Client *secretsmanager.Client
+}
+
+// NewAWSSecretSource returns a source configured as the AWS SDK does by
+// default: credentials come from the environment, the shared config and
+// credentials files, SSO, or the role of the instance or task. A non-empty
+// region overrides the configured one.
+func NewAWSSecretSource(ctx context.Context, region string) (*AWSSecretSource, error) {
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("aws: load config: %w", err)
+	}
+	return &AWSSecretSource{Client: secretsmanager.NewFromConfig(cfg)}, nil
+}
+
+// Secret implements SecretSource.
+func (a *AWSSecretSource) Secret(ctx context.Context, path, key string) (string, error) {
+	out, err := a.Client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(path),
+	})
+	if err != nil {
+		return "", fmt.Errorf("aws: %w", err)
+	}
+	if out.SecretString == nil {
+		return "", fmt.Errorf("aws: secret %s has no string value", path)
+	}
+	s, err := secretField(*out.SecretString, key)
+	if err != nil {
+		return "", fmt.Errorf("aws: %w", err)
+	}
+	return s, nil
+}
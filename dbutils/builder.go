@@ -0,0 +1,498 @@
+package dbutils
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QuoteIdent quotes a possibly schema-qualified identifier ("schema.table").
+func QuoteIdent(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("empty identifier")
+	}
+
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		if p == "" || strings.IndexByte(p, 0) >= 0 {
+			return "", fmt.Errorf("invalid identifier %q", name)
+		}
+		parts[i] = `"` + strings.ReplaceAll(p, `"`, `""`) + `"`
+	}
+
+	return strings.Join(parts, "."), nil
+}
+
+// argList collects positional arguments while a statement is being built.
+type argList struct {
+	args []interface{}
+}
+
+func (a *argList) add(v interface{}) string {
+	a.args = append(a.args, v)
+	return "$" + strconv.Itoa(len(a.args))
+}
+
+// Cond is a WHERE condition understood by the builders.
+type Cond interface {
+	appendSQL(buf *strings.Builder, args *argList) error
+}
+
+type opCond struct {
+	column string
+	op     string
+	value  interface{}
+	cast   string
+}
+
+func (c opCond) appendSQL(buf *strings.Builder, args *argList) error {
+	col, err := QuoteIdent(c.column)
+	if err != nil {
+		return err
+	}
+
+	buf.WriteString(col)
+	buf.WriteString(" ")
+	buf.WriteString(c.op)
+	buf.WriteString(" ")
+	if c.cast != "" && !isTypeName(c.cast) {
+		return fmt.Errorf("invalid type name %q", c.cast)
+	}
+	buf.WriteString(args.add(c.value))
+	if c.cast != "" {
+		buf.WriteString("::")
+		buf.WriteString(c.cast)
+	}
+
+	return nil
+}
+
+// isTypeName reports whether s is a plain, possibly schema-qualified type
+// name, such as "int8" or "public.mytype".
+func isTypeName(s string) bool {
+	for i, r := range s {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && (r == '.' || r >= '0' && r <= '9'):
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Eq matches rows where column equals value.
+func Eq(column string, value interface{}) Cond {
+	return opCond{column: column, op: "=", value: value}
+}
+
+type andCond []Cond
+
+func (c andCond) appendSQL(buf *strings.Builder, args *argList) error {
+	if len(c) == 0 {
+		buf.WriteString("TRUE")
+		return nil
+	}
+	for i, cond := range c {
+		if i > 0 {
+			buf.WriteString(" AND ")
+		}
+		if err := cond.appendSQL(buf, args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Filter turns a column->value map into equality conditions joined by AND.
+// Columns are emitted in sorted order so the generated SQL is stable.
+func Filter(m map[string]interface{}) Cond {
+	cols := make([]string, 0, len(m))
+	for col := range m {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+
+	conds := make(andCond, 0, len(cols))
+	for _, col := range cols {
+		conds = append(conds, Eq(col, m[col]))
+	}
+
+	return conds
+}
+
+// RangeContains matches rows where the range column contains value, which
+// is either one of the range types or a single element of int4range,
+// numrange or tstzrange: an integer, a float or a time.Time. Elements of
+// other range types need RangeContainsElem.
+func RangeContains(column string, value interface{}) Cond {
+	return opCond{column: column, op: "@>", value: value, cast: rangeArgCast(value)}
+}
+
+// RangeContainsElem matches rows where the range column contains value,
+// an element of type elemType, e.g. "int8" for an int8range or "date" for a
+// daterange column. elemType is a plain type name such as "timestamptz".
+func RangeContainsElem(column string, value interface{}, elemType string) Cond {
+	return opCond{column: column, op: "@>", value: value, cast: elemType}
+}
+
+// RangeContainedBy matches rows where the range column is contained by r.
+func RangeContainedBy(column string, r interface{}) Cond {
+	return opCond{column: column, op: "<@", value: r, cast: rangeArgCast(r)}
+}
+
+// RangeOverlaps matches rows where the range column overlaps r.
+func RangeOverlaps(column string, r interface{}) Cond {
+	return opCond{column: column, op: "&&", value: r, cast: rangeArgCast(r)}
+}
+
+// rangeArgCast picks an explicit cast for a range operator argument, without
+// it the server resolves "range @> $1" to the range-range operator. Elements
+// are cast to the element types of the range types of this package, the
+// operators don't accept others.
+func rangeArgCast(v interface{}) string {
+	switch v := v.(type) {
+	case rangeValue:
+		return v.pgRangeType()
+	case int, int64, int32, int16, int8, uint32, uint16, uint8:
+		return "int4"
+	case float32, float64:
+		return "numeric"
+	case time.Time:
+		return "timestamptz"
+	}
+	return ""
+}
+
+// SelectBuilder composes a SELECT statement with PostgreSQL placeholders.
+type SelectBuilder struct {
+	table   string
+	columns []string
+	where   []Cond
+	orderBy []orderItem
+	limit   int
+	offset  int
+	with    []cte
+	lock    string
+	wait    LockWait
+}
+
+// Subquery is a statement embedded into a built one.
+type Subquery interface {
+	appendQuery(buf *strings.Builder, args *argList) error
+}
+
+type cte struct {
+	name      string
+	columns   []string
+	query     Subquery
+	recursive bool
+}
+
+// RawSQL is a hand-written SQL fragment usable as a Cond or a Subquery.
+type RawSQL struct {
+	sql  string
+	args []interface{}
+}
+
+// Raw makes a fragment of sql with "?" placeholders for args, renumbered
+// when the fragment is embedded. "??" stands for a literal question mark.
+func Raw(sql string, args ...interface{}) RawSQL {
+	return RawSQL{sql: sql, args: args}
+}
+
+func (r RawSQL) appendSQL(buf *strings.Builder, args *argList) error {
+	n := 0
+	for i := 0; i < len(r.sql); i++ {
+		c := r.sql[i]
+		if c != '?' {
+			buf.WriteByte(c)
+			continue
+		}
+		if i+1 < len(r.sql) && r.sql[i+1] == '?' {
+			buf.WriteByte('?')
+			i++
+			continue
+		}
+		if n >= len(r.args) {
+			return fmt.Errorf("raw SQL %q has more placeholders than %d args", r.sql, len(r.args))
+		}
+		buf.WriteString(args.add(r.args[n]))
+		n++
+	}
+	if n != len(r.args) {
+		return fmt.Errorf("raw SQL %q has %d placeholders for %d args", r.sql, n, len(r.args))
+	}
+	return nil
+}
+
+func (r RawSQL) appendQuery(buf *strings.Builder, args *argList) error {
+	return r.appendSQL(buf, args)
+}
+
+type unionAll []Subquery
+
+// UnionAll combines queries with UNION ALL, e.g. the anchor and the
+// recursive part of a recursive CTE.
+func UnionAll(queries ...Subquery) Subquery {
+	return unionAll(queries)
+}
+
+func (u unionAll) appendQuery(buf *strings.Builder, args *argList) error {
+	for i, q := range u {
+		if i > 0 {
+			buf.WriteString(" UNION ALL ")
+		}
+		if err := q.appendQuery(buf, args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type orderItem struct {
+	column string
+	desc   bool
+}
+
+// NewSelect starts a SELECT of columns (all columns if none) from table.
+func NewSelect(table string, columns ...string) *SelectBuilder {
+	return &SelectBuilder{table: table, columns: columns}
+}
+
+// With adds a common table expression the query can select from.
+func (b *SelectBuilder) With(name string, q Subquery) *SelectBuilder {
+	b.with = append(b.with, cte{name: name, query: q})
+	return b
+}
+
+// WithRecursive adds a recursive common table expression, q is usually a
+// UnionAll of the anchor query and a Raw query referencing name.
+func (b *SelectBuilder) WithRecursive(name string, columns []string, q Subquery) *SelectBuilder {
+	b.with = append(b.with, cte{name: name, columns: columns, query: q, recursive: true})
+	return b
+}
+
+func (b *SelectBuilder) Where(conds ...Cond) *SelectBuilder {
+	b.where = append(b.where, conds...)
+	return b
+}
+
+func (b *SelectBuilder) OrderBy(column string) *SelectBuilder {
+	b.orderBy = append(b.orderBy, orderItem{column: column})
+	return b
+}
+
+func (b *SelectBuilder) OrderByDesc(column string) *SelectBuilder {
+	b.orderBy = append(b.orderBy, orderItem{column: column, desc: true})
+	return b
+}
+
+func (b *SelectBuilder) Limit(n int) *SelectBuilder {
+	b.limit = n
+	return b
+}
+
+func (b *SelectBuilder) Offset(n int) *SelectBuilder {
+	b.offset = n
+	return b
+}
+
+// ForUpdate locks the selected rows against updates and deletes until the
+// end of the transaction.
+func (b *SelectBuilder) ForUpdate() *SelectBuilder {
+	b.lock = "UPDATE"
+	return b
+}
+
+// ForNoKeyUpdate locks the selected rows like ForUpdate, but lets other
+// transactions insert rows referencing them.
+func (b *SelectBuilder) ForNoKeyUpdate() *SelectBuilder {
+	b.lock = "NO KEY UPDATE"
+	return b
+}
+
+// ForShare locks the selected rows against updates and deletes, other
+// transactions may lock them for share too.
+func (b *SelectBuilder) ForShare() *SelectBuilder {
+	b.lock = "SHARE"
+	return b
+}
+
+// LockWait is what a locking SELECT does with rows locked by others.
+type LockWait int
+
+const (
+	// LockBlock waits for the other transactions.
+	LockBlock LockWait = iota
+	// LockNoWait fails with lock_not_available (55P03).
+	LockNoWait
+	// LockSkipLocked skips the rows, e.g. to take jobs off a queue.
+	LockSkipLocked
+)
+
+// NoWait makes the lock fail instead of waiting for other transactions.
+func (b *SelectBuilder) NoWait() *SelectBuilder {
+	b.wait = LockNoWait
+	return b
+}
+
+// SkipLocked skips rows locked by other transactions.
+func (b *SelectBuilder) SkipLocked() *SelectBuilder {
+	b.wait = LockSkipLocked
+	return b
+}
+
+// BuildCount builds a query counting the rows the SELECT would return
+// without ordering and limits.
+func (b *SelectBuilder) BuildCount() (query string, args []interface{}, err error) {
+	var buf strings.Builder
+	var al argList
+
+	if err := b.appendWith(&buf, &al); err != nil {
+		return "", nil, fmt.Errorf("build select: %w", err)
+	}
+	buf.WriteString("SELECT count(*)")
+	if err := b.appendFromWhere(&buf, &al); err != nil {
+		return "", nil, fmt.Errorf("build select: %w", err)
+	}
+
+	return buf.String(), al.args, nil
+}
+
+func (b *SelectBuilder) appendFromWhere(buf *strings.Builder, al *argList) error {
+	table, err := QuoteIdent(b.table)
+	if err != nil {
+		return err
+	}
+	buf.WriteString(" FROM ")
+	buf.WriteString(table)
+
+	if len(b.where) > 0 {
+		buf.WriteString(" WHERE ")
+		if err := andCond(b.where).appendSQL(buf, al); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *SelectBuilder) Build() (query string, args []interface{}, err error) {
+	var buf strings.Builder
+	var al argList
+
+	if err := b.appendQuery(&buf, &al); err != nil {
+		return "", nil, fmt.Errorf("build select: %w", err)
+	}
+
+	return buf.String(), al.args, nil
+}
+
+func (b *SelectBuilder) appendWith(buf *strings.Builder, al *argList) error {
+	for i, c := range b.with {
+		if i == 0 {
+			buf.WriteString("WITH ")
+			for _, c := range b.with {
+				if c.recursive {
+					buf.WriteString("RECURSIVE ")
+					break
+				}
+			}
+		} else {
+			buf.WriteString(", ")
+		}
+
+		name, err := QuoteIdent(c.name)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(name)
+		if len(c.columns) > 0 {
+			cols := make([]string, len(c.columns))
+			for j, col := range c.columns {
+				if cols[j], err = QuoteIdent(col); err != nil {
+					return err
+				}
+			}
+			buf.WriteString("(" + strings.Join(cols, ", ") + ")")
+		}
+		buf.WriteString(" AS (")
+		if err := c.query.appendQuery(buf, al); err != nil {
+			return err
+		}
+		buf.WriteString(")")
+	}
+	if len(b.with) > 0 {
+		buf.WriteString(" ")
+	}
+	return nil
+}
+
+func (b *SelectBuilder) appendQuery(buf *strings.Builder, al *argList) error {
+	if err := b.appendWith(buf, al); err != nil {
+		return err
+	}
+
+	buf.WriteString("SELECT ")
+	if len(b.columns) == 0 {
+		buf.WriteString("*")
+	}
+	for i, c := range b.columns {
+		col, err := QuoteIdent(c)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(col)
+	}
+
+	if err := b.appendFromWhere(buf, al); err != nil {
+		return err
+	}
+
+	for i, o := range b.orderBy {
+		if i == 0 {
+			buf.WriteString(" ORDER BY ")
+		} else {
+			buf.WriteString(", ")
+		}
+		col, err := QuoteIdent(o.column)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(col)
+		if o.desc {
+			buf.WriteString(" DESC")
+		}
+	}
+
+	if b.limit > 0 {
+		buf.WriteString(" LIMIT ")
+		buf.WriteString(strconv.Itoa(b.limit))
+	}
+	if b.offset > 0 {
+		buf.WriteString(" OFFSET ")
+		buf.WriteString(strconv.Itoa(b.offset))
+	}
+
+	if b.lock == "" && b.wait != LockBlock {
+		return errors.New("NOWAIT or SKIP LOCKED without a locking clause")
+	}
+	if b.lock != "" {
+		buf.WriteString(" FOR ")
+		buf.WriteString(b.lock)
+	}
+	switch b.wait {
+	case LockNoWait:
+		buf.WriteString(" NOWAIT")
+	case LockSkipLocked:
+		buf.WriteString(" SKIP LOCKED")
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// idMapper finds struct fields by column name the way sqlx does by default.
+var idMapper = reflectx.NewMapperFunc("db", strings.ToLower)
+
+// GetManyByIDs fetches the rows of table with the "id" column in ids in one
+// query. Items are in the order of ids; IDs without a row are in missing.
+// T must be a struct with a field mapped to the id column.
+func GetManyByIDs[T any, K comparable](ctx context.Context, db Queryer, table string, ids []K) (items []T, missing map[K]struct{}, err error) {
+	byID, err := getByIDs[T](ctx, db, table, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	items = make([]T, 0, len(ids))
+	missing = map[K]struct{}{}
+	for _, id := range ids {
+		item, ok := byID[id]
+		if !ok {
+			missing[id] = struct{}{}
+			continue
+		}
+		items = append(items, item)
+	}
+
+	return items, missing, nil
+}
+
+// getByIDs fetches the rows of table with the ids keyed by their ID.
+func getByIDs[T any, K comparable](ctx context.Context, db Queryer, table string, ids []K) (map[K]T, error) {
+	qt, err := QuoteIdent(table)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []T
+	query := `SELECT * FROM ` + qt + ` WHERE id = ANY($1)`
+	if err := Select(ctx, db, &rows, query, ids); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[K]T, len(rows))
+	keyType := reflect.TypeOf((*K)(nil)).Elem()
+	for i := range rows {
+		f := idMapper.FieldByName(reflect.ValueOf(&rows[i]).Elem(), "id")
+		f = reflect.Indirect(f)
+		if !f.IsValid() {
+			return nil, fmt.Errorf("%T has no field for the id column", rows[i])
+		}
+		if !f.Type().ConvertibleTo(keyType) {
+			return nil, fmt.Errorf("id of %T is %s, not %s", rows[i], f.Type(), keyType)
+		}
+		byID[f.Convert(keyType).Interface().(K)] = rows[i]
+	}
+
+	return byID, nil
+}
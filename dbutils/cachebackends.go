@@ -0,0 +1,91 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisCache is a CacheBackend storing the results in Redis.
+type RedisCache struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisCache returns a cache in Redis accessed with client, prefixing the
+// keys with prefix. Addresses, AUTH, TLS and the connection pool are
+// configured on the client, e.g.
+//
+//	dbutils.NewRedisCache(redis.NewClient(&redis.Options{Addr: "cache:6379", Password: pw}), "app:")
+func NewRedisCache(client redis.UniversalClient, prefix string) *RedisCache {
+	return &RedisCache{client: client, prefix: prefix}
+}
+
+// Get implements CacheBackend.
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("redis: %w", err)
+	}
+	return value, true, nil
+}
+
+// Set implements CacheBackend.
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl < time.Millisecond {
+		// 0 would mean no expiration.
+		ttl = time.Millisecond
+	}
+	if err := c.client.Set(ctx, c.prefix+key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("redis: %w", err)
+	}
+	return nil
+}
+
+// MemcacheCache is a CacheBackend storing the results in memcached.
+type MemcacheCache struct {
+	client *memcache.Client
+	prefix string
+}
+
+// NewMemcacheCache returns a cache in memcached accessed with client,
+// prefixing the keys with prefix. The servers, the timeout of operations
+// and the idle connections kept are configured on the client. Results over
+// the item size limit of the server, 1MB by default, aren't cached.
+func NewMemcacheCache(client *memcache.Client, prefix string) *MemcacheCache {
+	return &MemcacheCache{client: client, prefix: prefix}
+}
+
+// Get implements CacheBackend. The client has no context support, its own
+// timeout applies.
+func (c *MemcacheCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	it, err := c.client.Get(c.prefix + key)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("memcache: %w", err)
+	}
+	return it.Value, true, nil
+}
+
+// Set implements CacheBackend.
+func (c *MemcacheCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	// Expiration times over 30 days are taken as Unix times.
+	exp := int64((ttl + time.Second - 1) / time.Second)
+	if exp > 30*24*3600 {
+		exp = time.Now().Add(ttl).Unix()
+	}
+	err := c.client.Set(&memcache.Item{Key: c.prefix + key, Value: value, Expiration: int32(exp)})
+	if err != nil {
+		return fmt.Errorf("memcache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type opNameKey struct{}
+
+// WithOpName names the logical operation performed with ctx, e.g.
+// "billing.charge". The name is reported instead of the caller position.
+func WithOpName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, opNameKey{}, name)
+}
+
+// OpName returns the operation name set by WithOpName.
+func OpName(ctx context.Context) string {
+	name, _ := ctx.Value(opNameKey{}).(string)
+	return name
+}
+
+type traceParentKey struct{}
+
+// WithTraceParent attaches the W3C trace context of the request handled
+// with ctx, "00-<trace ID>-<span ID>-<flags>" as in the traceparent header.
+// AnnotateSQL adds it to the statements, so the server logs can be matched
+// with the traces. Malformed values are ignored.
+func WithTraceParent(ctx context.Context, traceparent string) context.Context {
+	if _, _, _, ok := ParseTraceParent(traceparent); !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, traceParentKey{}, traceparent)
+}
+
+// TraceParent returns the trace context set by WithTraceParent.
+func TraceParent(ctx context.Context) string {
+	tp, _ := ctx.Value(traceParentKey{}).(string)
+	return tp
+}
+
+// ParseTraceParent splits a version 00 W3C traceparent into its fields,
+// lowercase hex with non-zero IDs.
+func ParseTraceParent(tp string) (traceID, spanID, flags string, ok bool) {
+	parts := strings.Split(tp, "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return "", "", "", false
+	}
+	for i, n := range []int{2, 32, 16, 2} {
+		p := parts[i]
+		if len(p) != n || strings.Trim(p, "0123456789abcdef") != "" {
+			return "", "", "", false
+		}
+		if (i == 1 || i == 2) && strings.Trim(p, "0") == "" {
+			return "", "", "", false
+		}
+	}
+	return parts[1], parts[2], parts[3], true
+}
+
+var txAppName int32
+
+// SetTxApplicationName makes RunTx set application_name to the operation
+// name of its context for the duration of the transaction, so it's visible
+// in pg_stat_activity.
+func SetTxApplicationName(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&txAppName, v)
+}
+
+func setTxOpName(ctx context.Context, tx *sqlx.Tx) error {
+	name := OpName(ctx)
+	if name == "" || atomic.LoadInt32(&txAppName) == 0 {
+		return nil
+	}
+
+	q := `SELECT set_config('application_name', $1, true)`
+	if _, err := tx.ExecContext(ctx, q, name); err != nil {
+		return sqlErr(err, q, name)
+	}
+	return nil
+}
+
+type queryKey struct{}
+
+// QueryFromContext returns the statement being executed. It's available to
+// driver-level loggers and tracers called with the context of a helper.
+func QueryFromContext(ctx context.Context) (*Query, bool) {
+	q, ok := ctx.Value(queryKey{}).(*Query)
+	return q, ok
+}
+
+var pkgPath = reflect.TypeOf(Query{}).PkgPath()
+
+// callerOutside returns file:line of the first frame outside of dbutils
+// and its subpackages.
+func callerOutside() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, pkgPath+".") && !strings.HasPrefix(f.Function, pkgPath+"/") {
+			return fmt.Sprintf("%s:%d", filepath.Base(f.File), f.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// Annotation returns "op=<name>" or "caller=<file:line>" for q.
+func (q *Query) Annotation() string {
+	if q.OpName != "" {
+		return "op=" + q.OpName
+	}
+	return "caller=" + q.Caller
+}
+
+// AnnotateSQL is a middleware prefixing statements with a comment naming
+// the operation or the calling code, and the trace context if any, visible
+// in pg_stat_activity and in the server logs.
+func AnnotateSQL(next QueryFunc) QueryFunc {
+	return func(ctx context.Context, q *Query) error {
+		comment := strings.ReplaceAll(q.Annotation(), "*/", "* /")
+		if q.TraceParent != "" {
+			comment += " traceparent=" + q.TraceParent
+		}
+		q.SQL = "/* " + comment + " */ " + q.SQL
+		return next(ctx, q)
+	}
+}
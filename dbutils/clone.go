@@ -0,0 +1,107 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/multierr"
+)
+
+// cloneWait is how long CloneDatabase waits for the terminated sessions of
+// the source to go away.
+const cloneWait = 5 * time.Second
+
+// CloneDatabase creates the database target as a copy of source with
+// CREATE DATABASE ... TEMPLATE, e.g. to give each parallel test its own
+// database or to refresh a staging one. The copy requires source to have no
+// sessions, so new connections to it are refused while its sessions are
+// terminated and the copy is made. adminDB must be connected to another
+// database, such as postgres, as a role allowed to create databases and
+// terminate the sessions.
+func CloneDatabase(ctx context.Context, adminDB sqlx.ExtContext, source, target string) (err error) {
+	src, err := databaseIdent(source)
+	if err != nil {
+		return err
+	}
+	dst, err := databaseIdent(target)
+	if err != nil {
+		return err
+	}
+
+	var allowConn bool
+	if err := Get(ctx, adminDB, &allowConn, `SELECT datallowconn FROM pg_database WHERE datname = $1`, source); err != nil {
+		return fmt.Errorf("clone database %s: %w", source, err)
+	}
+	if allowConn {
+		if _, err := Exec(ctx, adminDB, `ALTER DATABASE `+src+` ALLOW_CONNECTIONS false`); err != nil {
+			return fmt.Errorf("clone database %s: %w", source, err)
+		}
+		defer func() {
+			// Not the context of the caller, which may be done.
+			_, e := Exec(context.Background(), adminDB, `ALTER DATABASE `+src+` ALLOW_CONNECTIONS true`)
+			err = multierr.Combine(err, e)
+		}()
+	}
+
+	deadline := time.Now().Add(cloneWait)
+	for {
+		if err := terminateSessions(ctx, adminDB, source); err != nil {
+			return fmt.Errorf("clone database %s: %w", source, err)
+		}
+		_, err = Exec(ctx, adminDB, `CREATE DATABASE `+dst+` TEMPLATE `+src)
+		// object_in_use: the terminated sessions haven't exited yet.
+		if sqlState(err) != "55006" || time.Now().After(deadline) {
+			break
+		}
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			return fmt.Errorf("clone database %s: %w", source, ctx.Err())
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("clone database %s into %s: %w", source, target, err)
+	}
+	return nil
+}
+
+// DropDatabase drops the database name, if it exists, terminating its
+// sessions, e.g. before cloning a fresh copy into it.
+func DropDatabase(ctx context.Context, adminDB sqlx.ExtContext, name string) error {
+	db, err := databaseIdent(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := Exec(ctx, adminDB, `ALTER DATABASE `+db+` ALLOW_CONNECTIONS false`); err != nil && sqlState(err) != "3D000" {
+		return fmt.Errorf("drop database %s: %w", name, err)
+	}
+	if err := terminateSessions(ctx, adminDB, name); err != nil {
+		return fmt.Errorf("drop database %s: %w", name, err)
+	}
+	if _, err := Exec(ctx, adminDB, `DROP DATABASE IF EXISTS `+db); err != nil {
+		return fmt.Errorf("drop database %s: %w", name, err)
+	}
+	return nil
+}
+
+func terminateSessions(ctx context.Context, db Queryer, database string) error {
+	var n int
+	q := `SELECT count(pg_terminate_backend(pid)) FROM pg_stat_activity
+		WHERE datname = $1 AND pid <> pg_backend_pid()`
+	return Get(ctx, db, &n, q, database)
+}
+
+func databaseIdent(name string) (string, error) {
+	if strings.Contains(name, ".") {
+		return "", fmt.Errorf("invalid database name %q", name)
+	}
+	qn, err := QuoteIdent(name)
+	if err != nil {
+		return "", fmt.Errorf("database %q: %w", name, err)
+	}
+	return qn, nil
+}
@@ -0,0 +1,92 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrReadOnlyReplica matches errors of writes that reached a hot standby
+// (SQLSTATE 25006), e.g. an old primary demoted by a failover.
+var ErrReadOnlyReplica = errors.New("write on a read-only replica")
+
+func isReadOnlyErr(err error) bool {
+	return err != nil && sqlState(err) == "25006"
+}
+
+type replicaOKKey struct{}
+
+// WithReplicaOK lets a Cluster serve reads executed with ctx from replicas.
+func WithReplicaOK(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaOKKey{}, true)
+}
+
+func replicaOK(ctx context.Context) bool {
+	ok, _ := ctx.Value(replicaOKKey{}).(bool)
+	return ok
+}
+
+// Cluster is a primary with hot standby replicas. It can be passed to all
+// helpers: writes and transactions go to the primary, reads marked with
+// WithReplicaOK are spread over the replicas. A statement rejected by a
+// replica as a write is re-dispatched to the primary.
+type Cluster struct {
+	Primary  *sqlx.DB
+	Replicas []*sqlx.DB
+
+	next uint32
+}
+
+func NewCluster(primary *sqlx.DB, replicas ...*sqlx.DB) *Cluster {
+	return &Cluster{Primary: primary, Replicas: replicas}
+}
+
+func (c *Cluster) reader(ctx context.Context, query string) *sqlx.DB {
+	if len(c.Replicas) == 0 || !replicaOK(ctx) || !isReadOnlySQL(query) {
+		return c.Primary
+	}
+	n := atomic.AddUint32(&c.next, 1)
+	return c.Replicas[int(n)%len(c.Replicas)]
+}
+
+func (c *Cluster) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	db := c.reader(ctx, query)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if db != c.Primary && isReadOnlyErr(err) {
+		return c.Primary.QueryContext(ctx, query, args...)
+	}
+	return rows, err
+}
+
+func (c *Cluster) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	db := c.reader(ctx, query)
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if db != c.Primary && isReadOnlyErr(err) {
+		return c.Primary.QueryxContext(ctx, query, args...)
+	}
+	return rows, err
+}
+
+func (c *Cluster) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	db := c.reader(ctx, query)
+	row := db.QueryRowxContext(ctx, query, args...)
+	if db != c.Primary && isReadOnlyErr(row.Err()) {
+		return c.Primary.QueryRowxContext(ctx, query, args...)
+	}
+	return row
+}
+
+func (c *Cluster) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.Primary.ExecContext(ctx, query, args...)
+}
+
+func (c *Cluster) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error) {
+	return c.Primary.BeginTxx(ctx, opts)
+}
+
+func (c *Cluster) Rebind(query string) string {
+	return c.Primary.Rebind(query)
+}
@@ -0,0 +1,48 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/sync/singleflight"
+)
+
+var coalesceReads int32
+
+// SetCoalesceReads makes concurrent identical reads, the same SELECT with
+// the same arguments on the same handle, run once and share the result.
+// Rows of pointer types and map values are shared between the callers. A
+// canceled leading call fails the calls waiting for it.
+func SetCoalesceReads(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&coalesceReads, v)
+}
+
+var readGroup singleflight.Group
+
+func coalescing(db interface{}, query string) bool {
+	if atomic.LoadInt32(&coalesceReads) == 0 || !isReadOnlySQL(query) {
+		return false
+	}
+	_, inTx := db.(*sqlx.Tx)
+	return !inTx
+}
+
+// coalesce runs f once for concurrent calls with the same key. kind tells
+// apart helpers and destination types sharing a query.
+func coalesce(ctx context.Context, db interface{}, kind, query string, args []interface{}, f func() (interface{}, error)) (interface{}, error) {
+	key := fmt.Sprintf("%p\x00%s\x00%s\x00%#v", db, kind, query, args)
+
+	ch := readGroup.DoChan(key, f)
+	select {
+	case res := <-ch:
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return nil, sqlErr(ctx.Err(), query, args...)
+	}
+}
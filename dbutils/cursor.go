@@ -0,0 +1,197 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrCursorClosed is returned by the fetches of a cursor closed by Close
+// or by its idle timeout.
+var ErrCursorClosed = errors.New("cursor is closed")
+
+// Cursor is a server-side cursor, which reads a result in batches of rows
+// of the caller's choice. It lives until the transaction ends or Close,
+// or, declared with DeclareHoldCursor, until Close or its idle timeout.
+type Cursor struct {
+	db interface {
+		Queryer
+		Execer
+	}
+	name string
+
+	// Set for the cursors of DeclareHoldCursor. mu is held during fetches.
+	hold    bool
+	mu      sync.Mutex
+	closed  bool
+	idle    time.Duration
+	timer   *time.Timer
+	lastUse time.Time
+}
+
+// DeclareCursor declares a cursor for query in tx. Unlike SelectMapsEach,
+// the rows are read when asked for with Fetch, and the transaction can run
+// other statements between the fetches.
+func DeclareCursor(ctx context.Context, tx *sqlx.Tx, name, query string, args ...interface{}) (*Cursor, error) {
+	qn, err := cursorIdent(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := Exec(ctx, tx, `DECLARE `+qn+` NO SCROLL CURSOR FOR `+query, args...); err != nil {
+		return nil, err
+	}
+	return &Cursor{db: tx, name: qn}, nil
+}
+
+// DeclareHoldCursor declares a WITH HOLD cursor for query on conn in a
+// transaction of its own. When the transaction commits, the result is
+// stored by the server and the transaction ends, releasing its locks and
+// snapshot, so long exports don't hold back vacuum and DDL; the fetches
+// then run outside of any transaction. Storing the result takes time and
+// space for large results.
+//
+// The cursor stays on conn until Close, which must be called before conn
+// is closed and returned to the pool, or until no fetch happens for idle,
+// if it's positive.
+func DeclareHoldCursor(ctx context.Context, conn *sqlx.Conn, name string, idle time.Duration, query string, args ...interface{}) (*Cursor, error) {
+	qn, err := cursorIdent(name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = RunTx(ctx, conn, func(tx *sqlx.Tx) error {
+		_, err := Exec(ctx, tx, `DECLARE `+qn+` NO SCROLL CURSOR WITH HOLD FOR `+query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cursor{db: conn, name: qn, hold: true, idle: idle, lastUse: time.Now()}
+	if idle > 0 {
+		c.timer = time.AfterFunc(idle, c.expire)
+	}
+	return c, nil
+}
+
+func cursorIdent(name string) (string, error) {
+	if strings.Contains(name, ".") {
+		return "", fmt.Errorf("invalid cursor name %q", name)
+	}
+	qn, err := QuoteIdent(name)
+	if err != nil {
+		return "", fmt.Errorf("cursor %q: %w", name, err)
+	}
+	return qn, nil
+}
+
+// use checks that the cursor is open and stops its idle timeout until done
+// is called after the fetch, which restarts it.
+func (c *Cursor) use() (done func(), err error) {
+	if !c.hold {
+		return func() {}, nil
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("fetch from %s: %w", c.name, ErrCursorClosed)
+	}
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	return func() {
+		c.lastUse = time.Now()
+		if c.timer != nil {
+			c.timer.Reset(c.idle)
+		}
+		c.mu.Unlock()
+	}, nil
+}
+
+// expire closes the cursor after its idle timeout.
+func (c *Cursor) expire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// The timer may have fired while a fetch was running.
+	if c.closed || time.Since(c.lastUse) < c.idle {
+		return
+	}
+	// Not the context of the caller, which may be done.
+	_ = c.closeLocked(context.Background())
+}
+
+// Fetch reads the next n rows into dest, a pointer to a slice, as Select
+// does, replacing its previous contents. It returns false when the cursor
+// is exhausted, dest may still have the last rows then.
+func (c *Cursor) Fetch(ctx context.Context, dest interface{}, n int) (more bool, err error) {
+	if n <= 0 {
+		return false, fmt.Errorf("fetch %d rows", n)
+	}
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return false, fmt.Errorf("fetch into %T: not a pointer to a slice", dest)
+	}
+	done, err := c.use()
+	if err != nil {
+		return false, err
+	}
+	defer done()
+	// Select appends to the slice.
+	v.Elem().Set(reflect.Zero(v.Elem().Type()))
+
+	if err := Select(ctx, c.db, dest, c.fetchQuery(n)); err != nil {
+		return false, err
+	}
+	return v.Elem().Len() == n, nil
+}
+
+// FetchMaps reads the next n rows as SelectMaps does, fewer than n rows
+// mean the cursor is exhausted.
+func (c *Cursor) FetchMaps(ctx context.Context, n int) ([]map[string]interface{}, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("fetch %d rows", n)
+	}
+	done, err := c.use()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return SelectMaps(ctx, c.db, c.fetchQuery(n))
+}
+
+func (c *Cursor) fetchQuery(n int) string {
+	return `FETCH FORWARD ` + strconv.Itoa(n) + ` FROM ` + c.name
+}
+
+// Close closes the cursor, releasing its resources before the transaction
+// ends. Closing a WITH HOLD cursor again does nothing; a fetch running
+// meanwhile is waited for.
+func (c *Cursor) Close(ctx context.Context) error {
+	if !c.hold {
+		_, err := Exec(ctx, c.db, `CLOSE `+c.name)
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	return c.closeLocked(ctx)
+}
+
+func (c *Cursor) closeLocked(ctx context.Context) error {
+	c.closed = true
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	_, err := Exec(ctx, c.db, `CLOSE `+c.name)
+	return err
+}
@@ -0,0 +1,70 @@
+package dbmock_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/mock/gomock"
+
+	"db-example/dbutils"
+	"db-example/dbutils/dbmock"
+	"db-example/dbutils/fake"
+)
+
+// logReporter reports unmet expectations of the examples, where there is
+// no *testing.T.
+type logReporter struct{}
+
+func (logReporter) Errorf(format string, args ...interface{}) { log.Printf(format, args...) }
+func (logReporter) Fatalf(format string, args ...interface{}) { log.Fatalf(format, args...) }
+
+// The mocks stub statements returning an error or a sql.Result.
+func Example_exec() {
+	ctrl := gomock.NewController(logReporter{})
+	defer ctrl.Finish()
+
+	db := dbmock.NewMockExecer(ctrl)
+	db.EXPECT().
+		ExecContext(gomock.Any(), "DELETE FROM users WHERE id = $1", 42).
+		Return(driver.RowsAffected(1), nil)
+
+	res, err := dbutils.Exec(context.Background(), db, "DELETE FROM users WHERE id = $1", 42)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	n, _ := res.RowsAffected()
+	fmt.Println(n)
+
+	starter := dbmock.NewMockTxStarter(ctrl)
+	starter.EXPECT().BeginTxx(gomock.Any(), gomock.Any()).Return(nil, errors.New("pool exhausted"))
+
+	err = dbutils.RunTx(context.Background(), starter, func(*sqlx.Tx) error { return nil })
+	fmt.Println(err != nil)
+	// Output:
+	// 1
+	// true
+}
+
+// Rows can't be mocked, read helpers are tested against fake instead.
+func Example_select() {
+	ctx := context.Background()
+	db := fake.New()
+	defer db.Close()
+
+	db.MustExecContext(ctx, "CREATE TABLE users (id bigint, name text)")
+	db.MustExecContext(ctx, "INSERT INTO users (id, name) VALUES ($1, $2)", 42, "Ann")
+
+	var names []string
+	if err := dbutils.Select(ctx, db, &names, "SELECT name FROM users WHERE id = $1", 42); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(names)
+	// Output:
+	// [Ann]
+}
@@ -0,0 +1,335 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: interfaces.go
+//
+// Generated by this command:
+//
+//	mockgen -source=interfaces.go -destination=dbmock/mocks.go -package=dbmock
+//
+
+// Package dbmock is a generated GoMock package.
+package dbmock
+
+import (
+	context "context"
+	sql "database/sql"
+	reflect "reflect"
+
+	sqlx "github.com/jmoiron/sqlx"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockQueryer is a mock of Queryer interface.
+type MockQueryer struct {
+	ctrl     *gomock.Controller
+	recorder *MockQueryerMockRecorder
+}
+
+// MockQueryerMockRecorder is the mock recorder for MockQueryer.
+type MockQueryerMockRecorder struct {
+	mock *MockQueryer
+}
+
+// NewMockQueryer creates a new mock instance.
+func NewMockQueryer(ctrl *gomock.Controller) *MockQueryer {
+	mock := &MockQueryer{ctrl: ctrl}
+	mock.recorder = &MockQueryerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockQueryer) EXPECT() *MockQueryerMockRecorder {
+	return m.recorder
+}
+
+// QueryContext mocks base method.
+func (m *MockQueryer) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, query}
+	for _, a := range args {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "QueryContext", varargs...)
+	ret0, _ := ret[0].(*sql.Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryContext indicates an expected call of QueryContext.
+func (mr *MockQueryerMockRecorder) QueryContext(ctx, query any, args ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, query}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryContext", reflect.TypeOf((*MockQueryer)(nil).QueryContext), varargs...)
+}
+
+// QueryRowxContext mocks base method.
+func (m *MockQueryer) QueryRowxContext(ctx context.Context, query string, args ...any) *sqlx.Row {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, query}
+	for _, a := range args {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "QueryRowxContext", varargs...)
+	ret0, _ := ret[0].(*sqlx.Row)
+	return ret0
+}
+
+// QueryRowxContext indicates an expected call of QueryRowxContext.
+func (mr *MockQueryerMockRecorder) QueryRowxContext(ctx, query any, args ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, query}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryRowxContext", reflect.TypeOf((*MockQueryer)(nil).QueryRowxContext), varargs...)
+}
+
+// QueryxContext mocks base method.
+func (m *MockQueryer) QueryxContext(ctx context.Context, query string, args ...any) (*sqlx.Rows, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, query}
+	for _, a := range args {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "QueryxContext", varargs...)
+	ret0, _ := ret[0].(*sqlx.Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryxContext indicates an expected call of QueryxContext.
+func (mr *MockQueryerMockRecorder) QueryxContext(ctx, query any, args ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, query}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryxContext", reflect.TypeOf((*MockQueryer)(nil).QueryxContext), varargs...)
+}
+
+// MockExecer is a mock of Execer interface.
+type MockExecer struct {
+	ctrl     *gomock.Controller
+	recorder *MockExecerMockRecorder
+}
+
+// MockExecerMockRecorder is the mock recorder for MockExecer.
+type MockExecerMockRecorder struct {
+	mock *MockExecer
+}
+
+// NewMockExecer creates a new mock instance.
+func NewMockExecer(ctrl *gomock.Controller) *MockExecer {
+	mock := &MockExecer{ctrl: ctrl}
+	mock.recorder = &MockExecerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockExecer) EXPECT() *MockExecerMockRecorder {
+	return m.recorder
+}
+
+// ExecContext mocks base method.
+func (m *MockExecer) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, query}
+	for _, a := range args {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ExecContext", varargs...)
+	ret0, _ := ret[0].(sql.Result)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExecContext indicates an expected call of ExecContext.
+func (mr *MockExecerMockRecorder) ExecContext(ctx, query any, args ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, query}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecContext", reflect.TypeOf((*MockExecer)(nil).ExecContext), varargs...)
+}
+
+// MockTxStarter is a mock of TxStarter interface.
+type MockTxStarter struct {
+	ctrl     *gomock.Controller
+	recorder *MockTxStarterMockRecorder
+}
+
+// MockTxStarterMockRecorder is the mock recorder for MockTxStarter.
+type MockTxStarterMockRecorder struct {
+	mock *MockTxStarter
+}
+
+// NewMockTxStarter creates a new mock instance.
+func NewMockTxStarter(ctrl *gomock.Controller) *MockTxStarter {
+	mock := &MockTxStarter{ctrl: ctrl}
+	mock.recorder = &MockTxStarterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTxStarter) EXPECT() *MockTxStarterMockRecorder {
+	return m.recorder
+}
+
+// BeginTxx mocks base method.
+func (m *MockTxStarter) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BeginTxx", ctx, opts)
+	ret0, _ := ret[0].(*sqlx.Tx)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BeginTxx indicates an expected call of BeginTxx.
+func (mr *MockTxStarterMockRecorder) BeginTxx(ctx, opts any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BeginTxx", reflect.TypeOf((*MockTxStarter)(nil).BeginTxx), ctx, opts)
+}
+
+// MockNamedQueryer is a mock of NamedQueryer interface.
+type MockNamedQueryer struct {
+	ctrl     *gomock.Controller
+	recorder *MockNamedQueryerMockRecorder
+}
+
+// MockNamedQueryerMockRecorder is the mock recorder for MockNamedQueryer.
+type MockNamedQueryerMockRecorder struct {
+	mock *MockNamedQueryer
+}
+
+// NewMockNamedQueryer creates a new mock instance.
+func NewMockNamedQueryer(ctrl *gomock.Controller) *MockNamedQueryer {
+	mock := &MockNamedQueryer{ctrl: ctrl}
+	mock.recorder = &MockNamedQueryerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockNamedQueryer) EXPECT() *MockNamedQueryerMockRecorder {
+	return m.recorder
+}
+
+// QueryContext mocks base method.
+func (m *MockNamedQueryer) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, query}
+	for _, a := range args {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "QueryContext", varargs...)
+	ret0, _ := ret[0].(*sql.Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryContext indicates an expected call of QueryContext.
+func (mr *MockNamedQueryerMockRecorder) QueryContext(ctx, query any, args ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, query}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryContext", reflect.TypeOf((*MockNamedQueryer)(nil).QueryContext), varargs...)
+}
+
+// QueryRowxContext mocks base method.
+func (m *MockNamedQueryer) QueryRowxContext(ctx context.Context, query string, args ...any) *sqlx.Row {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, query}
+	for _, a := range args {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "QueryRowxContext", varargs...)
+	ret0, _ := ret[0].(*sqlx.Row)
+	return ret0
+}
+
+// QueryRowxContext indicates an expected call of QueryRowxContext.
+func (mr *MockNamedQueryerMockRecorder) QueryRowxContext(ctx, query any, args ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, query}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryRowxContext", reflect.TypeOf((*MockNamedQueryer)(nil).QueryRowxContext), varargs...)
+}
+
+// QueryxContext mocks base method.
+func (m *MockNamedQueryer) QueryxContext(ctx context.Context, query string, args ...any) (*sqlx.Rows, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, query}
+	for _, a := range args {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "QueryxContext", varargs...)
+	ret0, _ := ret[0].(*sqlx.Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryxContext indicates an expected call of QueryxContext.
+func (mr *MockNamedQueryerMockRecorder) QueryxContext(ctx, query any, args ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, query}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryxContext", reflect.TypeOf((*MockNamedQueryer)(nil).QueryxContext), varargs...)
+}
+
+// Rebind mocks base method.
+func (m *MockNamedQueryer) Rebind(query string) string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rebind", query)
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Rebind indicates an expected call of Rebind.
+func (mr *MockNamedQueryerMockRecorder) Rebind(query any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rebind", reflect.TypeOf((*MockNamedQueryer)(nil).Rebind), query)
+}
+
+// MockNamedExecer is a mock of NamedExecer interface.
+type MockNamedExecer struct {
+	ctrl     *gomock.Controller
+	recorder *MockNamedExecerMockRecorder
+}
+
+// MockNamedExecerMockRecorder is the mock recorder for MockNamedExecer.
+type MockNamedExecerMockRecorder struct {
+	mock *MockNamedExecer
+}
+
+// NewMockNamedExecer creates a new mock instance.
+func NewMockNamedExecer(ctrl *gomock.Controller) *MockNamedExecer {
+	mock := &MockNamedExecer{ctrl: ctrl}
+	mock.recorder = &MockNamedExecerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockNamedExecer) EXPECT() *MockNamedExecerMockRecorder {
+	return m.recorder
+}
+
+// ExecContext mocks base method.
+func (m *MockNamedExecer) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, query}
+	for _, a := range args {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ExecContext", varargs...)
+	ret0, _ := ret[0].(sql.Result)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExecContext indicates an expected call of ExecContext.
+func (mr *MockNamedExecerMockRecorder) ExecContext(ctx, query any, args ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, query}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecContext", reflect.TypeOf((*MockNamedExecer)(nil).ExecContext), varargs...)
+}
+
+// Rebind mocks base method.
+func (m *MockNamedExecer) Rebind(query string) string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rebind", query)
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Rebind indicates an expected call of Rebind.
+func (mr *MockNamedExecerMockRecorder) Rebind(query any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rebind", reflect.TypeOf((*MockNamedExecer)(nil).Rebind), query)
+}
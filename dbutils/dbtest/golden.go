@@ -0,0 +1,110 @@
+// Package dbtest contains helpers for tests of code built on dbutils.
+package dbtest
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"db-example/dbutils"
+)
+
+var update = flag.Bool("update-golden", false, "rewrite dbtest golden files")
+
+type recorderKey struct{}
+
+type recorder struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+var installOnce sync.Once
+
+func recordMiddleware(next dbutils.QueryFunc) dbutils.QueryFunc {
+	return func(ctx context.Context, q *dbutils.Query) error {
+		if r, ok := ctx.Value(recorderKey{}).(*recorder); ok {
+			r.add(q)
+		}
+		return next(ctx, q)
+	}
+}
+
+func (r *recorder) add(q *dbutils.Query) {
+	entry := NormalizeSQL(q.SQL) + "\n-- args: " + formatArgs(q.Args)
+
+	r.mu.Lock()
+	r.entries = append(r.entries, entry)
+	r.mu.Unlock()
+}
+
+func (r *recorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var buf strings.Builder
+	for i, e := range r.entries {
+		fmt.Fprintf(&buf, "-- query %d\n%s\n", i+1, e)
+	}
+	return buf.String()
+}
+
+// Golden returns a context that records every query executed through
+// dbutils with it. When the test finishes the recorded log is compared with
+// testdata/<name>.golden; run the tests with -update-golden to rewrite it.
+func Golden(t testing.TB, ctx context.Context, name string) context.Context {
+	t.Helper()
+
+	installOnce.Do(func() {
+		dbutils.Use(recordMiddleware)
+	})
+
+	r := &recorder{}
+	path := filepath.Join("testdata", name+".golden")
+
+	t.Cleanup(func() {
+		got := r.String()
+
+		if *update {
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatalf("create golden dir: %v", err)
+			}
+			if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+				t.Fatalf("write golden file: %v", err)
+			}
+			return
+		}
+
+		want, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read golden file (run with -update-golden to create it): %v", err)
+		}
+		if got != string(want) {
+			t.Errorf("queries differ from %s\n--- got:\n%s\n--- want:\n%s", path, got, want)
+		}
+	})
+
+	return context.WithValue(ctx, recorderKey{}, r)
+}
+
+// NormalizeSQL collapses whitespace so formatting-only changes of a query
+// don't break golden files.
+func NormalizeSQL(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+func formatArgs(args []interface{}) string {
+	if args == nil {
+		args = []interface{}{}
+	}
+	b, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Sprintf("%v", args)
+	}
+	return string(b)
+}
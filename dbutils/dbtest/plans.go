@@ -0,0 +1,150 @@
+package dbtest
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"db-example/dbutils"
+)
+
+// PlanOptions tune CheckPlans.
+type PlanOptions struct {
+	// CostFactor is how many times the estimated cost of a plan may exceed
+	// the baseline, 2 if 0.
+	CostFactor float64
+	// Args are the arguments of the queries by name. Queries with
+	// parameters missing here are explained as generic plans, which
+	// requires PostgreSQL 16.
+	Args map[string][]interface{}
+}
+
+// planSummary is the part of a plan compared with the baseline.
+type planSummary struct {
+	Cost     float64  `json:"cost"`
+	SeqScans []string `json:"seq_scans"`
+	Nodes    []string `json:"nodes"`
+}
+
+// CheckPlans explains every query of r on db, a database seeded with
+// representative data, and fails t when a plan regressed compared with
+// testdata/plans/<name>.json: a table is scanned sequentially which wasn't
+// before or the estimated cost grew more than CostFactor times, e.g. after
+// an index was dropped or changed. Run the tests with -update-golden to
+// write the baselines.
+func CheckPlans(t testing.TB, ctx context.Context, db dbutils.Queryer, r *dbutils.Registry, opts PlanOptions) {
+	t.Helper()
+
+	factor := opts.CostFactor
+	if factor == 0 {
+		factor = 2
+	}
+
+	for _, name := range r.Names() {
+		got, err := explain(ctx, db, r.SQL(name), opts.Args[name])
+		if err != nil {
+			t.Errorf("explain %s: %v", name, err)
+			continue
+		}
+		path := filepath.Join("testdata", "plans", name+".json")
+
+		if *update {
+			data, err := json.MarshalIndent(got, "", "\t")
+			if err != nil {
+				t.Fatalf("encode plan of %s: %v", name, err)
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatalf("create plans dir: %v", err)
+			}
+			if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+				t.Fatalf("write plan of %s: %v", name, err)
+			}
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("read plan of %s (run with -update-golden to create it): %v", name, err)
+			continue
+		}
+		var want planSummary
+		if err := json.Unmarshal(data, &want); err != nil {
+			t.Errorf("decode %s: %v", path, err)
+			continue
+		}
+
+		for _, rel := range got.SeqScans {
+			if !containsStr(want.SeqScans, rel) {
+				t.Errorf("query %s scans %s sequentially\n--- plan:\n%s\n--- baseline:\n%s",
+					name, rel, strings.Join(got.Nodes, "\n"), strings.Join(want.Nodes, "\n"))
+			}
+		}
+		if want.Cost > 0 && got.Cost > want.Cost*factor {
+			t.Errorf("query %s costs %.2f, over %g times %.2f of the baseline\n--- plan:\n%s\n--- baseline:\n%s",
+				name, got.Cost, factor, want.Cost, strings.Join(got.Nodes, "\n"), strings.Join(want.Nodes, "\n"))
+		}
+	}
+}
+
+type planNode struct {
+	NodeType string     `json:"Node Type"`
+	Relation string     `json:"Relation Name"`
+	Index    string     `json:"Index Name"`
+	Cost     float64    `json:"Total Cost"`
+	Plans    []planNode `json:"Plans"`
+}
+
+func explain(ctx context.Context, db dbutils.Queryer, query string, args []interface{}) (planSummary, error) {
+	opts := "FORMAT JSON"
+	if args == nil && strings.Contains(query, "$1") {
+		opts += ", GENERIC_PLAN"
+	}
+	var out string
+	if err := dbutils.Get(ctx, db, &out, "EXPLAIN ("+opts+") "+query, args...); err != nil {
+		return planSummary{}, err
+	}
+	var plans []struct {
+		Plan planNode `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(out), &plans); err != nil {
+		return planSummary{}, err
+	}
+	if len(plans) == 0 {
+		return planSummary{}, nil
+	}
+
+	s := planSummary{Cost: plans[0].Plan.Cost}
+	var walk func(n planNode, depth int)
+	walk = func(n planNode, depth int) {
+		line := strings.Repeat("  ", depth) + n.NodeType
+		if n.Relation != "" {
+			line += " on " + n.Relation
+		}
+		if n.Index != "" {
+			line += " using " + n.Index
+		}
+		s.Nodes = append(s.Nodes, line)
+		if strings.HasSuffix(n.NodeType, "Seq Scan") && n.Relation != "" && !containsStr(s.SeqScans, n.Relation) {
+			s.SeqScans = append(s.SeqScans, n.Relation)
+		}
+		for _, c := range n.Plans {
+			walk(c, depth+1)
+		}
+	}
+	walk(plans[0].Plan, 0)
+	sort.Strings(s.SeqScans)
+	return s, nil
+}
+
+func containsStr(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
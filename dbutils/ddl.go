@@ -0,0 +1,319 @@
+package dbutils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect generates the DDL and upserts of a database, so the same schema
+// definitions run on PostgreSQL, MySQL and SQLite, e.g. for tests against
+// SQLite. The other helpers of the package are PostgreSQL only.
+type Dialect int
+
+const (
+	Postgres Dialect = iota
+	MySQL
+	SQLite
+)
+
+var dialectNames = [...]string{"postgres", "mysql", "sqlite"}
+
+func (d Dialect) String() string {
+	if d < 0 || int(d) >= len(dialectNames) {
+		return fmt.Sprintf("Dialect(%d)", int(d))
+	}
+	return dialectNames[d]
+}
+
+// ColumnType is a portable column type.
+type ColumnType int
+
+const (
+	TypeBigInt ColumnType = iota
+	TypeInteger
+	TypeFloat
+	TypeBool
+	// TypeText is unlimited text. MySQL can't index it, use TypeVarchar
+	// for keys.
+	TypeText
+	// TypeVarchar is text of up to Column.Size characters.
+	TypeVarchar
+	TypeTimestamp
+	TypeJSON
+	TypeBytes
+)
+
+// Column describes a column of a TableDef.
+type Column struct {
+	Name string
+	Type ColumnType
+	// Size is the length of TypeVarchar.
+	Size    int
+	NotNull bool
+	// AutoIncrement makes an integer primary key generated on insert:
+	// identity in PostgreSQL, AUTO_INCREMENT in MySQL and AUTOINCREMENT in
+	// SQLite, which requires it to be the only key column.
+	AutoIncrement bool
+	// Default is an SQL expression, used as is.
+	Default string
+}
+
+// TableDef describes a table for CreateTable.
+type TableDef struct {
+	Name       string
+	Columns    []Column
+	PrimaryKey []string
+}
+
+// Quote quotes an identifier.
+func (d Dialect) Quote(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, "\x00\"`") {
+		return "", fmt.Errorf("invalid identifier %q", name)
+	}
+	parts := strings.Split(name, ".")
+	q := `"`
+	if d == MySQL {
+		q = "`"
+	}
+	for i, p := range parts {
+		if p == "" {
+			return "", fmt.Errorf("invalid identifier %q", name)
+		}
+		parts[i] = q + p + q
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// Placeholder returns the placeholder of the argument n, from 1.
+func (d Dialect) Placeholder(n int) string {
+	if d == Postgres {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+func (d Dialect) columnType(c Column) (string, error) {
+	switch c.Type {
+	case TypeBigInt:
+		if d == SQLite {
+			return "INTEGER", nil
+		}
+		return "BIGINT", nil
+	case TypeInteger:
+		return "INTEGER", nil
+	case TypeFloat:
+		if d == Postgres {
+			return "DOUBLE PRECISION", nil
+		}
+		if d == SQLite {
+			return "REAL", nil
+		}
+		return "DOUBLE", nil
+	case TypeBool:
+		if d == SQLite {
+			return "INTEGER", nil
+		}
+		return "BOOLEAN", nil
+	case TypeText:
+		return "TEXT", nil
+	case TypeVarchar:
+		if c.Size <= 0 {
+			return "", fmt.Errorf("column %s: varchar without size", c.Name)
+		}
+		if d == SQLite {
+			return "TEXT", nil
+		}
+		return "VARCHAR(" + strconv.Itoa(c.Size) + ")", nil
+	case TypeTimestamp:
+		switch d {
+		case Postgres:
+			return "TIMESTAMPTZ", nil
+		case MySQL:
+			return "DATETIME(6)", nil
+		}
+		return "TEXT", nil
+	case TypeJSON:
+		switch d {
+		case Postgres:
+			return "JSONB", nil
+		case MySQL:
+			return "JSON", nil
+		}
+		return "TEXT", nil
+	case TypeBytes:
+		if d == Postgres {
+			return "BYTEA", nil
+		}
+		return "BLOB", nil
+	}
+	return "", fmt.Errorf("column %s: unknown type %d", c.Name, c.Type)
+}
+
+// CreateTable returns the CREATE TABLE statement of t.
+func (d Dialect) CreateTable(t TableDef, ifNotExists bool) (string, error) {
+	name, err := d.Quote(t.Name)
+	if err != nil {
+		return "", err
+	}
+
+	var defs []string
+	inlinePK := false
+	for _, c := range t.Columns {
+		col, err := d.Quote(c.Name)
+		if err != nil {
+			return "", err
+		}
+		typ, err := d.columnType(c)
+		if err != nil {
+			return "", err
+		}
+		def := col + " " + typ
+
+		if c.AutoIncrement {
+			if c.Type != TypeBigInt && c.Type != TypeInteger {
+				return "", fmt.Errorf("column %s: auto increment of a non-integer", c.Name)
+			}
+			switch d {
+			case Postgres:
+				def += " GENERATED BY DEFAULT AS IDENTITY"
+			case MySQL:
+				def += " NOT NULL AUTO_INCREMENT"
+			case SQLite:
+				if len(t.PrimaryKey) != 1 || t.PrimaryKey[0] != c.Name {
+					return "", fmt.Errorf("column %s: SQLite auto increments only the sole key column", c.Name)
+				}
+				// Only INTEGER PRIMARY KEY aliases the rowid.
+				def = col + " INTEGER PRIMARY KEY AUTOINCREMENT"
+				inlinePK = true
+			}
+		} else if c.NotNull {
+			def += " NOT NULL"
+		}
+		if c.Default != "" {
+			def += " DEFAULT " + c.Default
+		}
+		defs = append(defs, def)
+	}
+
+	if len(t.PrimaryKey) > 0 && !inlinePK {
+		cols, err := d.quoteAll(t.PrimaryKey)
+		if err != nil {
+			return "", err
+		}
+		defs = append(defs, "PRIMARY KEY ("+strings.Join(cols, ", ")+")")
+	}
+
+	q := "CREATE TABLE "
+	if ifNotExists {
+		q += "IF NOT EXISTS "
+	}
+	return q + name + " (\n\t" + strings.Join(defs, ",\n\t") + "\n)", nil
+}
+
+// DropTable returns the DROP TABLE statement of table.
+func (d Dialect) DropTable(table string, ifExists bool) (string, error) {
+	name, err := d.Quote(table)
+	if err != nil {
+		return "", err
+	}
+	if ifExists {
+		return "DROP TABLE IF EXISTS " + name, nil
+	}
+	return "DROP TABLE " + name, nil
+}
+
+// CreateIndex returns the CREATE INDEX statement of an index name on the
+// columns of table. MySQL doesn't support IF NOT EXISTS for indexes.
+func (d Dialect) CreateIndex(name, table string, columns []string, unique, ifNotExists bool) (string, error) {
+	if ifNotExists && d == MySQL {
+		return "", fmt.Errorf("index %s: IF NOT EXISTS isn't supported by %s", name, d)
+	}
+	idx, err := d.Quote(name)
+	if err != nil {
+		return "", err
+	}
+	t, err := d.Quote(table)
+	if err != nil {
+		return "", err
+	}
+	cols, err := d.quoteAll(columns)
+	if err != nil {
+		return "", err
+	}
+
+	q := "CREATE "
+	if unique {
+		q += "UNIQUE "
+	}
+	q += "INDEX "
+	if ifNotExists {
+		q += "IF NOT EXISTS "
+	}
+	return q + idx + " ON " + t + " (" + strings.Join(cols, ", ") + ")", nil
+}
+
+// Upsert returns a statement inserting a row of columns into table, with
+// the placeholders of the dialect, or updating the update columns of the
+// row with the same key, doing nothing if update is empty. MySQL uses the
+// primary key and the unique indexes of the table instead of key.
+func (d Dialect) Upsert(table string, columns, key, update []string) (string, error) {
+	t, err := d.Quote(table)
+	if err != nil {
+		return "", err
+	}
+	cols, err := d.quoteAll(columns)
+	if err != nil {
+		return "", err
+	}
+	keys, err := d.quoteAll(key)
+	if err != nil {
+		return "", err
+	}
+	upd, err := d.quoteAll(update)
+	if err != nil {
+		return "", err
+	}
+	if len(cols) == 0 || (d != MySQL && len(keys) == 0) {
+		return "", fmt.Errorf("upsert into %s: no columns or key", table)
+	}
+
+	ph := make([]string, len(cols))
+	for i := range ph {
+		ph[i] = d.Placeholder(i + 1)
+	}
+	q := "INSERT INTO " + t + " (" + strings.Join(cols, ", ") + ") VALUES (" + strings.Join(ph, ", ") + ")"
+
+	set := make([]string, len(upd))
+	if d == MySQL {
+		if len(upd) == 0 {
+			// No-op update of the first column.
+			return q + " ON DUPLICATE KEY UPDATE " + cols[0] + " = " + cols[0], nil
+		}
+		for i, c := range upd {
+			set[i] = c + " = VALUES(" + c + ")"
+		}
+		return q + " ON DUPLICATE KEY UPDATE " + strings.Join(set, ", "), nil
+	}
+
+	q += " ON CONFLICT (" + strings.Join(keys, ", ") + ")"
+	if len(upd) == 0 {
+		return q + " DO NOTHING", nil
+	}
+	for i, c := range upd {
+		set[i] = c + " = excluded." + c
+	}
+	return q + " DO UPDATE SET " + strings.Join(set, ", "), nil
+}
+
+func (d Dialect) quoteAll(names []string) ([]string, error) {
+	ret := make([]string, len(names))
+	for i, n := range names {
+		q, err := d.Quote(n)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = q
+	}
+	return ret, nil
+}
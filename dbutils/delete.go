@@ -0,0 +1,64 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DeleteInBatches deletes the rows of table matching where, all if nil, in
+// statements of up to batchSize rows with a pause between them, so that a
+// purge of old data doesn't hold locks for long or write a burst of WAL.
+// Run it outside of transactions, each batch commits on its own. Progress
+// is logged after each batch. It returns the number of deleted rows, also
+// when ctx is done midway.
+func DeleteInBatches(ctx context.Context, db Execer, table string, where Cond, batchSize int, pause time.Duration) (int64, error) {
+	if batchSize <= 0 {
+		return 0, fmt.Errorf("delete from %s: batch size %d", table, batchSize)
+	}
+	qt, err := QuoteIdent(table)
+	if err != nil {
+		return 0, fmt.Errorf("delete from %s: %w", table, err)
+	}
+
+	// DELETE has no LIMIT, the rows of a batch are picked by ctid.
+	var buf strings.Builder
+	var al argList
+	buf.WriteString(`DELETE FROM ` + qt + ` WHERE ctid = ANY(ARRAY(SELECT ctid FROM ` + qt)
+	if where != nil {
+		buf.WriteString(" WHERE ")
+		if err := where.appendSQL(&buf, &al); err != nil {
+			return 0, fmt.Errorf("build delete: %w", err)
+		}
+	}
+	buf.WriteString(` LIMIT ` + strconv.Itoa(batchSize) + `))`)
+	q := buf.String()
+
+	var total int64
+	start := time.Now()
+	for {
+		res, err := Exec(ctx, db, q, al.args...)
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < int64(batchSize) {
+			log.Printf("deleted %d rows from %s in %s", total, table, time.Since(start).Round(time.Millisecond))
+			return total, nil
+		}
+		log.Printf("deleted %d rows from %s so far", total, table)
+
+		select {
+		case <-time.After(pause):
+		case <-ctx.Done():
+			return total, ctx.Err()
+		}
+	}
+}
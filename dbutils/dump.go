@@ -0,0 +1,119 @@
+package dbutils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Backup writes a dump of the database cfg connects to into w in the
+// custom format of pg_dump, which must be in PATH. args are passed to
+// pg_dump, e.g. "--schema=public" or "--exclude-table-data=audit_log".
+func Backup(ctx context.Context, cfg Config, w io.Writer, args ...string) error {
+	connInfo, env, err := toolConnInfo(cfg)
+	if err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+
+	args = append([]string{"--format=custom", "--dbname=" + connInfo}, args...)
+	if err := runTool(ctx, "pg_dump", args, env, nil, w); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	return nil
+}
+
+// Restore restores a dump made by Backup from r into the database cfg
+// connects to with pg_restore, which must be in PATH. args are passed to
+// pg_restore, e.g. "--clean", "--if-exists" and "--no-owner" to refresh an
+// environment from a dump of another one.
+func Restore(ctx context.Context, cfg Config, r io.Reader, args ...string) error {
+	connInfo, env, err := toolConnInfo(cfg)
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+
+	args = append([]string{"--exit-on-error", "--dbname=" + connInfo}, args...)
+	if err := runTool(ctx, "pg_restore", args, env, r, io.Discard); err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	return nil
+}
+
+// runTool runs a client program, returning its error output on failure.
+func runTool(ctx context.Context, name string, args, env []string, stdin io.Reader, stdout io.Writer) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = env
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+var passwordParam = regexp.MustCompile(`(^|\s)password\s*=\s*('(\\.|[^'\\])*'|\S+)`)
+
+// toolConnInfo converts cfg into a connection string for the libpq-based
+// client programs and their environment. The password goes into the
+// environment, so it isn't visible in the process list.
+func toolConnInfo(cfg Config) (connInfo string, env []string, err error) {
+	switch {
+	case cfg.SRV != "":
+		return "", nil, errors.New("SRV isn't supported by the client programs")
+	case cfg.DialFunc != nil:
+		return "", nil, errors.New("DialFunc isn't supported by the client programs")
+	case cfg.Kerberos != nil:
+		return "", nil, errors.New("Kerberos isn't supported by the client programs")
+	case cfg.ClientCert != nil:
+		return "", nil, errors.New("ClientCert isn't supported by the client programs, use sslcert and sslkey files")
+	}
+
+	pc, err := pgconn.ParseConfig(cfg.ConnString)
+	if err != nil {
+		return "", nil, err
+	}
+
+	connInfo = cfg.ConnString
+	if strings.HasPrefix(connInfo, "postgres://") || strings.HasPrefix(connInfo, "postgresql://") {
+		u, err := url.Parse(connInfo)
+		if err != nil {
+			return "", nil, err
+		}
+		if u.User != nil {
+			u.User = url.User(u.User.Username())
+		}
+		q := u.Query()
+		q.Del("password")
+		if cfg.SocketDir != "" {
+			q.Set("host", cfg.SocketDir)
+		}
+		u.RawQuery = q.Encode()
+		connInfo = u.String()
+	} else {
+		connInfo = passwordParam.ReplaceAllString(connInfo, "$1")
+		if cfg.SocketDir != "" {
+			connInfo += " host='" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(cfg.SocketDir) + "'"
+		}
+	}
+
+	env = os.Environ()
+	if pc.Password != "" {
+		env = append(env, "PGPASSWORD="+pc.Password)
+	}
+	return connInfo, env, nil
+}
@@ -0,0 +1,433 @@
+package dbutils
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// KeyProvider supplies the keys of encrypted fields. Keys are 16, 24 or 32
+// bytes long for AES-128, AES-192 or AES-256.
+type KeyProvider interface {
+	// CurrentKey returns the key new values are encrypted with and its ID.
+	CurrentKey(ctx context.Context) (id string, key []byte, err error)
+	// Key returns the key with the ID, including retired ones still needed
+	// to decrypt old values.
+	Key(ctx context.Context, id string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider with keys held in memory. Keys are rotated by
+// adding a new key and making it Current; old keys stay for decryption.
+type StaticKeys struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+func (k StaticKeys) CurrentKey(ctx context.Context) (string, []byte, error) {
+	key, err := k.Key(ctx, k.Current)
+	return k.Current, key, err
+}
+
+func (k StaticKeys) Key(ctx context.Context, id string) ([]byte, error) {
+	key, ok := k.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key %q", id)
+	}
+	return key, nil
+}
+
+type keyProviderHolder struct {
+	p KeyProvider
+}
+
+var keyProvider atomic.Value
+
+// SetKeyProvider sets the provider of keys for fields tagged
+// `db:"name,encrypted"`. Such fields are encrypted in arguments of Named*
+// helpers, InsertMany and LoadTempTable and decrypted when Select or Get
+// scan into them. The values are bound to their column and, see
+// EncryptionBound, to their table and row.
+func SetKeyProvider(p KeyProvider) {
+	keyProvider.Store(keyProviderHolder{p})
+}
+
+func currentKeyProvider() (KeyProvider, error) {
+	h, _ := keyProvider.Load().(keyProviderHolder)
+	if h.p == nil {
+		return nil, errors.New("no encryption key provider, see SetKeyProvider")
+	}
+	return h.p, nil
+}
+
+// encPrefix starts encrypted values: "enc:<key ID>:<base64 of nonce and
+// ciphertext>".
+const encPrefix = "enc:"
+
+// EncryptionContext tells where an encrypted value is stored. It's
+// authenticated along with the value and the key ID, so a value copied to
+// another table, column or row doesn't decrypt.
+type EncryptionContext struct {
+	Table  string
+	Column string
+	// Row identifies the row, e.g. by its primary key, if it's known
+	// before the row is inserted and never changes.
+	Row string
+}
+
+// aad returns the additional authenticated data of values encrypted with
+// the key keyID.
+func (c EncryptionContext) aad(keyID string) []byte {
+	var b []byte
+	for _, s := range []string{keyID, c.Table, c.Column, c.Row} {
+		b = binary.AppendUvarint(b, uint64(len(s)))
+		b = append(b, s...)
+	}
+	return b
+}
+
+// Encrypt encrypts plaintext stored at ec with AES-GCM using the current
+// key.
+func Encrypt(ctx context.Context, plaintext []byte, ec EncryptionContext) (string, error) {
+	p, err := currentKeyProvider()
+	if err != nil {
+		return "", err
+	}
+	id, key, err := p.CurrentKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("get encryption key: %w", err)
+	}
+	if strings.Contains(id, ":") {
+		return "", fmt.Errorf("encryption key ID %q contains a colon", id)
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, ec.aad(id))
+
+	return encPrefix + id + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value produced by Encrypt with the key it was
+// encrypted with. ec must be the one it was encrypted with.
+func Decrypt(ctx context.Context, value string, ec EncryptionContext) ([]byte, error) {
+	id, sealed, err := parseEncrypted(value)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := currentKeyProvider()
+	if err != nil {
+		return nil, err
+	}
+	key, err := p.Key(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get encryption key: %w", err)
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted value is too short")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], ec.aad(id))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt value: %w", err)
+	}
+	return plaintext, nil
+}
+
+// Reencrypt re-encrypts value with the current key, for rotating stored
+// values. Values already encrypted with the current key are returned as is.
+func Reencrypt(ctx context.Context, value string, ec EncryptionContext) (string, error) {
+	id, _, err := parseEncrypted(value)
+	if err != nil {
+		return "", err
+	}
+	p, err := currentKeyProvider()
+	if err != nil {
+		return "", err
+	}
+	cur, _, err := p.CurrentKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("get encryption key: %w", err)
+	}
+	if id == cur {
+		return value, nil
+	}
+
+	plaintext, err := Decrypt(ctx, value, ec)
+	if err != nil {
+		return "", err
+	}
+	return Encrypt(ctx, plaintext, ec)
+}
+
+func parseEncrypted(value string) (id string, sealed []byte, err error) {
+	rest, ok := strings.CutPrefix(value, encPrefix)
+	if !ok {
+		return "", nil, errors.New("value is not encrypted")
+	}
+	id, data, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", nil, errors.New("malformed encrypted value")
+	}
+	sealed, err = base64.RawStdEncoding.DecodeString(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	return id, sealed, nil
+}
+
+// isEncryptedValue reports whether v, a string or []byte, was produced by
+// Encrypt.
+func isEncryptedValue(v interface{}) bool {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return false
+	}
+	_, _, err := parseEncrypted(s)
+	return err == nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptionBound is implemented by structs with encrypted fields to give
+// the table and the row of the encryption context of the fields, whose
+// column is the one of the field. The row must be scanned along with the
+// encrypted fields; without the method, values are bound to their column
+// only.
+type EncryptionBound interface {
+	EncryptionBinding() (table, row string)
+}
+
+type encryptedField struct {
+	index  []int
+	column string
+}
+
+var encryptedFieldsCache sync.Map
+
+// encryptedFields returns the string and []byte fields of struct type t
+// tagged as encrypted, including fields of embedded structs.
+func encryptedFields(t reflect.Type) []encryptedField {
+	if v, ok := encryptedFieldsCache.Load(t); ok {
+		return v.([]encryptedField)
+	}
+
+	var fields []encryptedField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			for _, ef := range encryptedFields(f.Type) {
+				ef.index = append([]int{i}, ef.index...)
+				fields = append(fields, ef)
+			}
+			continue
+		}
+
+		name, opts, _ := strings.Cut(f.Tag.Get("db"), ",")
+		if !hasOption(opts, "encrypted") {
+			continue
+		}
+		if name == "" {
+			// The default name mapping of sqlx.
+			name = strings.ToLower(f.Name)
+		}
+		switch {
+		case f.Type.Kind() == reflect.String,
+			f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() == reflect.Uint8:
+			fields = append(fields, encryptedField{index: []int{i}, column: name})
+		}
+	}
+
+	encryptedFieldsCache.Store(t, fields)
+	return fields
+}
+
+// fieldContext returns the encryption context of the field of the
+// addressable struct s.
+func fieldContext(s reflect.Value, f encryptedField) EncryptionContext {
+	ec := EncryptionContext{Column: f.column}
+	if b, ok := s.Addr().Interface().(EncryptionBound); ok {
+		ec.Table, ec.Row = b.EncryptionBinding()
+	}
+	return ec
+}
+
+func hasOption(opts, name string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if strings.TrimSpace(o) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// EncryptFields returns arg with the encrypted fields replaced by their
+// ciphertext. arg may be a struct, a pointer to one or a slice of either;
+// it's copied, not modified. Other values are returned as is.
+func EncryptFields(ctx context.Context, arg interface{}) (interface{}, error) {
+	v := reflect.ValueOf(arg)
+	switch {
+	case !v.IsValid():
+		return arg, nil
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		if st := structType(v.Type().Elem()); st == nil || len(encryptedFields(st)) == 0 {
+			return arg, nil
+		}
+		ret := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			e, err := encryptStruct(ctx, v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			ret.Index(i).Set(e)
+		}
+		return ret.Interface(), nil
+	}
+
+	if st := structType(v.Type()); st == nil || len(encryptedFields(st)) == 0 {
+		return arg, nil
+	}
+	e, err := encryptStruct(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+	return e.Interface(), nil
+}
+
+func structType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+// encryptStruct returns a copy of the struct or struct pointer v with the
+// encrypted fields encrypted.
+func encryptStruct(ctx context.Context, v reflect.Value) (reflect.Value, error) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return v, nil
+	}
+
+	s := reflect.New(structType(v.Type())).Elem()
+	s.Set(reflect.Indirect(v))
+
+	for _, ef := range encryptedFields(s.Type()) {
+		f := s.FieldByIndex(ef.index)
+		if f.Len() == 0 {
+			continue
+		}
+
+		var plaintext []byte
+		if f.Kind() == reflect.String {
+			plaintext = []byte(f.String())
+		} else {
+			plaintext = f.Bytes()
+		}
+		enc, err := Encrypt(ctx, plaintext, fieldContext(s, ef))
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("encrypt %s: %w", s.Type().FieldByIndex(ef.index).Name, err)
+		}
+		if f.Kind() == reflect.String {
+			f.SetString(enc)
+		} else {
+			f.SetBytes([]byte(enc))
+		}
+	}
+
+	if v.Kind() == reflect.Ptr {
+		return s.Addr(), nil
+	}
+	return s, nil
+}
+
+// DecryptFields decrypts the encrypted fields of the struct dest points to,
+// or of the structs in the slice it points to, in place. Values not
+// produced by Encrypt are left as is, so plaintext columns can be
+// encrypted gradually.
+func DecryptFields(ctx context.Context, dest interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(dest))
+	if !v.IsValid() {
+		return nil
+	}
+
+	if v.Kind() == reflect.Slice {
+		st := structType(v.Type().Elem())
+		if st == nil || len(encryptedFields(st)) == 0 {
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := decryptStruct(ctx, reflect.Indirect(v.Index(i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if v.Kind() != reflect.Struct || len(encryptedFields(v.Type())) == 0 {
+		return nil
+	}
+	return decryptStruct(ctx, v)
+}
+
+func decryptStruct(ctx context.Context, s reflect.Value) error {
+	if !s.IsValid() {
+		return nil
+	}
+
+	for _, ef := range encryptedFields(s.Type()) {
+		f := s.FieldByIndex(ef.index)
+		var value string
+		if f.Kind() == reflect.String {
+			value = f.String()
+		} else {
+			value = string(f.Bytes())
+		}
+		if !strings.HasPrefix(value, encPrefix) {
+			continue
+		}
+
+		plaintext, err := Decrypt(ctx, value, fieldContext(s, ef))
+		if err != nil {
+			return fmt.Errorf("decrypt %s: %w", s.Type().FieldByIndex(ef.index).Name, err)
+		}
+		if f.Kind() == reflect.String {
+			f.SetString(string(plaintext))
+		} else {
+			f.SetBytes(plaintext)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package dbutils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErasureAction is what EraseSubject does with the subject's rows.
+type ErasureAction int
+
+const (
+	// EraseDelete deletes the rows.
+	EraseDelete ErasureAction = iota
+	// EraseNull sets the columns to NULL.
+	EraseNull
+	// ErasePseudonymize replaces the text columns with a random pseudonym,
+	// the same for all columns of one erasure.
+	ErasePseudonymize
+)
+
+// ErasureRule covers the rows of one table belonging to a subject.
+type ErasureRule struct {
+	Table string
+	// SubjectColumn holds the subject ID, e.g. "user_id".
+	SubjectColumn string
+	Action        ErasureAction
+	// Columns are nulled or pseudonymized, unused with EraseDelete.
+	Columns []string
+}
+
+// ErasureConfig describes where personal data of a subject is kept.
+type ErasureConfig struct {
+	// Rules run in order, so rows referencing others must come first.
+	Rules []ErasureRule
+	// AuditTable, if set, gets a row per erasure. It must have the columns
+	// subject_hash text, erased_at timestamptz and affected jsonb. The
+	// subject ID is stored as its HMAC-SHA256 with AuditKey, not in clear.
+	AuditTable string
+	// AuditKey is the secret key of the subject hashes, required with
+	// AuditTable. A plain hash of a low-entropy ID, e.g. a serial number,
+	// could be reversed by trying all IDs.
+	AuditKey []byte
+}
+
+var erasure struct {
+	sync.RWMutex
+	cfg ErasureConfig
+}
+
+// SetErasureConfig sets the tables EraseSubject erases data in.
+func SetErasureConfig(cfg ErasureConfig) {
+	erasure.Lock()
+	erasure.cfg = cfg
+	erasure.Unlock()
+}
+
+// EraseSubject erases personal data of the subject according to the
+// configuration set with SetErasureConfig, in one transaction together with
+// the audit record.
+func EraseSubject(ctx context.Context, db TxStarter, subjectID interface{}) error {
+	erasure.RLock()
+	cfg := erasure.cfg
+	erasure.RUnlock()
+
+	if len(cfg.Rules) == 0 {
+		return errors.New("no erasure rules, see SetErasureConfig")
+	}
+	if cfg.AuditTable != "" && len(cfg.AuditKey) == 0 {
+		return errors.New("erasure audit table without a key, see ErasureConfig.AuditKey")
+	}
+
+	pseudonym, err := newPseudonym()
+	if err != nil {
+		return err
+	}
+
+	return RunTx(ctx, db, func(tx *sqlx.Tx) error {
+		affected := map[string]int64{}
+		for _, r := range cfg.Rules {
+			query, args, err := r.query(subjectID, pseudonym)
+			if err != nil {
+				return err
+			}
+			res, err := Exec(ctx, tx, query, args...)
+			if err != nil {
+				return fmt.Errorf("erase subject in %s: %w", r.Table, err)
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			affected[r.Table] += n
+		}
+
+		if cfg.AuditTable == "" {
+			return nil
+		}
+		table, err := QuoteIdent(cfg.AuditTable)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(affected)
+		if err != nil {
+			return err
+		}
+		_, err = Exec(ctx, tx,
+			`INSERT INTO `+table+` (subject_hash, erased_at, affected) VALUES ($1, now(), $2::jsonb)`,
+			hex.EncodeToString(textHMAC(cfg.AuditKey, subjectID)), string(data))
+		return err
+	})
+}
+
+func (r ErasureRule) query(subjectID interface{}, pseudonym string) (string, []interface{}, error) {
+	table, err := QuoteIdent(r.Table)
+	if err != nil {
+		return "", nil, err
+	}
+	subject, err := QuoteIdent(r.SubjectColumn)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if r.Action == EraseDelete {
+		return `DELETE FROM ` + table + ` WHERE ` + subject + ` = $1`, []interface{}{subjectID}, nil
+	}
+	if len(r.Columns) == 0 {
+		return "", nil, fmt.Errorf("erasure rule for %s has no columns", r.Table)
+	}
+
+	args := []interface{}{subjectID}
+	value := "NULL"
+	switch r.Action {
+	case EraseNull:
+	case ErasePseudonymize:
+		args = append(args, pseudonym)
+		value = "$2"
+	default:
+		return "", nil, fmt.Errorf("unknown erasure action %d", r.Action)
+	}
+
+	set := make([]string, len(r.Columns))
+	for i, c := range r.Columns {
+		col, err := QuoteIdent(c)
+		if err != nil {
+			return "", nil, err
+		}
+		set[i] = col + " = " + value
+	}
+
+	return `UPDATE ` + table + ` SET ` + strings.Join(set, ", ") + ` WHERE ` + subject + ` = $1`, args, nil
+}
+
+func newPseudonym() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "erased-" + hex.EncodeToString(b), nil
+}
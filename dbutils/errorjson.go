@@ -0,0 +1,55 @@
+package dbutils
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrorBody is the JSON shape of an error made by ErrorJSON. Fields other
+// than code and retryable are set only for errors reported by the server.
+type ErrorBody struct {
+	Code       string `json:"code"`
+	Constraint string `json:"constraint,omitempty"`
+	Table      string `json:"table,omitempty"`
+	Column     string `json:"column,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+	Retryable  bool   `json:"retryable"`
+}
+
+// ErrorJSON describes err for API responses, e.g. which constraint a
+// conflicting write violated. Unlike Error it contains no query or
+// arguments, but Detail may quote the offending values.
+func ErrorJSON(err error) ErrorBody {
+	code := CodeOf(err)
+	body := ErrorBody{
+		Code:      code.String(),
+		Retryable: IsRetryable(err),
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		body.Constraint = pgErr.ConstraintName
+		body.Table = pgErr.TableName
+		body.Column = pgErr.ColumnName
+		body.Detail = pgErr.Detail
+	}
+	return body
+}
+
+// IsRetryable tells if repeating the failed operation, e.g. the whole
+// transaction, may succeed: the database was unavailable or timed out, or
+// the transaction lost a serialization or lock conflict. Constraint
+// violations are not retryable.
+func IsRetryable(err error) bool {
+	switch CodeOf(err) {
+	case Unavailable, Timeout:
+		return true
+	case Conflict:
+		switch sqlState(err) {
+		case "40001", "40P01", "55P03":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,228 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// Code is a machine-readable category of a database error, meant for
+// mapping to HTTP/gRPC statuses.
+type Code int
+
+const (
+	OK Code = iota
+	NotFound
+	Conflict
+	Timeout
+	Canceled
+	Unavailable
+	Internal
+	// InvalidArgument is a bad request rejected before reaching the
+	// database, e.g. a malformed page cursor.
+	InvalidArgument
+)
+
+var codeNames = [...]string{"OK", "NotFound", "Conflict", "Timeout", "Canceled", "Unavailable", "Internal", "InvalidArgument"}
+
+func (c Code) String() string {
+	if c < 0 || int(c) >= len(codeNames) {
+		return fmt.Sprintf("Code(%d)", int(c))
+	}
+	return codeNames[c]
+}
+
+// Error is returned by the query helpers.
+type Error struct {
+	Code  Code
+	Query string
+	Args  []interface{}
+	Err   error
+
+	// SQL is the statement as the server received it, after the middleware
+	// and rewriters, when it differs from Query. Positions reported by the
+	// server refer to it.
+	SQL string
+
+	// Stack holds the program counters of the caller when stack capture is
+	// enabled with SetErrorStacks.
+	Stack []uintptr
+
+	// TxID and BackendPID identify the transaction of RunTx the error
+	// happened in, when enabled with SetTxIDs.
+	TxID       int64
+	BackendPID int32
+}
+
+func (e *Error) Error() string {
+	// Long queries are shown around the position of the error only.
+	if snippet, ok := e.positionSnippet(); ok {
+		return fmt.Sprintf(`run query with args %+v: %v%s at %s`, e.Args, e.Err, e.txSuffix(), snippet)
+	}
+	return fmt.Sprintf(`run query "%s" with args %+v: %v%s`, e.Query, e.Args, e.Err, e.txSuffix())
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrReadOnlyReplica) match writes rejected by a
+// hot standby.
+func (e *Error) Is(target error) bool {
+	return target == ErrReadOnlyReplica && isReadOnlyErr(e.Err)
+}
+
+// Format prints the captured stack trace for %+v.
+func (e *Error) Format(s fmt.State, verb rune) {
+	if verb == 'q' {
+		fmt.Fprintf(s, "%q", e.Error())
+		return
+	}
+	_, _ = io.WriteString(s, e.Error())
+	if verb == 'v' && s.Flag('+') && len(e.Stack) > 0 {
+		_, _ = io.WriteString(s, "\n"+e.StackTrace())
+	}
+}
+
+// StackTrace renders Stack, one "function\n\tfile:line" entry per frame.
+func (e *Error) StackTrace() string {
+	var buf strings.Builder
+	frames := runtime.CallersFrames(e.Stack)
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&buf, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+	return buf.String()
+}
+
+var errorStacks int32
+
+// SetErrorStacks turns on capturing of stack traces in Error. It's off by
+// default because of the cost, building with the dbutils_errstack tag turns
+// it on from the start.
+func SetErrorStacks(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&errorStacks, v)
+}
+
+// QueryError wraps err returned for query into an *Error.
+func QueryError(err error, query string, args ...interface{}) error {
+	return sqlErr(err, query, args...)
+}
+
+func sqlErr(err error, query string, args ...interface{}) error {
+	e := &Error{Code: classify(err), Query: query, Args: args, Err: err}
+	var s *sentErr
+	if errors.As(err, &s) && s.sql != query {
+		e.SQL = s.sql
+	}
+	if s, ok := err.(*sentErr); ok {
+		e.Err = s.err
+	}
+	if atomic.LoadInt32(&errorStacks) != 0 {
+		pcs := make([]uintptr, 32)
+		// Skip runtime.Callers and sqlErr itself.
+		e.Stack = pcs[:runtime.Callers(2, pcs)]
+	}
+	return e
+}
+
+// CodeOf returns the code of err. Errors that didn't come from the query
+// helpers are classified on the fly; nil gives OK.
+func CodeOf(err error) Code {
+	if err == nil {
+		return OK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return classify(err)
+}
+
+// sqlStateErr is implemented by pgconn.PgError and lib/pq errors.
+type sqlStateErr interface {
+	SQLState() string
+}
+
+func sqlState(err error) string {
+	var se sqlStateErr
+	if errors.As(err, &se) {
+		return se.SQLState()
+	}
+	return ""
+}
+
+func classify(err error) Code {
+	switch {
+	case err == nil:
+		return OK
+	case errors.Is(err, sql.ErrNoRows):
+		return NotFound
+	case errors.Is(err, context.Canceled):
+		return Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return Timeout
+	case errors.Is(err, ErrInvalidCursor):
+		return InvalidArgument
+	}
+
+	if state := sqlState(err); state != "" {
+		return classifySQLState(state)
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return Timeout
+	case errors.Is(err, driver.ErrBadConn),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.As(err, &netErr):
+		return Unavailable
+	}
+
+	return Internal
+}
+
+func classifySQLState(state string) Code {
+	switch state {
+	case "40001", "40P01", "55P03":
+		// serialization_failure, deadlock_detected, lock_not_available
+		return Conflict
+	case "57014":
+		// query_canceled, raised by statement_timeout
+		return Timeout
+	case "57P01", "57P02", "57P03", "53300", "25006":
+		// shutdowns, cannot_connect_now, too_many_connections,
+		// read_only_sql_transaction on a standby
+		return Unavailable
+	}
+
+	switch {
+	case strings.HasPrefix(state, "23"):
+		// integrity_constraint_violation
+		return Conflict
+	case strings.HasPrefix(state, "08"):
+		// connection_exception
+		return Unavailable
+	}
+
+	return Internal
+}
@@ -0,0 +1,82 @@
+package dbutils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// sentErr records the statement that failed as sent to the server, which
+// the position of the error refers to.
+type sentErr struct {
+	sql string
+	err error
+}
+
+func (e *sentErr) Error() string { return e.err.Error() }
+
+func (e *sentErr) Unwrap() error { return e.err }
+
+// withSentSQL attaches sql to err if the server located the error in it.
+func withSentSQL(err error, sql string) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Position <= 0 {
+		return err
+	}
+	return &sentErr{sql: sql, err: err}
+}
+
+// sentSQL returns the statement the server received.
+func (e *Error) sentSQL() string {
+	if e.SQL != "" {
+		return e.SQL
+	}
+	return e.Query
+}
+
+// Position locates the error of the server in the statement it received,
+// SQL or else Query, from 1. It's zero if the server didn't report one.
+func (e *Error) Position() (line, column int) {
+	var pgErr *pgconn.PgError
+	if !errors.As(e.Err, &pgErr) || pgErr.Position <= 0 {
+		return 0, 0
+	}
+	// The position counts characters, not bytes.
+	rs := []rune(e.sentSQL())
+	pos := int(pgErr.Position) - 1
+	if pos > len(rs) {
+		return 0, 0
+	}
+	line, column = 1, 1
+	for _, r := range rs[:pos] {
+		if r == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return line, column
+}
+
+// positionSnippet returns the line of the error and the one before it with
+// the position marked, for queries of several lines.
+func (e *Error) positionSnippet() (string, bool) {
+	line, column := e.Position()
+	sql := e.sentSQL()
+	if line == 0 || !strings.Contains(sql, "\n") {
+		return "", false
+	}
+
+	lines := strings.Split(sql, "\n")
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "line %d, column %d:", line, column)
+	width := len(fmt.Sprint(line))
+	for i := max(line-2, 0); i < line; i++ {
+		fmt.Fprintf(&buf, "\n\t%*d | %s", width, i+1, strings.ReplaceAll(lines[i], "\t", " "))
+	}
+	fmt.Fprintf(&buf, "\n\t%*s | %s^", width, "", strings.Repeat(" ", column-1))
+	return buf.String(), true
+}
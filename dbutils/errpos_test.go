@@ -0,0 +1,73 @@
+package dbutils_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"db-example/dbutils"
+)
+
+// syntaxErrDB rejects statements like the server does for a misspelled
+// FROM, locating the error in the statement it received.
+type syntaxErrDB struct{}
+
+func (syntaxErrDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	i := strings.Index(query, "FORM")
+	if i < 0 {
+		return nil, nil
+	}
+	return nil, &pgconn.PgError{
+		Severity: "ERROR",
+		Code:     "42601",
+		Message:  `syntax error at or near "FORM"`,
+		Position: int32(utf8.RuneCountInString(query[:i]) + 1),
+	}
+}
+
+func TestErrorPosition(t *testing.T) {
+	const query = "SELECT id,\n\tname -- имя\nFORM users\nWHERE id = $1"
+
+	for _, tc := range []struct {
+		name     string
+		mw       []dbutils.Middleware
+		wantSQL  string
+		wantLine int
+		wantCol  int
+	}{
+		{name: "plain", wantLine: 3, wantCol: 1},
+		{
+			name:     "annotated",
+			mw:       []dbutils.Middleware{dbutils.AnnotateSQL},
+			wantSQL:  "/* op=users */ " + query,
+			wantLine: 3,
+			wantCol:  1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			defer dbutils.Use(tc.mw...)()
+
+			ctx := dbutils.WithOpName(context.Background(), "users")
+			_, err := dbutils.Exec(ctx, syntaxErrDB{}, query, 1)
+
+			var e *dbutils.Error
+			if !errors.As(err, &e) {
+				t.Fatalf("got %v, want *dbutils.Error", err)
+			}
+			if e.SQL != tc.wantSQL {
+				t.Errorf("SQL = %q, want %q", e.SQL, tc.wantSQL)
+			}
+			if line, col := e.Position(); line != tc.wantLine || col != tc.wantCol {
+				t.Errorf("Position() = %d, %d, want %d, %d", line, col, tc.wantLine, tc.wantCol)
+			}
+			if msg := e.Error(); !strings.Contains(msg, "3 | FORM users\n\t  | ^") {
+				t.Errorf("Error() = %q, want the FORM line marked", msg)
+			}
+		})
+	}
+}
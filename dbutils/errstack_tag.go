@@ -0,0 +1,7 @@
+//go:build dbutils_errstack
+
+package dbutils
+
+func init() {
+	SetErrorStacks(true)
+}
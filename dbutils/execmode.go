@@ -0,0 +1,28 @@
+package dbutils
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type execModeKey struct{}
+
+// WithExecMode makes statements executed with ctx use mode instead of the
+// connection default, e.g. pgx.QueryExecModeSimpleProtocol for a query
+// whose generic prepared plan is bad. The default for a whole DB is set
+// with the default_query_exec_mode connection string parameter.
+//
+// The mode is passed to pgx as the first query argument, so it only works
+// with the pgx driver.
+func WithExecMode(ctx context.Context, mode pgx.QueryExecMode) context.Context {
+	return context.WithValue(ctx, execModeKey{}, mode)
+}
+
+func execModeArgs(ctx context.Context, args []interface{}) []interface{} {
+	mode, ok := ctx.Value(execModeKey{}).(pgx.QueryExecMode)
+	if !ok {
+		return args
+	}
+	return append([]interface{}{mode}, args...)
+}
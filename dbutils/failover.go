@@ -0,0 +1,85 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql/driver"
+	"log"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
+)
+
+// primaryTracer detects a demoted primary on the connections of one pool
+// opened with read-write targeting. When a statement fails because the
+// server turned read-only, i.e. after a failover demoted it, the pool's
+// generation is bumped. Pooled connections made before that are dropped on
+// reuse, new ones go through host selection again.
+type primaryTracer struct {
+	generation int64
+}
+
+const primaryGenerationKey = "dbutils.primaryGeneration"
+
+type demotedKey struct{}
+
+// targetsPrimary reports whether config only accepts a read-write server,
+// as with target_session_attrs=read-write or primary.
+func targetsPrimary(config *pgconn.Config) bool {
+	if config.ValidateConnect == nil {
+		return false
+	}
+	p := reflect.ValueOf(config.ValidateConnect).Pointer()
+	return p == reflect.ValueOf(pgconn.ValidateConnectTargetSessionAttrsReadWrite).Pointer() ||
+		p == reflect.ValueOf(pgconn.ValidateConnectTargetSessionAttrsPrimary).Pointer()
+}
+
+func (t *primaryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return ctx
+}
+
+func (t *primaryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	if !isReadOnlyErr(data.Err) {
+		return
+	}
+	atomic.AddInt64(&t.generation, 1)
+	if demoted, ok := ctx.Value(demotedKey{}).(*bool); ok {
+		*demoted = true
+	}
+}
+
+func (t *primaryTracer) markConn(conn *pgx.Conn) {
+	conn.PgConn().CustomData()[primaryGenerationKey] = atomic.LoadInt64(&t.generation)
+}
+
+// dropDemotedConn makes database/sql discard connections made before the
+// last failover detected in the pool.
+func (t *primaryTracer) dropDemotedConn(ctx context.Context, conn *pgx.Conn) error {
+	gen, _ := conn.PgConn().CustomData()[primaryGenerationKey].(int64)
+	if gen != atomic.LoadInt64(&t.generation) {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+// retryDemotedPrimary retries a statement rejected with 25006 by the
+// primary of a pool opened with read-write targeting once on a fresh
+// connection. The statement wasn't executed, so it's safe to repeat even
+// for writes.
+func retryDemotedPrimary(db interface{}, f QueryFunc) QueryFunc {
+	return func(ctx context.Context, q *Query) error {
+		var demoted bool
+		err := f(context.WithValue(ctx, demotedKey{}, &demoted), q)
+		if !demoted || !isReadOnlyErr(err) {
+			return err
+		}
+		if _, ok := db.(*sqlx.Tx); ok {
+			return err
+		}
+
+		log.Printf("primary is read-only, reconnecting %s: %v", q.Annotation(), err)
+		return f(ctx, q)
+	}
+}
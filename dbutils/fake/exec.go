@@ -0,0 +1,513 @@
+package fake
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+type column struct {
+	name   string
+	serial bool
+}
+
+type table struct {
+	columns []column
+	rows    [][]driver.Value
+	seq     map[int]int64
+}
+
+func (t *table) columnIndex(name string) (int, error) {
+	for i, c := range t.columns {
+		if c.name == name {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("column %q does not exist", name)
+}
+
+type statement interface {
+	// exec runs the statement, recording how to undo its changes in undo
+	// if it's run in a transaction.
+	exec(db *database, undo *undoLog) (*result, error)
+}
+
+// undoLog collects the changes of a transaction, undone in reverse order on
+// rollback. Changes made meanwhile by other connections are kept, as are
+// the values taken from serial sequences, like in PostgreSQL.
+type undoLog []func(db *database)
+
+func (l *undoLog) add(f func(db *database)) {
+	if l != nil {
+		*l = append(*l, f)
+	}
+}
+
+func (l undoLog) rollback(db *database) {
+	for i := len(l) - 1; i >= 0; i-- {
+		l[i](db)
+	}
+}
+
+// removeRow removes the row from t, found by identity.
+func (t *table) removeRow(row []driver.Value) {
+	for i, r := range t.rows {
+		if len(r) == len(row) && (len(r) == 0 || &r[0] == &row[0]) {
+			t.rows = append(t.rows[:i:i], t.rows[i+1:]...)
+			return
+		}
+	}
+}
+
+type result struct {
+	columns  []string
+	rows     [][]driver.Value
+	affected int64
+}
+
+type selectColumn struct {
+	name  string
+	alias string
+	star  bool
+	count bool
+}
+
+type condition struct {
+	column string
+	op     string
+	value  driver.Value
+}
+
+type orderBy struct {
+	column string
+	desc   bool
+}
+
+type assignment struct {
+	column string
+	value  driver.Value
+}
+
+type selectStmt struct {
+	table   string
+	columns []selectColumn
+	where   []condition
+	orderBy []orderBy
+	limit   int
+	offset  int
+}
+
+// columnDefault is DEFAULT in the values of an INSERT.
+type columnDefault struct{}
+
+type insertStmt struct {
+	table     string
+	columns   []string
+	rows      [][]driver.Value
+	returning []selectColumn
+}
+
+type updateStmt struct {
+	table     string
+	set       []assignment
+	where     []condition
+	returning []selectColumn
+}
+
+type deleteStmt struct {
+	table     string
+	where     []condition
+	returning []selectColumn
+}
+
+type createStmt struct {
+	table       string
+	columns     []column
+	ifNotExists bool
+}
+
+type dropStmt struct {
+	table    string
+	ifExists bool
+}
+
+func (db *database) table(name string) (*table, error) {
+	t, ok := db.tables[name]
+	if !ok {
+		return nil, fmt.Errorf("relation %q does not exist", name)
+	}
+	return t, nil
+}
+
+func (s *createStmt) exec(db *database, undo *undoLog) (*result, error) {
+	if _, ok := db.tables[s.table]; ok {
+		if s.ifNotExists {
+			return &result{}, nil
+		}
+		return nil, fmt.Errorf("relation %q already exists", s.table)
+	}
+	t := &table{columns: s.columns, seq: map[int]int64{}}
+	db.tables[s.table] = t
+	undo.add(func(db *database) {
+		if db.tables[s.table] == t {
+			delete(db.tables, s.table)
+		}
+	})
+	return &result{}, nil
+}
+
+func (s *dropStmt) exec(db *database, undo *undoLog) (*result, error) {
+	t, ok := db.tables[s.table]
+	if !ok {
+		if s.ifExists {
+			return &result{}, nil
+		}
+		return nil, fmt.Errorf("table %q does not exist", s.table)
+	}
+	delete(db.tables, s.table)
+	undo.add(func(db *database) {
+		if _, ok := db.tables[s.table]; !ok {
+			db.tables[s.table] = t
+		}
+	})
+	return &result{}, nil
+}
+
+func (s *insertStmt) exec(db *database, undo *undoLog) (*result, error) {
+	t, err := db.table(s.table)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := make([]int, 0, len(t.columns))
+	if s.columns == nil {
+		for i := range t.columns {
+			idx = append(idx, i)
+		}
+	}
+	for _, c := range s.columns {
+		i, err := t.columnIndex(c)
+		if err != nil {
+			return nil, err
+		}
+		idx = append(idx, i)
+	}
+
+	var inserted [][]driver.Value
+	for _, values := range s.rows {
+		if len(values) != len(idx) {
+			return nil, fmt.Errorf("INSERT has %d values for %d columns", len(values), len(idx))
+		}
+
+		row := make([]driver.Value, len(t.columns))
+		set := make([]bool, len(t.columns))
+		for j, i := range idx {
+			if _, ok := values[j].(columnDefault); ok {
+				continue
+			}
+			row[i] = values[j]
+			set[i] = true
+		}
+		for i, c := range t.columns {
+			if !c.serial {
+				continue
+			}
+			if !set[i] {
+				t.seq[i]++
+				row[i] = t.seq[i]
+			} else if n, ok := row[i].(int64); ok && n > t.seq[i] {
+				t.seq[i] = n
+			}
+		}
+
+		t.rows = append(t.rows, row)
+		inserted = append(inserted, row)
+		undo.add(func(*database) { t.removeRow(row) })
+	}
+
+	return project(t, inserted, s.returning, int64(len(inserted)))
+}
+
+func (s *updateStmt) exec(db *database, undo *undoLog) (*result, error) {
+	t, err := db.table(s.table)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := make([]int, len(s.set))
+	for j, a := range s.set {
+		if idx[j], err = t.columnIndex(a.column); err != nil {
+			return nil, err
+		}
+	}
+
+	var updated [][]driver.Value
+	for _, row := range t.rows {
+		ok, err := match(t, row, s.where)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		row, old := row, append([]driver.Value(nil), row...)
+		undo.add(func(*database) { copy(row, old) })
+		for j, a := range s.set {
+			row[idx[j]] = a.value
+		}
+		updated = append(updated, row)
+	}
+
+	return project(t, updated, s.returning, int64(len(updated)))
+}
+
+func (s *deleteStmt) exec(db *database, undo *undoLog) (*result, error) {
+	t, err := db.table(s.table)
+	if err != nil {
+		return nil, err
+	}
+
+	var kept, deleted [][]driver.Value
+	for _, row := range t.rows {
+		ok, err := match(t, row, s.where)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			deleted = append(deleted, row)
+		} else {
+			kept = append(kept, row)
+		}
+	}
+	t.rows = kept
+	if len(deleted) > 0 {
+		undo.add(func(*database) { t.rows = append(t.rows, deleted...) })
+	}
+
+	return project(t, deleted, s.returning, int64(len(deleted)))
+}
+
+func (s *selectStmt) exec(db *database, undo *undoLog) (*result, error) {
+	t, err := db.table(s.table)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows [][]driver.Value
+	for _, row := range t.rows {
+		ok, err := match(t, row, s.where)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rows = append(rows, row)
+		}
+	}
+
+	if len(s.columns) == 1 && s.columns[0].count {
+		return &result{
+			columns: []string{s.columns[0].alias},
+			rows:    [][]driver.Value{{int64(len(rows))}},
+		}, nil
+	}
+
+	if len(s.orderBy) > 0 {
+		idx := make([]int, len(s.orderBy))
+		for j, o := range s.orderBy {
+			if idx[j], err = t.columnIndex(o.column); err != nil {
+				return nil, err
+			}
+		}
+		sort.SliceStable(rows, func(a, b int) bool {
+			for j, o := range s.orderBy {
+				c := compare(rows[a][idx[j]], rows[b][idx[j]])
+				if c == 0 {
+					continue
+				}
+				if o.desc {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+
+	if s.offset > 0 {
+		if s.offset >= len(rows) {
+			rows = nil
+		} else {
+			rows = rows[s.offset:]
+		}
+	}
+	if s.limit >= 0 && s.limit < len(rows) {
+		rows = rows[:s.limit]
+	}
+
+	return project(t, rows, s.columns, 0)
+}
+
+// project copies the requested columns out of rows. A nil column list
+// produces a result without rows.
+func project(t *table, rows [][]driver.Value, cols []selectColumn, affected int64) (*result, error) {
+	res := &result{affected: affected}
+	if cols == nil {
+		return res, nil
+	}
+
+	var idx []int
+	for _, c := range cols {
+		if c.star {
+			for i, tc := range t.columns {
+				idx = append(idx, i)
+				res.columns = append(res.columns, tc.name)
+			}
+			continue
+		}
+		if c.count {
+			return nil, fmt.Errorf("count(*) can't be combined with other columns")
+		}
+		i, err := t.columnIndex(c.name)
+		if err != nil {
+			return nil, err
+		}
+		idx = append(idx, i)
+		res.columns = append(res.columns, c.alias)
+	}
+
+	for _, row := range rows {
+		out := make([]driver.Value, len(idx))
+		for j, i := range idx {
+			out[j] = row[i]
+		}
+		res.rows = append(res.rows, out)
+	}
+
+	return res, nil
+}
+
+func match(t *table, row []driver.Value, conds []condition) (bool, error) {
+	for _, c := range conds {
+		i, err := t.columnIndex(c.column)
+		if err != nil {
+			return false, err
+		}
+		v := row[i]
+
+		switch c.op {
+		case "isnull":
+			if v != nil {
+				return false, nil
+			}
+		case "notnull":
+			if v == nil {
+				return false, nil
+			}
+		case "=":
+			if v == nil || c.value == nil || compare(v, c.value) != 0 {
+				return false, nil
+			}
+		case "any":
+			found, err := matchAny(v, c.value)
+			if err != nil || !found {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+func matchAny(v driver.Value, list driver.Value) (bool, error) {
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return false, fmt.Errorf("ANY expects an array argument, got %T", list)
+	}
+	if v == nil {
+		return false, nil
+	}
+	for i := 0; i < rv.Len(); i++ {
+		elem, err := driver.DefaultParameterConverter.ConvertValue(rv.Index(i).Interface())
+		if err != nil {
+			return false, err
+		}
+		if elem != nil && compare(v, elem) == 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// compare orders two values, NULLs sort last like in PostgreSQL.
+func compare(a, b driver.Value) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+
+	switch a := a.(type) {
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			switch {
+			case a.Before(b):
+				return -1
+			case a.After(b):
+				return 1
+			}
+			return 0
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0
+			case !a:
+				return -1
+			}
+			return 1
+		}
+	case []byte:
+		return bytes.Compare(a, toBytes(b))
+	}
+
+	return strings.Compare(fmt.Sprint(a), string(toBytes(b)))
+}
+
+func toFloat(v driver.Value) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func toBytes(v driver.Value) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return []byte(fmt.Sprint(v))
+}
@@ -0,0 +1,269 @@
+// Package fake is an in-memory database/sql driver for unit tests of simple
+// repository code.
+//
+// It understands a small SQL subset: CREATE/DROP TABLE, INSERT ... VALUES,
+// SELECT, UPDATE and DELETE with AND-ed equality, IS [NOT] NULL and
+// "= ANY($n)" conditions, ORDER BY, LIMIT/OFFSET, count(*) and RETURNING.
+// Transactions are serialized: Begin waits for the running one until its
+// context is done, or fails right away if the context can't be canceled.
+// Rollback undoes the changes of the transaction only.
+package fake
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type database struct {
+	mu     sync.Mutex
+	tables map[string]*table
+
+	// txSem serializes transactions, held from Begin to Commit/Rollback.
+	txSem chan struct{}
+}
+
+// New returns a handle to a fresh, empty in-memory database. Queries are
+// expected in PostgreSQL dialect ($1 placeholders).
+func New() *sqlx.DB {
+	c := &connector{db: &database{
+		tables: map[string]*table{},
+		txSem:  make(chan struct{}, 1),
+	}}
+	return sqlx.NewDb(sql.OpenDB(c), "postgres")
+}
+
+type connector struct {
+	db *database
+}
+
+func (c *connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{db: c.db}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("fake: use fake.New to create a database")
+}
+
+type conn struct {
+	db *database
+	tx *tx
+}
+
+var (
+	_ driver.QueryerContext     = (*conn)(nil)
+	_ driver.ExecerContext      = (*conn)(nil)
+	_ driver.ConnBeginTx        = (*conn)(nil)
+	_ driver.NamedValueChecker  = (*conn)(nil)
+	_ driver.ConnPrepareContext = (*conn)(nil)
+)
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+func (c *conn) PrepareContext(_ context.Context, query string) (driver.Stmt, error) {
+	return c.Prepare(query)
+}
+
+func (c *conn) Close() error {
+	if c.tx != nil {
+		return c.tx.Rollback()
+	}
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, _ driver.TxOptions) (driver.Tx, error) {
+	select {
+	case c.db.txSem <- struct{}{}:
+	default:
+		if ctx.Done() == nil {
+			return nil, errors.New("fake: another transaction is in progress")
+		}
+		select {
+		case c.db.txSem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("fake: wait for another transaction: %w", ctx.Err())
+		}
+	}
+
+	c.tx = &tx{conn: c}
+	return c.tx, nil
+}
+
+// CheckNamedValue passes slices through untouched so they can be used with
+// "= ANY($n)".
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	rv := reflect.ValueOf(nv.Value)
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+		return nil
+	}
+
+	v, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+	nv.Value = v
+	return nil
+}
+
+func (c *conn) run(query string, args []driver.NamedValue, script bool) (*result, error) {
+	toks, err := tokenize(query)
+	if err != nil {
+		return nil, fmt.Errorf("fake: %w", err)
+	}
+
+	stmts := splitStatements(toks)
+	if len(stmts) == 0 {
+		return &result{}, nil
+	}
+	if len(stmts) > 1 && !script {
+		return nil, errors.New("fake: multiple statements in a query")
+	}
+
+	parsed := make([]statement, 0, len(stmts))
+	for _, st := range stmts {
+		p := &parser{toks: st, args: args}
+		s, err := p.parse()
+		if err != nil {
+			return nil, fmt.Errorf("fake: %w", err)
+		}
+		parsed = append(parsed, s)
+	}
+
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	var undo *undoLog
+	if c.tx != nil {
+		undo = &c.tx.undo
+	}
+	res := &result{}
+	for _, s := range parsed {
+		r, err := s.exec(c.db, undo)
+		if err != nil {
+			return nil, fmt.Errorf("fake: %w", err)
+		}
+		res.affected += r.affected
+		res.columns, res.rows = r.columns, r.rows
+	}
+	return res, nil
+}
+
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res, err := c.run(query, args, len(args) == 0)
+	if err != nil {
+		return nil, err
+	}
+	return execResult(res.affected), nil
+}
+
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	res, err := c.run(query, args, false)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{res: res}, nil
+}
+
+type tx struct {
+	conn *conn
+	undo undoLog
+}
+
+func (t *tx) Commit() error {
+	return t.finish(false)
+}
+
+func (t *tx) Rollback() error {
+	return t.finish(true)
+}
+
+func (t *tx) finish(rollback bool) error {
+	if t.conn.tx != t {
+		return sql.ErrTxDone
+	}
+	t.conn.tx = nil
+
+	if rollback {
+		t.conn.db.mu.Lock()
+		t.undo.rollback(t.conn.db)
+		t.conn.db.mu.Unlock()
+	}
+	<-t.conn.db.txSem
+
+	return nil
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Close() error  { return nil }
+func (s *stmt) NumInput() int { return -1 }
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, namedValues(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, namedValues(args))
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	nv := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return nv
+}
+
+type execResult int64
+
+func (r execResult) LastInsertId() (int64, error) {
+	return 0, errors.New("fake: LastInsertId is not supported, use RETURNING")
+}
+
+func (r execResult) RowsAffected() (int64, error) {
+	return int64(r), nil
+}
+
+type rows struct {
+	res *result
+	pos int
+}
+
+func (r *rows) Columns() []string {
+	return r.res.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.res.rows) {
+		return io.EOF
+	}
+	copy(dest, r.res.rows[r.pos])
+	r.pos++
+	return nil
+}
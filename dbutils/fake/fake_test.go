@@ -0,0 +1,154 @@
+package fake_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"db-example/dbutils/fake"
+)
+
+func newDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db := fake.New()
+	t.Cleanup(func() { db.Close() })
+	db.MustExec(`CREATE TABLE users (id bigserial, name text, team text)`)
+	for _, u := range []struct{ name, team interface{} }{
+		{"carol", "b"},
+		{"alice", "a"},
+		{"dave", nil},
+		{"bob", "a"},
+	} {
+		db.MustExec(`INSERT INTO users (name, team) VALUES ($1, $2)`, u.name, u.team)
+	}
+	return db
+}
+
+func names(t *testing.T, db sqlx.Queryer, query string, args ...interface{}) []string {
+	t.Helper()
+	var ret []string
+	if err := sqlx.Select(db, &ret, query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return ret
+}
+
+func TestSelect(t *testing.T) {
+	db := newDB(t)
+
+	for _, tc := range []struct {
+		name  string
+		query string
+		args  []interface{}
+		want  []string
+	}{
+		{"all", `SELECT name FROM users ORDER BY id`, nil, []string{"carol", "alice", "dave", "bob"}},
+		{"eq", `SELECT name FROM users WHERE team = $1 ORDER BY name`, []interface{}{"a"}, []string{"alice", "bob"}},
+		{"eq literal", `SELECT name FROM users WHERE team = 'b'`, nil, []string{"carol"}},
+		{"eq null", `SELECT name FROM users WHERE team = $1`, []interface{}{nil}, nil},
+		{"is null", `SELECT name FROM users WHERE team IS NULL`, nil, []string{"dave"}},
+		{"is not null", `SELECT name FROM users WHERE team IS NOT NULL ORDER BY name`, nil, []string{"alice", "bob", "carol"}},
+		{"and", `SELECT name FROM users WHERE team = $1 AND name = $2`, []interface{}{"a", "bob"}, []string{"bob"}},
+		{"any", `SELECT name FROM users WHERE id = ANY($1) ORDER BY id`, []interface{}{[]int64{2, 4, 9}}, []string{"alice", "bob"}},
+		{"order desc", `SELECT name FROM users ORDER BY name DESC`, nil, []string{"dave", "carol", "bob", "alice"}},
+		{"order nulls last", `SELECT name FROM users ORDER BY team, name`, nil, []string{"alice", "bob", "carol", "dave"}},
+		{"order desc nulls first", `SELECT name FROM users ORDER BY team DESC, name ASC`, nil, []string{"dave", "carol", "alice", "bob"}},
+		{"limit", `SELECT name FROM users ORDER BY id LIMIT 2`, nil, []string{"carol", "alice"}},
+		{"limit param", `SELECT name FROM users ORDER BY id LIMIT $1`, []interface{}{1}, []string{"carol"}},
+		{"offset", `SELECT name FROM users ORDER BY id LIMIT 2 OFFSET 1`, nil, []string{"alice", "dave"}},
+		{"offset past end", `SELECT name FROM users ORDER BY id OFFSET 10`, nil, nil},
+		{"limit zero", `SELECT name FROM users LIMIT 0`, nil, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := names(t, db, tc.query, tc.args...); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSelectUnsupported(t *testing.T) {
+	db := newDB(t)
+
+	for _, query := range []string{
+		`SELECT name FROM users WHERE id > 1`,
+		`SELECT name FROM users WHERE team = 'a' OR team = 'b'`,
+		`SELECT name FROM users ORDER BY nope`,
+		`SELECT name FROM users; SELECT id FROM users`,
+	} {
+		var got []string
+		if err := db.Select(&got, query); err == nil {
+			t.Errorf("%s: got %q, want an error", query, got)
+		}
+	}
+}
+
+func TestRollback(t *testing.T) {
+	db := newDB(t)
+	ctx := context.Background()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.MustExec(`INSERT INTO users (name, team) VALUES ('erin', 'c')`)
+	tx.MustExec(`UPDATE users SET team = 'c' WHERE name = 'alice'`)
+	tx.MustExec(`DELETE FROM users WHERE name = 'bob'`)
+	tx.MustExec(`CREATE TABLE tmp (id bigint)`)
+
+	// Written outside of the transaction, kept by the rollback.
+	db.MustExec(`INSERT INTO users (name, team) VALUES ('frank', 'a')`)
+	db.MustExec(`UPDATE users SET team = 'b' WHERE name = 'dave'`)
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"carol": "b", "alice": "a", "dave": "b", "bob": "a", "frank": "a"}
+	var rows []struct{ Name, Team string }
+	if err := db.Select(&rows, `SELECT name, team FROM users`); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string, len(rows))
+	for _, r := range rows {
+		got[r.Name] = r.Team
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := db.Exec(`SELECT id FROM tmp`); err == nil {
+		t.Error("table created in the transaction survived the rollback")
+	}
+}
+
+func TestConcurrentBegin(t *testing.T) {
+	db := newDB(t)
+
+	tx, err := db.BeginTxx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := db.BeginTxx(context.Background(), nil); err == nil {
+		t.Error("second Begin without a deadline succeeded")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := db.BeginTxx(ctx, nil); err == nil {
+		t.Error("second Begin before the deadline succeeded")
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	tx2, err := db.BeginTxx(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Begin after Commit: %v", err)
+	}
+	tx2.Rollback()
+}
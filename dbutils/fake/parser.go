@@ -0,0 +1,626 @@
+package fake
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tkEOF tokenKind = iota
+	tkIdent
+	tkQuotedIdent
+	tkString
+	tkNumber
+	tkParam
+	tkSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(query string) ([]token, error) {
+	var toks []token
+	rs := []rune(query)
+
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i+1 < len(rs) && rs[i+1] == '-':
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+		case r == '\'' || r == '"':
+			var buf strings.Builder
+			j := i + 1
+			for ; j < len(rs); j++ {
+				if rs[j] == r {
+					if j+1 < len(rs) && rs[j+1] == r {
+						buf.WriteRune(r)
+						j++
+						continue
+					}
+					break
+				}
+				buf.WriteRune(rs[j])
+			}
+			if j >= len(rs) {
+				return nil, fmt.Errorf("unterminated quote at offset %d", i)
+			}
+			kind := tkString
+			if r == '"' {
+				kind = tkQuotedIdent
+			}
+			toks = append(toks, token{kind: kind, text: buf.String()})
+			i = j + 1
+		case r == '$' || r == '?':
+			j := i + 1
+			for j < len(rs) && unicode.IsDigit(rs[j]) {
+				j++
+			}
+			toks = append(toks, token{kind: tkParam, text: string(rs[i:j])})
+			i = j
+		case unicode.IsDigit(r):
+			j := i
+			for j < len(rs) && (unicode.IsDigit(rs[j]) || rs[j] == '.') {
+				j++
+			}
+			toks = append(toks, token{kind: tkNumber, text: string(rs[i:j])})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_') {
+				j++
+			}
+			toks = append(toks, token{kind: tkIdent, text: strings.ToLower(string(rs[i:j]))})
+			i = j
+		default:
+			j := i + 1
+			if j < len(rs) && strings.ContainsRune("<>!:", r) && strings.ContainsRune("=>:", rs[j]) {
+				j++
+			}
+			toks = append(toks, token{kind: tkSymbol, text: string(rs[i:j])})
+			i = j
+		}
+	}
+
+	return append(toks, token{kind: tkEOF}), nil
+}
+
+// splitStatements splits a script on semicolons outside of quotes.
+func splitStatements(toks []token) [][]token {
+	var stmts [][]token
+	start := 0
+	for i, t := range toks {
+		if (t.kind == tkSymbol && t.text == ";") || t.kind == tkEOF {
+			if i > start {
+				stmt := append(append([]token{}, toks[start:i]...), token{kind: tkEOF})
+				stmts = append(stmts, stmt)
+			}
+			start = i + 1
+		}
+	}
+	return stmts
+}
+
+type parser struct {
+	toks []token
+	pos  int
+	args []driver.NamedValue
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tkEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tkIdent && t.text == kw
+}
+
+func (p *parser) acceptKeyword(kws ...string) bool {
+	save := p.pos
+	for _, kw := range kws {
+		if !p.isKeyword(kw) {
+			p.pos = save
+			return false
+		}
+		p.next()
+	}
+	return true
+}
+
+func (p *parser) expectKeyword(kws ...string) error {
+	if !p.acceptKeyword(kws...) {
+		return fmt.Errorf("expected %s near %q", strings.ToUpper(strings.Join(kws, " ")), p.peek().text)
+	}
+	return nil
+}
+
+func (p *parser) acceptSymbol(s string) bool {
+	t := p.peek()
+	if t.kind == tkSymbol && t.text == s {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectSymbol(s string) error {
+	if !p.acceptSymbol(s) {
+		return fmt.Errorf("expected %q near %q", s, p.peek().text)
+	}
+	return nil
+}
+
+// ident reads a possibly qualified name and returns its last part.
+func (p *parser) ident() (string, error) {
+	var name string
+	for {
+		t := p.next()
+		if t.kind != tkIdent && t.kind != tkQuotedIdent {
+			return "", fmt.Errorf("expected identifier near %q", t.text)
+		}
+		name = t.text
+		if !p.acceptSymbol(".") {
+			return name, nil
+		}
+	}
+}
+
+func (p *parser) value() (driver.Value, error) {
+	t := p.next()
+	switch t.kind {
+	case tkString:
+		return t.text, nil
+	case tkNumber:
+		if strings.Contains(t.text, ".") {
+			return strconv.ParseFloat(t.text, 64)
+		}
+		return strconv.ParseInt(t.text, 10, 64)
+	case tkParam:
+		n := len(p.args) + 1
+		if t.text != "?" {
+			var err error
+			if n, err = strconv.Atoi(t.text[1:]); err != nil {
+				return nil, fmt.Errorf("bad placeholder %q", t.text)
+			}
+		} else {
+			n = p.paramIndex()
+		}
+		if n < 1 || n > len(p.args) {
+			return nil, fmt.Errorf("placeholder %s has no argument", t.text)
+		}
+		return p.args[n-1].Value, nil
+	case tkSymbol:
+		if t.text == "-" {
+			v, err := p.value()
+			switch v := v.(type) {
+			case int64:
+				return -v, err
+			case float64:
+				return -v, err
+			}
+			return nil, fmt.Errorf("bad negative value")
+		}
+	case tkIdent:
+		switch t.text {
+		case "null":
+			return nil, nil
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported value %q", t.text)
+}
+
+// paramIndex numbers "?" placeholders in order of appearance.
+func (p *parser) paramIndex() int {
+	n := 0
+	for _, t := range p.toks[:p.pos] {
+		if t.kind == tkParam && t.text == "?" {
+			n++
+		}
+	}
+	return n
+}
+
+func (p *parser) skipCast() error {
+	if p.acceptSymbol("::") {
+		_, err := p.ident()
+		return err
+	}
+	return nil
+}
+
+func (p *parser) parse() (statement, error) {
+	var (
+		st  statement
+		err error
+	)
+	switch {
+	case p.acceptKeyword("select"):
+		st, err = p.parseSelect()
+	case p.acceptKeyword("insert", "into"):
+		st, err = p.parseInsert()
+	case p.acceptKeyword("update"):
+		st, err = p.parseUpdate()
+	case p.acceptKeyword("delete", "from"):
+		st, err = p.parseDelete()
+	case p.acceptKeyword("create", "table"):
+		st, err = p.parseCreate()
+	case p.acceptKeyword("drop", "table"):
+		st, err = p.parseDrop()
+	default:
+		return nil, fmt.Errorf("unsupported statement near %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tkEOF {
+		return nil, fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	return st, nil
+}
+
+func (p *parser) parseColumns() ([]selectColumn, error) {
+	var cols []selectColumn
+	for {
+		var c selectColumn
+		switch {
+		case p.acceptSymbol("*"):
+			c.star = true
+		case p.isKeyword("count"):
+			p.next()
+			if err := p.expectSymbol("("); err != nil {
+				return nil, err
+			}
+			if !p.acceptSymbol("*") {
+				if _, err := p.ident(); err != nil {
+					return nil, err
+				}
+			}
+			if err := p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			c.count = true
+			c.alias = "count"
+		default:
+			name, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			c.name, c.alias = name, name
+		}
+		if p.acceptKeyword("as") {
+			alias, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			c.alias = alias
+		}
+		cols = append(cols, c)
+		if !p.acceptSymbol(",") {
+			return cols, nil
+		}
+	}
+}
+
+func (p *parser) parseWhere() ([]condition, error) {
+	if !p.acceptKeyword("where") {
+		return nil, nil
+	}
+
+	var conds []condition
+	for {
+		col, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		c := condition{column: col}
+		switch {
+		case p.acceptKeyword("is", "not", "null"):
+			c.op = "notnull"
+		case p.acceptKeyword("is", "null"):
+			c.op = "isnull"
+		case p.acceptSymbol("="):
+			if p.acceptKeyword("any") {
+				c.op = "any"
+				if err := p.expectSymbol("("); err != nil {
+					return nil, err
+				}
+				if c.value, err = p.value(); err != nil {
+					return nil, err
+				}
+				if err := p.skipCast(); err != nil {
+					return nil, err
+				}
+				if err := p.expectSymbol(")"); err != nil {
+					return nil, err
+				}
+			} else {
+				c.op = "="
+				if c.value, err = p.value(); err != nil {
+					return nil, err
+				}
+				if err := p.skipCast(); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unsupported condition near %q", p.peek().text)
+		}
+		conds = append(conds, c)
+		if !p.acceptKeyword("and") {
+			return conds, nil
+		}
+	}
+}
+
+func (p *parser) parseCount() (int, error) {
+	v, err := p.value()
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("expected integer, got %v", v)
+	}
+	return int(n), nil
+}
+
+func (p *parser) parseSelect() (statement, error) {
+	cols, err := p.parseColumns()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+
+	st := &selectStmt{columns: cols, limit: -1}
+	if st.table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if st.where, err = p.parseWhere(); err != nil {
+		return nil, err
+	}
+
+	if p.acceptKeyword("order", "by") {
+		for {
+			var o orderBy
+			if o.column, err = p.ident(); err != nil {
+				return nil, err
+			}
+			if p.acceptKeyword("desc") {
+				o.desc = true
+			} else {
+				p.acceptKeyword("asc")
+			}
+			st.orderBy = append(st.orderBy, o)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("limit") {
+		if st.limit, err = p.parseCount(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("offset") {
+		if st.offset, err = p.parseCount(); err != nil {
+			return nil, err
+		}
+	}
+
+	return st, nil
+}
+
+func (p *parser) parseReturning() ([]selectColumn, error) {
+	if !p.acceptKeyword("returning") {
+		return nil, nil
+	}
+	return p.parseColumns()
+}
+
+func (p *parser) parseInsert() (statement, error) {
+	st := &insertStmt{}
+	var err error
+	if st.table, err = p.ident(); err != nil {
+		return nil, err
+	}
+
+	if p.acceptSymbol("(") {
+		for {
+			col, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			st.columns = append(st.columns, col)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.expectKeyword("values"); err != nil {
+		return nil, err
+	}
+	for {
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		var row []driver.Value
+		for {
+			if p.acceptKeyword("default") {
+				row = append(row, columnDefault{})
+				if !p.acceptSymbol(",") {
+					break
+				}
+				continue
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.skipCast(); err != nil {
+				return nil, err
+			}
+			row = append(row, v)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		st.rows = append(st.rows, row)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+
+	st.returning, err = p.parseReturning()
+	return st, err
+}
+
+func (p *parser) parseUpdate() (statement, error) {
+	st := &updateStmt{}
+	var err error
+	if st.table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("set"); err != nil {
+		return nil, err
+	}
+	for {
+		var a assignment
+		if a.column, err = p.ident(); err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol("="); err != nil {
+			return nil, err
+		}
+		if a.value, err = p.value(); err != nil {
+			return nil, err
+		}
+		if err := p.skipCast(); err != nil {
+			return nil, err
+		}
+		st.set = append(st.set, a)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if st.where, err = p.parseWhere(); err != nil {
+		return nil, err
+	}
+	st.returning, err = p.parseReturning()
+	return st, err
+}
+
+func (p *parser) parseDelete() (statement, error) {
+	st := &deleteStmt{}
+	var err error
+	if st.table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if st.where, err = p.parseWhere(); err != nil {
+		return nil, err
+	}
+	st.returning, err = p.parseReturning()
+	return st, err
+}
+
+var constraintKeywords = map[string]bool{
+	"primary": true, "unique": true, "constraint": true, "foreign": true, "check": true,
+}
+
+func (p *parser) parseCreate() (statement, error) {
+	st := &createStmt{}
+	st.ifNotExists = p.acceptKeyword("if", "not", "exists")
+
+	var err error
+	if st.table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		isConstraint := t.kind == tkIdent && constraintKeywords[t.text]
+
+		var col column
+		if !isConstraint {
+			if col.name, err = p.ident(); err != nil {
+				return nil, err
+			}
+		}
+
+		// Skip the type and constraints up to the next top-level comma.
+		depth := 0
+		for {
+			t := p.peek()
+			if t.kind == tkEOF {
+				return nil, fmt.Errorf("unterminated CREATE TABLE")
+			}
+			if t.kind == tkSymbol && depth == 0 && (t.text == "," || t.text == ")") {
+				break
+			}
+			if t.kind == tkSymbol && t.text == "(" {
+				depth++
+			}
+			if t.kind == tkSymbol && t.text == ")" {
+				depth--
+			}
+			if t.kind == tkIdent && strings.Contains(t.text, "serial") {
+				col.serial = true
+			}
+			p.next()
+		}
+
+		if !isConstraint {
+			st.columns = append(st.columns, col)
+		}
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+
+	return st, p.expectSymbol(")")
+}
+
+func (p *parser) parseDrop() (statement, error) {
+	st := &dropStmt{}
+	st.ifExists = p.acceptKeyword("if", "exists")
+
+	var err error
+	st.table, err = p.ident()
+	p.acceptKeyword("cascade")
+	return st, err
+}
@@ -0,0 +1,138 @@
+package dbutils
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var placeholderRe = regexp.MustCompile(`\$[0-9]+`)
+
+// stripQuotedIdents removes well-formed "..." identifiers and reports
+// whether the quoting was balanced.
+func stripQuotedIdents(query string) (string, bool) {
+	var buf strings.Builder
+	for i := 0; i < len(query); i++ {
+		if query[i] != '"' {
+			buf.WriteByte(query[i])
+			continue
+		}
+		closed := false
+		for i++; i < len(query); i++ {
+			if query[i] == '"' {
+				if i+1 < len(query) && query[i+1] == '"' {
+					i++
+					continue
+				}
+				closed = true
+				break
+			}
+		}
+		if !closed {
+			return "", false
+		}
+		buf.WriteString("ident")
+	}
+	return buf.String(), true
+}
+
+func checkParameterized(t *testing.T, query string, args []interface{}) {
+	t.Helper()
+
+	rest, ok := stripQuotedIdents(query)
+	if !ok {
+		t.Fatalf("unbalanced identifier quoting in %q", query)
+	}
+	for _, bad := range []string{"'", ";", "--", "/*", "\x00"} {
+		if strings.Contains(rest, bad) {
+			t.Fatalf("%q outside of quoted identifiers in %q", bad, query)
+		}
+	}
+	if n := len(placeholderRe.FindAllString(rest, -1)); n != len(args) {
+		t.Fatalf("%d placeholders for %d args in %q", n, len(args), query)
+	}
+}
+
+func FuzzQuoteIdent(f *testing.F) {
+	for _, s := range []string{"users", "public.users", `we"ird`, "", ".", "a..b", "x\x00y"} {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, name string) {
+		quoted, err := QuoteIdent(name)
+		if err != nil {
+			return
+		}
+
+		parts := strings.Split(name, ".")
+		var unquoted []string
+		rest := quoted
+		for range parts {
+			if !strings.HasPrefix(rest, `"`) {
+				t.Fatalf("part not quoted in %q", quoted)
+			}
+			end := 1
+			for ; end < len(rest); end++ {
+				if rest[end] == '"' {
+					if end+1 < len(rest) && rest[end+1] == '"' {
+						end++
+						continue
+					}
+					break
+				}
+			}
+			unquoted = append(unquoted, strings.ReplaceAll(rest[1:end], `""`, `"`))
+			rest = strings.TrimPrefix(rest[end+1:], ".")
+		}
+		if got := strings.Join(unquoted, "."); got != name || rest != "" {
+			t.Fatalf("QuoteIdent(%q) = %q does not round-trip", name, quoted)
+		}
+	})
+}
+
+func FuzzSelectBuilder(f *testing.F) {
+	f.Add("users", "login", "ivanov", 10)
+	f.Add(`t"; DROP TABLE x; --`, "a.b", "' OR 1=1 --", -1)
+	f.Add("", "", "", 0)
+
+	f.Fuzz(func(t *testing.T, table, column, value string, limit int) {
+		query, args, err := NewSelect(table, column).
+			Where(Eq(column, value), Filter(map[string]interface{}{column: value, "id": limit})).
+			Where(RangeContains(column, int32(limit))).
+			OrderBy(column).
+			Limit(limit).
+			Build()
+		if err != nil {
+			if _, qerr := QuoteIdent(table); qerr == nil {
+				if _, qerr := QuoteIdent(column); qerr == nil {
+					t.Fatalf("valid identifiers rejected: %v", err)
+				}
+			}
+			return
+		}
+
+		checkParameterized(t, query, args)
+	})
+}
+
+func FuzzNamedQuery(f *testing.F) {
+	f.Add("SELECT * FROM users WHERE login = :login", "login", "ivanov")
+	f.Add("UPDATE t SET a = :a WHERE b = ':a'", "a", "'; DROP TABLE t; --")
+
+	f.Fuzz(func(t *testing.T, query, name, value string) {
+		nq, args, err := namedQuery(context.Background(), query, map[string]interface{}{name: value})
+		if err != nil {
+			return
+		}
+
+		for _, a := range args {
+			if a != value {
+				t.Fatalf("unexpected arg %#v", a)
+			}
+		}
+		if value != "" && !strings.ContainsAny(value, "?:") && strings.Count(nq, value) > strings.Count(query, value) {
+			t.Fatalf("value %q inlined into %q", value, nq)
+		}
+	})
+}
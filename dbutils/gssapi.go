@@ -0,0 +1,157 @@
+package dbutils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+// Kerberos configures GSSAPI authentication. The server must have a
+// "hostgssenc"/"host ... gss" rule in pg_hba.conf for the user.
+type Kerberos struct {
+	// Principal is the client principal, e.g. "app@CORP.EXAMPLE.COM". It's
+	// required with Keytab and ignored with a credential cache.
+	Principal string
+	// Keytab is the path to a keytab with the Principal's keys. When empty,
+	// the credential cache is used.
+	Keytab string
+	// CCache is the path to the credential cache, $KRB5CCNAME by default.
+	CCache string
+	// Krb5Conf is the path to krb5.conf, $KRB5_CONFIG or /etc/krb5.conf by
+	// default.
+	Krb5Conf string
+
+	// ServiceName is the service part of the server principal, "postgres"
+	// by default. The host part is the host being connected to.
+	ServiceName string
+	// SPN overrides the whole server principal, e.g.
+	// "postgres/db.corp.example.com@CORP.EXAMPLE.COM".
+	SPN string
+}
+
+// gssProvider shares one logged in Kerberos client between connections.
+type gssProvider struct {
+	cfg Kerberos
+
+	mu  sync.Mutex
+	cli *client.Client
+}
+
+// registerGSS installs k as the pgx GSS provider. pgx only supports one
+// provider per process, so all databases opened with Kerberos share the
+// credentials of the last one.
+func registerGSS(k Kerberos) {
+	p := &gssProvider{cfg: k}
+	pgconn.RegisterGSSProvider(func() (pgconn.GSS, error) {
+		cli, err := p.client()
+		if err != nil {
+			return nil, err
+		}
+		return &gss{cli: cli}, nil
+	})
+}
+
+func (p *gssProvider) client() (*client.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cli != nil {
+		return p.cli, nil
+	}
+
+	cli, err := p.cfg.newClient()
+	if err != nil {
+		return nil, fmt.Errorf("kerberos: %w", err)
+	}
+	if err := cli.Login(); err != nil {
+		return nil, fmt.Errorf("kerberos login: %w", err)
+	}
+
+	p.cli = cli
+	return cli, nil
+}
+
+func (k Kerberos) newClient() (*client.Client, error) {
+	confPath := k.Krb5Conf
+	if confPath == "" {
+		confPath = os.Getenv("KRB5_CONFIG")
+	}
+	if confPath == "" {
+		confPath = "/etc/krb5.conf"
+	}
+	conf, err := config.Load(confPath)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", confPath, err)
+	}
+
+	if k.Keytab != "" {
+		user, realm, ok := strings.Cut(k.Principal, "@")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("principal %q must be user@REALM", k.Principal)
+		}
+		kt, err := keytab.Load(k.Keytab)
+		if err != nil {
+			return nil, fmt.Errorf("load keytab: %w", err)
+		}
+		return client.NewWithKeytab(user, realm, kt, conf, client.DisablePAFXFAST(true)), nil
+	}
+
+	ccPath := k.CCache
+	if ccPath == "" {
+		ccPath = os.Getenv("KRB5CCNAME")
+	}
+	ccPath = strings.TrimPrefix(ccPath, "FILE:")
+	if ccPath == "" {
+		ccPath = fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid())
+	}
+	cc, err := credentials.LoadCCache(ccPath)
+	if err != nil {
+		return nil, fmt.Errorf("load credential cache: %w", err)
+	}
+	return client.NewFromCCache(cc, conf, client.DisablePAFXFAST(true))
+}
+
+// gss implements pgconn.GSS for a single authentication exchange.
+type gss struct {
+	cli *client.Client
+}
+
+func (g *gss) GetInitToken(host string, service string) ([]byte, error) {
+	return g.GetInitTokenFromSPN(service + "/" + host)
+}
+
+func (g *gss) GetInitTokenFromSPN(spn string) ([]byte, error) {
+	tkt, key, err := g.cli.GetServiceTicket(spn)
+	if err != nil {
+		return nil, fmt.Errorf("kerberos service ticket for %s: %w", spn, err)
+	}
+
+	token, err := spnego.NewKRB5TokenAPREQ(g.cli, tkt, key,
+		[]int{gssapi.ContextFlagInteg}, []int{flags.APOptionMutualRequired})
+	if err != nil {
+		return nil, err
+	}
+	return token.Marshal()
+}
+
+func (g *gss) Continue(inToken []byte) (done bool, outToken []byte, err error) {
+	var token spnego.KRB5Token
+	if err := token.Unmarshal(inToken); err != nil {
+		return true, nil, err
+	}
+	if !token.IsAPRep() {
+		return true, nil, errors.New("kerberos: server rejected the authentication")
+	}
+	return true, nil, nil
+}
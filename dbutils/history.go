@@ -0,0 +1,183 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateHistory creates the table <table>_history keeping every version of
+// the rows of table, with the period each version was current in the
+// columns valid_from and valid_to, and a trigger maintaining it. The key
+// columns, "id" if none, identify a row across versions. Existing rows get
+// valid_from -infinity. Calling it again adds columns added to table since,
+// columns dropped from table must be dropped from the history table too.
+func CreateHistory(ctx context.Context, db TxStarter, table string, key ...string) error {
+	if len(key) == 0 {
+		key = []string{"id"}
+	}
+
+	t, err := QuoteIdent(table)
+	if err != nil {
+		return fmt.Errorf("create history of %s: %w", table, err)
+	}
+	h, _ := QuoteIdent(table + "_history")
+	fn, _ := QuoteIdent(table + "_history_trigger")
+	keyCond := make([]string, len(key))
+	keyCols := make([]string, len(key))
+	for i, k := range key {
+		if keyCols[i], err = QuoteIdent(k); err != nil {
+			return fmt.Errorf("create history of %s: %w", table, err)
+		}
+		keyCond[i] = keyCols[i] + " = OLD." + keyCols[i]
+	}
+
+	err = RunTx(ctx, db, func(tx *sqlx.Tx) error {
+		// No writes between copying the rows and creating the trigger.
+		if _, err := Exec(ctx, tx, `LOCK TABLE `+t+` IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+			return err
+		}
+
+		var exists bool
+		if err := Get(ctx, tx, &exists, `SELECT to_regclass($1) IS NOT NULL`, h); err != nil {
+			return err
+		}
+		if !exists {
+			// The period goes first, so that columns added to table later
+			// are appended to both tables in the same order.
+			stmts := []string{
+				`CREATE TABLE ` + h + ` (valid_from timestamptz NOT NULL, valid_to timestamptz NOT NULL, LIKE ` + t + `)`,
+				`CREATE INDEX ON ` + h + ` (` + strings.Join(keyCols, ", ") + `, valid_from)`,
+				`INSERT INTO ` + h + ` SELECT '-infinity', 'infinity', t.* FROM ` + t + ` t`,
+			}
+			for _, q := range stmts {
+				if _, err := Exec(ctx, tx, q); err != nil {
+					return err
+				}
+			}
+		} else if err := addHistoryColumns(ctx, tx, t, h); err != nil {
+			return err
+		}
+
+		stmts := []string{
+			`CREATE OR REPLACE FUNCTION ` + fn + `() RETURNS trigger LANGUAGE plpgsql AS $fn$
+			BEGIN
+				IF TG_OP IN ('UPDATE', 'DELETE') THEN
+					UPDATE ` + h + ` SET valid_to = now()
+						WHERE valid_to = 'infinity' AND ` + strings.Join(keyCond, " AND ") + `;
+				END IF;
+				IF TG_OP IN ('INSERT', 'UPDATE') THEN
+					INSERT INTO ` + h + ` SELECT now(), 'infinity', NEW.*;
+				END IF;
+				RETURN NULL;
+			END
+			$fn$`,
+			`DROP TRIGGER IF EXISTS history ON ` + t,
+			`CREATE TRIGGER history AFTER INSERT OR UPDATE OR DELETE ON ` + t + `
+				FOR EACH ROW EXECUTE FUNCTION ` + fn + `()`,
+		}
+		for _, q := range stmts {
+			if _, err := Exec(ctx, tx, q); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("create history of %s: %w", table, err)
+	}
+	return nil
+}
+
+// addHistoryColumns adds the columns of t missing in h.
+func addHistoryColumns(ctx context.Context, tx *sqlx.Tx, t, h string) error {
+	var cols []struct {
+		Name string `db:"attname"`
+		Type string `db:"type"`
+	}
+	q := `SELECT a.attname, format_type(a.atttypid, a.atttypmod) AS type
+		FROM pg_attribute a
+		WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+			AND NOT EXISTS (SELECT 1 FROM pg_attribute h
+				WHERE h.attrelid = $2::regclass AND h.attname = a.attname AND NOT h.attisdropped)
+		ORDER BY a.attnum`
+	if err := Select(ctx, tx, &cols, q, t, h); err != nil {
+		return err
+	}
+
+	for _, c := range cols {
+		name, err := QuoteIdent(c.Name)
+		if err != nil {
+			return err
+		}
+		if _, err := Exec(ctx, tx, `ALTER TABLE `+h+` ADD COLUMN `+name+` `+c.Type); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DropHistory removes the trigger and the history table of table.
+func DropHistory(ctx context.Context, db TxStarter, table string) error {
+	t, err := QuoteIdent(table)
+	if err != nil {
+		return fmt.Errorf("drop history of %s: %w", table, err)
+	}
+	h, _ := QuoteIdent(table + "_history")
+	fn, _ := QuoteIdent(table + "_history_trigger")
+
+	err = RunTx(ctx, db, func(tx *sqlx.Tx) error {
+		for _, q := range []string{
+			`DROP TRIGGER IF EXISTS history ON ` + t,
+			`DROP FUNCTION IF EXISTS ` + fn + `()`,
+			`DROP TABLE IF EXISTS ` + h,
+		} {
+			if _, err := Exec(ctx, tx, q); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("drop history of %s: %w", table, err)
+	}
+	return nil
+}
+
+// AsOf selects into dest, a pointer to a slice, the rows of table matching
+// where, nil for all, as they were at t. dest may have fields for
+// valid_from and valid_to, the columns are skipped otherwise. The history
+// is kept by the transaction times of the changes, so changes made by a
+// transaction appear at its start.
+func AsOf(ctx context.Context, db Queryer, table string, t time.Time, dest interface{}, where Cond) error {
+	b := NewSelect(table + "_history").Where(Raw("valid_from <= ? AND valid_to > ?", t, t))
+	if where != nil {
+		b.Where(where)
+	}
+	q, args, err := b.Build()
+	if err != nil {
+		return fmt.Errorf("history of %s as of %s: %w", table, t, err)
+	}
+
+	if mappingMode(ctx) == MappingStrict {
+		ctx = WithMappingMode(ctx, MappingIgnore)
+	}
+	return Select(ctx, db, dest, q, args...)
+}
+
+// PruneHistory deletes the versions of rows of table that stopped being
+// current before t, and returns how many were deleted.
+func PruneHistory(ctx context.Context, db Execer, table string, before time.Time) (int64, error) {
+	h, err := QuoteIdent(table + "_history")
+	if err != nil {
+		return 0, fmt.Errorf("prune history of %s: %w", table, err)
+	}
+	res, err := Exec(ctx, db, `DELETE FROM `+h+` WHERE valid_to < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,166 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// maxParams is the limit of bind parameters of a PostgreSQL statement.
+const maxParams = 65535
+
+// InsertOptions tune InsertMany.
+type InsertOptions struct {
+	// ReturningIDs appends RETURNING id and writes the generated IDs back
+	// into the id fields of the rows.
+	ReturningIDs bool
+}
+
+// InsertMany inserts rows, structs or pointers to them, into table with
+// multi-row INSERTs of as many rows as the parameter limit allows. The
+// columns are the db tags of the fields; a zero id field is left to the
+// column default, so serial IDs are generated. Run it in a transaction to
+// insert all or nothing when rows don't fit in one statement.
+func InsertMany[T any](ctx context.Context, db sqlx.ExtContext, table string, rows []T, opts InsertOptions) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	qt, err := QuoteIdent(table)
+	if err != nil {
+		return fmt.Errorf("insert into %s: %w", table, err)
+	}
+
+	st := structType(reflect.TypeOf((*T)(nil)).Elem())
+	if st == nil {
+		return fmt.Errorf("insert %T: not a struct", rows[0])
+	}
+	fields := insertFields(st)
+	if len(fields) == 0 {
+		return fmt.Errorf("insert %T: no fields with db tags", rows[0])
+	}
+	id := -1
+	for i, f := range fields {
+		if f.Name == "id" {
+			id = i
+		}
+	}
+	if opts.ReturningIDs && id < 0 {
+		return fmt.Errorf("insert %T: no field for the id column", rows[0])
+	}
+
+	cols := make([]string, len(fields))
+	for i, f := range fields {
+		if cols[i], err = QuoteIdent(f.Name); err != nil {
+			return fmt.Errorf("insert into %s: %w", table, err)
+		}
+	}
+	prefix := `INSERT INTO ` + qt + ` (` + strings.Join(cols, ", ") + `) VALUES `
+
+	batch := maxParams / len(fields)
+	for start := 0; start < len(rows); start += batch {
+		end := start + batch
+		if end > len(rows) {
+			end = len(rows)
+		}
+		if err := insertBatch(ctx, db, prefix, fields, id, rows[start:end], opts); err != nil {
+			return err
+		}
+	}
+	analyzeAfterLoad(ctx, db, table, int64(len(rows)))
+	return nil
+}
+
+func insertBatch[T any](ctx context.Context, db sqlx.ExtContext, prefix string, fields []*reflectx.FieldInfo, id int, rows []T, opts InsertOptions) error {
+	var (
+		query strings.Builder
+		args  []interface{}
+	)
+	query.WriteString(prefix)
+	for i, row := range rows {
+		enc, err := EncryptFields(ctx, row)
+		if err != nil {
+			return err
+		}
+		v := reflect.Indirect(reflect.ValueOf(enc))
+		if !v.IsValid() {
+			return fmt.Errorf("insert: row %d is nil", i)
+		}
+
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteByte('(')
+		for j, f := range fields {
+			if j > 0 {
+				query.WriteString(", ")
+			}
+			fv := reflectx.FieldByIndexesReadOnly(v, f.Index)
+			if j == id && fv.IsZero() {
+				query.WriteString("DEFAULT")
+				continue
+			}
+			args = append(args, fv.Interface())
+			query.WriteString("$" + strconv.Itoa(len(args)))
+		}
+		query.WriteByte(')')
+	}
+
+	if !opts.ReturningIDs {
+		_, err := Exec(ctx, db, query.String(), args...)
+		return err
+	}
+
+	// The rows of RETURNING come in the order of VALUES.
+	query.WriteString(" RETURNING id")
+	ids := reflect.New(reflect.SliceOf(fields[id].Field.Type))
+	if err := Select(ctx, db, ids.Interface(), query.String(), args...); err != nil {
+		return err
+	}
+	if ids.Elem().Len() != len(rows) {
+		return sqlErr(fmt.Errorf("got %d ids for %d rows", ids.Elem().Len(), len(rows)), query.String(), args...)
+	}
+	for i := range rows {
+		v := reflect.Indirect(reflect.ValueOf(&rows[i]).Elem())
+		reflectx.FieldByIndexes(v, fields[id].Index).Set(ids.Elem().Index(i))
+	}
+	return nil
+}
+
+// insertFields returns the fields of st mapped to columns, including those
+// of embedded structs.
+func insertFields(st reflect.Type) []*reflectx.FieldInfo {
+	var fields []*reflectx.FieldInfo
+	for _, f := range idMapper.TypeMap(st).Index {
+		if f.Embedded || strings.Contains(f.Path, ".") || hasMappedChildren(f) {
+			continue
+		}
+		if _, ok := f.Options["extras"]; ok {
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// hasMappedChildren tells a struct field holding columns of its own from a
+// value such as time.Time.
+func hasMappedChildren(f *reflectx.FieldInfo) bool {
+	if reflect.PtrTo(f.Field.Type).Implements(valuerType) {
+		return false
+	}
+	for _, c := range f.Children {
+		if c != nil {
+			return true
+		}
+	}
+	return false
+}
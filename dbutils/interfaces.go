@@ -0,0 +1,46 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// The dbmock package has gomock mocks of these interfaces. They are only
+// useful where the result is an error or a sql.Result: Exec, NamedExec and
+// the failures of RunTx's BeginTxx. The read helpers (Select, Get,
+// SelectMaps, GetMap, ...) need the *sql.Rows, *sqlx.Rows or *sqlx.Row a
+// driver returns, which a mock can't build; test them against the in-memory
+// database of the fake package instead.
+//
+//go:generate mockgen -source=interfaces.go -destination=dbmock/mocks.go -package=dbmock
+
+// Queryer runs statements returning rows. *sqlx.DB and *sqlx.Tx implement it.
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error)
+	QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row
+}
+
+// Execer runs statements without returning rows.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// TxStarter begins transactions, *sqlx.DB implements it.
+type TxStarter interface {
+	BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error)
+}
+
+// NamedQueryer is a Queryer able to rebind named queries to its driver.
+type NamedQueryer interface {
+	Queryer
+	Rebind(query string) string
+}
+
+// NamedExecer is an Execer able to rebind named queries to its driver.
+type NamedExecer interface {
+	Execer
+	Rebind(query string) string
+}
@@ -0,0 +1,130 @@
+package dbutils
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Latency histogram buckets are exponential: the upper bound of bucket i is
+// latencyBase << i, from 100µs to about two minutes. Percentiles are
+// reported as the upper bound of their bucket.
+const (
+	latencyBase    = 100 * time.Microsecond
+	latencyBuckets = 21
+)
+
+type latencyHistogram struct {
+	counts [latencyBuckets + 1]int64
+	n      int64
+	max    time.Duration
+}
+
+func (h *latencyHistogram) add(d time.Duration) {
+	i := 0
+	for i < latencyBuckets && d > latencyBase<<i {
+		i++
+	}
+	h.counts[i]++
+	h.n++
+	if d > h.max {
+		h.max = d
+	}
+}
+
+func (h *latencyHistogram) percentile(p float64) time.Duration {
+	rank := int64(p*float64(h.n) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			if i == latencyBuckets || latencyBase<<i > h.max {
+				return h.max
+			}
+			return latencyBase << i
+		}
+	}
+	return h.max
+}
+
+// OpOrCallerClass classifies statements by their op name, or by the caller
+// position for those without one.
+func OpOrCallerClass(ctx context.Context, q *Query) string {
+	if q.OpName != "" {
+		return q.OpName
+	}
+	return q.Caller
+}
+
+// LogLatencies returns a middleware keeping a latency histogram per class of
+// statements, OpOrCallerClass if class is nil, and logging p50/p95/p99 of
+// every class each interval until ctx is done. It's meant for environments
+// with log aggregation but no metrics backend.
+func LogLatencies(ctx context.Context, interval time.Duration, class ClassFunc) Middleware {
+	if class == nil {
+		class = OpOrCallerClass
+	}
+
+	var (
+		mu    sync.Mutex
+		hists = map[string]*latencyHistogram{}
+	)
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				return
+			}
+
+			mu.Lock()
+			cur := hists
+			hists = map[string]*latencyHistogram{}
+			mu.Unlock()
+
+			logLatencies(interval, cur)
+		}
+	}()
+
+	return func(next QueryFunc) QueryFunc {
+		return func(ctx context.Context, q *Query) error {
+			start := time.Now()
+			err := next(ctx, q)
+			d := time.Since(start)
+
+			c := class(ctx, q)
+			mu.Lock()
+			h, ok := hists[c]
+			if !ok {
+				h = &latencyHistogram{}
+				hists[c] = h
+			}
+			h.add(d)
+			mu.Unlock()
+
+			return err
+		}
+	}
+}
+
+func logLatencies(interval time.Duration, hists map[string]*latencyHistogram) {
+	classes := make([]string, 0, len(hists))
+	for c := range hists {
+		classes = append(classes, c)
+	}
+	sort.Strings(classes)
+
+	for _, c := range classes {
+		h := hists[c]
+		log.Printf("query latency over %s op=%q n=%d p50=%s p95=%s p99=%s max=%s",
+			interval, c, h.n, h.percentile(0.50), h.percentile(0.95), h.percentile(0.99), h.max)
+	}
+}
@@ -0,0 +1,126 @@
+package dbutils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ClassFunc assigns a statement to a class for per-class limits.
+type ClassFunc func(ctx context.Context, q *Query) string
+
+// OpClass classifies statements by the op name prefix before the first dot,
+// "billing.charge" belongs to "billing".
+func OpClass(ctx context.Context, q *Query) string {
+	if i := strings.IndexByte(q.OpName, '.'); i >= 0 {
+		return q.OpName[:i]
+	}
+	return q.OpName
+}
+
+// DBClass classifies statements by the handle they run on, e.g. an *sqlx.DB
+// or a *Cluster, named in names, for limits per database. Statements of
+// transactions, which already have their connection, and of handles missing
+// in names are in the "" class.
+func DBClass(names map[interface{}]string) ClassFunc {
+	return func(_ context.Context, q *Query) string {
+		return names[q.DB]
+	}
+}
+
+type semaphore struct {
+	slots chan struct{}
+
+	mu sync.Mutex
+	// holders are the goroutines holding a slot.
+	holders map[uint64]struct{}
+}
+
+func newSemaphore(n int) *semaphore {
+	return &semaphore{slots: make(chan struct{}, n), holders: map[uint64]struct{}{}}
+}
+
+// acquire takes a slot, waiting for one until ctx is done. A goroutine
+// already holding a slot is running a statement from a callback of its own,
+// e.g. of SelectEach, which would wait for itself forever: it shares the
+// slot instead.
+func (s *semaphore) acquire(ctx context.Context) (release func(), err error) {
+	g := goroutineID()
+	s.mu.Lock()
+	_, nested := s.holders[g]
+	s.mu.Unlock()
+	if nested {
+		return func() {}, nil
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("wait for a database slot: %w", ctx.Err())
+	}
+	s.mu.Lock()
+	s.holders[g] = struct{}{}
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		delete(s.holders, g)
+		s.mu.Unlock()
+		<-s.slots
+	}, nil
+}
+
+// goroutineID extracts the id of the current goroutine from the
+// "goroutine N [running]:" header of its stack.
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := bytes.TrimPrefix(buf[:runtime.Stack(buf[:], false)], []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
+
+// LimitConcurrency returns a middleware letting at most n statements run at
+// once; the rest wait in the application until a slot frees up or their
+// context is done. Limit connections of a DB with Config.MaxOpenConns.
+func LimitConcurrency(n int) Middleware {
+	return LimitConcurrencyByClass(func(context.Context, *Query) string { return "" }, map[string]int{"": n})
+}
+
+// LimitConcurrencyByClass is like LimitConcurrency with a separate limit per
+// class, e.g. per database with DBClass. Statements of classes missing in
+// limits aren't limited.
+//
+// Statements run from callbacks of a statement holding a slot of the same
+// class, as from SelectEach, SelectMapsEach or a loop over Rows, use its
+// slot rather than wait for one. This only covers callbacks running on the
+// goroutine of the holder, statements of goroutines it waits for may still
+// deadlock once the class is at its limit.
+func LimitConcurrencyByClass(class ClassFunc, limits map[string]int) Middleware {
+	sems := make(map[string]*semaphore, len(limits))
+	for c, n := range limits {
+		sems[c] = newSemaphore(n)
+	}
+
+	return func(next QueryFunc) QueryFunc {
+		return func(ctx context.Context, q *Query) error {
+			sem, ok := sems[class(ctx, q)]
+			if !ok {
+				return next(ctx, q)
+			}
+			release, err := sem.acquire(ctx)
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			return next(ctx, q)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package dbutils_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"db-example/dbutils"
+	"db-example/dbutils/fake"
+)
+
+func newLimitDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db := fake.New()
+	t.Cleanup(func() { db.Close() })
+	db.MustExec("CREATE TABLE t (id bigint)")
+	db.MustExec("INSERT INTO t (id) VALUES ($1)", 1)
+	db.MustExec("INSERT INTO t (id) VALUES ($1)", 2)
+	return db
+}
+
+func TestLimitConcurrencyNested(t *testing.T) {
+	db := newLimitDB(t)
+	defer dbutils.Use(dbutils.LimitConcurrency(1))()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var n int
+	err := dbutils.SelectEach(ctx, db, "SELECT id FROM t", nil, func(*sqlx.Rows) error {
+		var count int64
+		if err := dbutils.Get(ctx, db, &count, "SELECT count(*) FROM t"); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("%d nested statements ran, want 2", n)
+	}
+}
+
+func TestLimitConcurrencyByDB(t *testing.T) {
+	db1, db2 := newLimitDB(t), newLimitDB(t)
+	defer dbutils.Use(dbutils.LimitConcurrencyByClass(
+		dbutils.DBClass(map[interface{}]string{db1: "db1", db2: "db2"}),
+		map[string]int{"db1": 1, "db2": 1},
+	))()
+
+	// Hold the slot of db1.
+	holding, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		_ = dbutils.SelectEach(context.Background(), db1, "SELECT id FROM t LIMIT 1", nil, func(*sqlx.Rows) error {
+			close(holding)
+			<-done
+			return nil
+		})
+	}()
+	<-holding
+	defer close(done)
+
+	var count int64
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := dbutils.Get(ctx, db1, &count, "SELECT count(*) FROM t"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("statement on db1 over its limit: %v, want deadline exceeded", err)
+	}
+	if err := dbutils.Get(context.Background(), db2, &count, "SELECT count(*) FROM t"); err != nil {
+		t.Fatalf("statement on db2: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultLoaderWait is how long a Loader collects IDs before querying.
+const DefaultLoaderWait = 2 * time.Millisecond
+
+// loaderMaxBatch caps the number of IDs in one query.
+const loaderMaxBatch = 1000
+
+// Loader coalesces Load calls made close in time into one
+// "WHERE id = ANY(...)" query and hands each caller its row. It caches
+// loaded rows, so create a Loader per request, not per process.
+type Loader[K comparable, T any] struct {
+	db    Queryer
+	table string
+	wait  time.Duration
+
+	mu    sync.Mutex
+	batch *loaderBatch[K, T]
+	cache map[K]*loaderBatch[K, T]
+}
+
+type loaderBatch[K comparable, T any] struct {
+	ids  []K
+	once sync.Once
+	done chan struct{}
+
+	items map[K]T
+	err   error
+}
+
+// NewLoader returns a loader of rows of table by their "id" column. wait is
+// the batching window, DefaultLoaderWait if 0.
+func NewLoader[K comparable, T any](db Queryer, table string, wait time.Duration) *Loader[K, T] {
+	if wait <= 0 {
+		wait = DefaultLoaderWait
+	}
+	return &Loader[K, T]{db: db, table: table, wait: wait, cache: map[K]*loaderBatch[K, T]{}}
+}
+
+// Load returns the row with the ID. A missing row is a NotFound error.
+func (l *Loader[K, T]) Load(ctx context.Context, id K) (T, error) {
+	var zero T
+
+	b := l.enqueue(ctx, id)
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+
+	if b.err != nil {
+		return zero, b.err
+	}
+	item, ok := b.items[id]
+	if !ok {
+		return zero, fmt.Errorf("%s %v: %w", l.table, id, sql.ErrNoRows)
+	}
+	return item, nil
+}
+
+// LoadMany returns the rows with the ids in their order, queried in as few
+// batches as possible.
+func (l *Loader[K, T]) LoadMany(ctx context.Context, ids []K) ([]T, error) {
+	for _, id := range ids {
+		l.enqueue(ctx, id)
+	}
+
+	ret := make([]T, len(ids))
+	for i, id := range ids {
+		item, err := l.Load(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = item
+	}
+	return ret, nil
+}
+
+func (l *Loader[K, T]) enqueue(ctx context.Context, id K) *loaderBatch[K, T] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.cache[id]; ok {
+		return b
+	}
+
+	// The batch outlives the caller that happened to start it.
+	bctx := context.WithoutCancel(ctx)
+
+	b := l.batch
+	if b == nil {
+		b = &loaderBatch[K, T]{done: make(chan struct{})}
+		l.batch = b
+		time.AfterFunc(l.wait, func() { l.dispatch(bctx, b) })
+	}
+	b.ids = append(b.ids, id)
+	l.cache[id] = b
+
+	if len(b.ids) >= loaderMaxBatch {
+		l.batch = nil
+		go l.dispatch(bctx, b)
+	}
+	return b
+}
+
+func (l *Loader[K, T]) dispatch(ctx context.Context, b *loaderBatch[K, T]) {
+	b.once.Do(func() {
+		l.mu.Lock()
+		if l.batch == b {
+			l.batch = nil
+		}
+		ids := b.ids
+		l.mu.Unlock()
+
+		b.items, b.err = getByIDs[T](ctx, l.db, l.table, ids)
+		if b.err != nil {
+			// Don't cache failures, later loads retry.
+			l.mu.Lock()
+			for _, id := range ids {
+				if l.cache[id] == b {
+					delete(l.cache, id)
+				}
+			}
+			l.mu.Unlock()
+		}
+		close(b.done)
+	})
+}
@@ -0,0 +1,24 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// GetForUpdate gets the row of table matching where into dest and locks it
+// with FOR UPDATE until tx ends, for read-modify-write cycles. With
+// LockSkipLocked a locked row is reported as sql.ErrNoRows.
+func GetForUpdate(ctx context.Context, tx *sqlx.Tx, dest interface{}, table string, where Cond, wait LockWait) error {
+	b := NewSelect(table).ForUpdate()
+	b.wait = wait
+	if where != nil {
+		b.Where(where)
+	}
+	q, args, err := b.Build()
+	if err != nil {
+		return fmt.Errorf("get for update from %s: %w", table, err)
+	}
+	return Get(ctx, tx, dest, q, args...)
+}
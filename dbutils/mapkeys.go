@@ -0,0 +1,80 @@
+package dbutils
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+)
+
+// KeyFunc renames column names used as keys of map results.
+type KeyFunc func(column string) string
+
+var defaultKeyFunc atomic.Value
+
+// SetMapKeyFunc sets the default key renaming of SelectMaps and GetMap,
+// e.g. SetMapKeyFunc(CamelCase). nil keeps the column names.
+func SetMapKeyFunc(f KeyFunc) {
+	defaultKeyFunc.Store(f)
+}
+
+type keyFuncKey struct{}
+
+// WithMapKeyFunc overrides the key renaming for map helpers called with ctx.
+func WithMapKeyFunc(ctx context.Context, f KeyFunc) context.Context {
+	return context.WithValue(ctx, keyFuncKey{}, f)
+}
+
+func mapKeyFunc(ctx context.Context) KeyFunc {
+	if f, ok := ctx.Value(keyFuncKey{}).(KeyFunc); ok {
+		return f
+	}
+	f, _ := defaultKeyFunc.Load().(KeyFunc)
+	return f
+}
+
+// CamelCase converts snake_case names to camelCase: "created_at" becomes
+// "createdAt".
+func CamelCase(column string) string {
+	var buf strings.Builder
+	upper := false
+	for i, r := range column {
+		switch {
+		case r == '_' && i > 0:
+			upper = true
+		case upper:
+			buf.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	s := buf.String()
+	if r, n := utf8.DecodeRuneInString(s); n > 0 {
+		s = string(unicode.ToLower(r)) + s[n:]
+	}
+	return s
+}
+
+// TransformMap applies NULL rendering, masking and key renaming configured
+// for ctx to a map result.
+func TransformMap(ctx context.Context, m map[string]interface{}) map[string]interface{} {
+	convertNulls(ctx, m)
+	MaskMap(m)
+	return renameKeys(ctx, m)
+}
+
+// renameKeys applies the key function configured for ctx to m.
+func renameKeys(ctx context.Context, m map[string]interface{}) map[string]interface{} {
+	f := mapKeyFunc(ctx)
+	if f == nil {
+		return m
+	}
+
+	ret := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		ret[f(k)] = v
+	}
+	return ret
+}
@@ -0,0 +1,82 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"sync/atomic"
+)
+
+// MapNulls selects how SQL NULLs appear in map results.
+type MapNulls int32
+
+const (
+	// NullsAsScanned keeps what the driver returns, which may be a typed
+	// nil or an invalid sql.Null* value for some types.
+	NullsAsScanned MapNulls = iota
+	// NullsAsNil makes all NULLs untyped nil, encoded as null in JSON.
+	NullsAsNil
+	// NullsDrop removes the keys of NULL columns.
+	NullsDrop
+)
+
+var defaultMapNulls int32
+
+// SetMapNulls sets how SelectMaps, GetMap and the other map helpers return
+// NULLs, NullsAsScanned by default.
+func SetMapNulls(n MapNulls) {
+	atomic.StoreInt32(&defaultMapNulls, int32(n))
+}
+
+type mapNullsKey struct{}
+
+// WithMapNulls overrides the NULL rendering for map helpers called with
+// ctx.
+func WithMapNulls(ctx context.Context, n MapNulls) context.Context {
+	return context.WithValue(ctx, mapNullsKey{}, n)
+}
+
+func mapNulls(ctx context.Context) MapNulls {
+	if n, ok := ctx.Value(mapNullsKey{}).(MapNulls); ok {
+		return n
+	}
+	return MapNulls(atomic.LoadInt32(&defaultMapNulls))
+}
+
+// convertNulls applies the NULL rendering configured for ctx to m in place.
+func convertNulls(ctx context.Context, m map[string]interface{}) {
+	mode := mapNulls(ctx)
+	if mode == NullsAsScanned {
+		return
+	}
+	for k, v := range m {
+		if !isNull(v) {
+			continue
+		}
+		if mode == NullsDrop {
+			delete(m, k)
+		} else {
+			m[k] = nil
+		}
+	}
+}
+
+// isNull tells if a scanned value stands for NULL.
+func isNull(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	if vr, ok := v.(driver.Valuer); ok {
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return true
+		}
+		dv, err := vr.Value()
+		return err == nil && dv == nil
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
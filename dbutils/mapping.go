@@ -0,0 +1,149 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// MappingMode selects what happens to result columns without a struct
+// field when scanning into structs.
+type MappingMode int32
+
+const (
+	// MappingStrict fails the query, as sqlx does.
+	MappingStrict MappingMode = iota
+	// MappingIgnore skips the columns.
+	MappingIgnore
+	// MappingCollect skips the columns and records them, see
+	// UnmappedColumns.
+	MappingCollect
+)
+
+var defaultMappingMode int32
+
+// SetMappingMode sets the mapping mode of Select, Get and ScanAll, so read
+// models may select columns they have no fields for. It's MappingStrict by
+// default.
+func SetMappingMode(m MappingMode) {
+	atomic.StoreInt32(&defaultMappingMode, int32(m))
+}
+
+type mappingModeKey struct{}
+
+// WithMappingMode overrides the mapping mode for helpers called with ctx.
+func WithMappingMode(ctx context.Context, m MappingMode) context.Context {
+	return context.WithValue(ctx, mappingModeKey{}, m)
+}
+
+func mappingMode(ctx context.Context) MappingMode {
+	if m, ok := ctx.Value(mappingModeKey{}).(MappingMode); ok {
+		return m
+	}
+	return MappingMode(atomic.LoadInt32(&defaultMappingMode))
+}
+
+var extrasType = reflect.TypeOf(map[string]interface{}(nil))
+
+// structMap is what rowMapper knows about a struct beyond the sqlx field
+// map.
+type structMap struct {
+	// extras is the field tagged `db:",extras"`, which receives the columns
+	// without a field of their own.
+	extras *reflectx.FieldInfo
+	// prefixed maps columns like author_id to the fields of a struct field
+	// tagged `db:"author,prefix"`, for results of joins.
+	prefixed map[string]*reflectx.FieldInfo
+	// arrays tells if there are slice fields for array columns.
+	arrays bool
+}
+
+var structMaps sync.Map
+
+func structMapOf(t reflect.Type) (*structMap, error) {
+	if sm, ok := structMaps.Load(t); ok {
+		return sm.(*structMap), nil
+	}
+
+	sm := &structMap{prefixed: map[string]*reflectx.FieldInfo{}}
+	for _, fi := range idMapper.TypeMap(t).Index {
+		if _, ok := fi.Options["extras"]; ok && sm.extras == nil {
+			if fi.Field.Type != extrasType {
+				return nil, fmt.Errorf("extras field %s of %s is not map[string]interface{}", fi.Field.Name, t)
+			}
+			sm.extras = fi
+		}
+		if isArrayField(fi.Field.Type) {
+			sm.arrays = true
+		}
+		for p := fi.Parent; p != nil; p = p.Parent {
+			if _, ok := p.Options["prefix"]; ok {
+				sm.prefixed[strings.ReplaceAll(fi.Path, ".", "_")] = fi
+				break
+			}
+		}
+	}
+
+	structMaps.Store(t, sm)
+	return sm, nil
+}
+
+// needsRowMapper tells if scanning into dest must be done by rowMapper
+// instead of sqlx, which fails on columns without a field and doesn't know
+// prefixes and arrays.
+func needsRowMapper(ctx context.Context, dest interface{}) bool {
+	if mappingMode(ctx) != MappingStrict {
+		return true
+	}
+
+	t := reflect.TypeOf(dest)
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return false
+	}
+	sm, err := structMapOf(t)
+	return err != nil || sm.extras != nil || len(sm.prefixed) > 0 || sm.arrays
+}
+
+var unmapped struct {
+	sync.Mutex
+	columns map[string]map[string]struct{}
+}
+
+func collectUnmapped(typ, column string) {
+	unmapped.Lock()
+	defer unmapped.Unlock()
+
+	if unmapped.columns == nil {
+		unmapped.columns = map[string]map[string]struct{}{}
+	}
+	if unmapped.columns[typ] == nil {
+		unmapped.columns[typ] = map[string]struct{}{}
+	}
+	unmapped.columns[typ][column] = struct{}{}
+}
+
+// UnmappedColumns returns the columns skipped in MappingCollect mode by the
+// struct type they were skipped for, to find queries selecting more than
+// they use.
+func UnmappedColumns() map[string][]string {
+	unmapped.Lock()
+	defer unmapped.Unlock()
+
+	ret := make(map[string][]string, len(unmapped.columns))
+	for typ, cols := range unmapped.columns {
+		for c := range cols {
+			ret[typ] = append(ret[typ], c)
+		}
+		sort.Strings(ret[typ])
+	}
+	return ret
+}
@@ -0,0 +1,56 @@
+package dbutils
+
+import (
+	"path"
+	"strings"
+	"sync"
+)
+
+// Masked replaces values of sensitive columns.
+const Masked = "***"
+
+var maskPolicy = struct {
+	sync.RWMutex
+	patterns []string
+}{
+	patterns: []string{"*password*", "*passwd*", "*secret*", "*token*", "ssn"},
+}
+
+// SetMaskPatterns replaces the list of sensitive column name patterns,
+// matched case-insensitively with path.Match syntax. Values of matching
+// columns are replaced with Masked in map results and log output. Calling
+// it without patterns turns masking off.
+func SetMaskPatterns(patterns ...string) {
+	lower := make([]string, len(patterns))
+	for i, p := range patterns {
+		lower[i] = strings.ToLower(p)
+	}
+
+	maskPolicy.Lock()
+	maskPolicy.patterns = lower
+	maskPolicy.Unlock()
+}
+
+// IsSensitive reports whether column matches one of the mask patterns.
+func IsSensitive(column string) bool {
+	column = strings.ToLower(column)
+
+	maskPolicy.RLock()
+	defer maskPolicy.RUnlock()
+
+	for _, p := range maskPolicy.patterns {
+		if ok, _ := path.Match(p, column); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MaskMap replaces values of sensitive keys in m in place.
+func MaskMap(m map[string]interface{}) {
+	for k, v := range m {
+		if v != nil && IsSensitive(k) {
+			m[k] = Masked
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+)
+
+// ErrMaxRowsExceeded is returned by Select and SelectMaps when a result has
+// more rows than the limit set with SetMaxRows or WithMaxRows.
+var ErrMaxRowsExceeded = errors.New("too many rows in result")
+
+var defaultMaxRows int64
+
+// SetMaxRows sets the number of rows Select and SelectMaps accept before
+// failing with ErrMaxRowsExceeded, to catch a missing WHERE or LIMIT before
+// it exhausts memory. 0 means no limit.
+func SetMaxRows(n int) {
+	atomic.StoreInt64(&defaultMaxRows, int64(n))
+}
+
+type maxRowsKey struct{}
+
+// WithMaxRows overrides the row limit for helpers called with ctx, 0 turns
+// it off.
+func WithMaxRows(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, maxRowsKey{}, n)
+}
+
+func maxRows(ctx context.Context) int {
+	if n, ok := ctx.Value(maxRowsKey{}).(int); ok {
+		return n
+	}
+	return int(atomic.LoadInt64(&defaultMaxRows))
+}
+
+func maxRowsErr(n int) error {
+	return fmt.Errorf("%w: more than %d", ErrMaxRowsExceeded, n)
+}
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
@@ -0,0 +1,264 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// mergeVersion is the first server version with MERGE.
+const mergeVersion = 150000
+
+var serverVersions sync.Map
+
+// ServerVersion returns server_version_num of the server db is connected
+// to, e.g. 150004 for 15.4. It's cached for *sqlx.DB.
+func ServerVersion(ctx context.Context, db Queryer) (int, error) {
+	if v, ok := serverVersions.Load(db); ok {
+		return v.(int), nil
+	}
+
+	var v int
+	if err := Get(ctx, db, &v, `SELECT current_setting('server_version_num')::int`); err != nil {
+		return 0, err
+	}
+	if _, ok := db.(*sqlx.DB); ok {
+		serverVersions.Store(db, v)
+	}
+	return v, nil
+}
+
+// MergeBuilder composes a MERGE of rows into a table, which is turned into
+// INSERT ... ON CONFLICT or UPDATE ... FROM on servers before 15. The
+// fallback needs a unique index on the key columns.
+type MergeBuilder struct {
+	table   string
+	key     []string
+	columns []string
+	rows    [][]interface{}
+	update  bool
+	updCols []string
+	insert  bool
+}
+
+// NewMerge starts a MERGE into table matching rows by the key columns.
+func NewMerge(table string, key ...string) *MergeBuilder {
+	return &MergeBuilder{table: table, key: key}
+}
+
+// Columns sets the columns of the rows, including the key columns.
+func (b *MergeBuilder) Columns(columns ...string) *MergeBuilder {
+	b.columns = columns
+	return b
+}
+
+// Values adds a row with a value for each column.
+func (b *MergeBuilder) Values(values ...interface{}) *MergeBuilder {
+	b.rows = append(b.rows, values)
+	return b
+}
+
+// WhenMatchedUpdate updates the matched rows with columns of the new
+// ones, all but the key columns if none.
+func (b *MergeBuilder) WhenMatchedUpdate(columns ...string) *MergeBuilder {
+	b.update = true
+	b.updCols = columns
+	return b
+}
+
+// WhenNotMatchedInsert inserts the rows without a match.
+func (b *MergeBuilder) WhenNotMatchedInsert() *MergeBuilder {
+	b.insert = true
+	return b
+}
+
+// Exec builds the statement for the server of db and runs it.
+func (b *MergeBuilder) Exec(ctx context.Context, db sqlx.ExtContext) (sql.Result, error) {
+	version, err := ServerVersion(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	q, args, err := b.Build(version)
+	if err != nil {
+		return nil, err
+	}
+	return Exec(ctx, db, q, args...)
+}
+
+// Build builds MERGE for serverVersion 15 and later, the fallback for
+// earlier ones.
+func (b *MergeBuilder) Build(serverVersion int) (query string, args []interface{}, err error) {
+	var buf strings.Builder
+	var al argList
+
+	if err := b.appendQuery(&buf, &al, serverVersion >= mergeVersion); err != nil {
+		return "", nil, fmt.Errorf("build merge: %w", err)
+	}
+	return buf.String(), al.args, nil
+}
+
+func (b *MergeBuilder) appendQuery(buf *strings.Builder, al *argList, merge bool) error {
+	if len(b.key) == 0 {
+		return errors.New("no key columns")
+	}
+	if len(b.rows) == 0 {
+		return errors.New("no rows")
+	}
+	if !b.update && !b.insert {
+		return errors.New("no actions")
+	}
+
+	table, err := QuoteIdent(b.table)
+	if err != nil {
+		return err
+	}
+	cols, err := quoteIdents(b.columns)
+	if err != nil {
+		return err
+	}
+	key, err := quoteIdents(b.key)
+	if err != nil {
+		return err
+	}
+	for _, k := range b.key {
+		if !containsString(b.columns, k) {
+			return fmt.Errorf("key column %q is not among the columns", k)
+		}
+	}
+	upd := b.updCols
+	if len(upd) == 0 {
+		for _, c := range b.columns {
+			if !containsString(b.key, c) {
+				upd = append(upd, c)
+			}
+		}
+	}
+	set, err := quoteIdents(upd)
+	if err != nil {
+		return err
+	}
+
+	if b.insert && !merge {
+		buf.WriteString("INSERT INTO " + table + " (" + strings.Join(cols, ", ") + ") ")
+		if err := b.appendValues(buf, al); err != nil {
+			return err
+		}
+		buf.WriteString(" ON CONFLICT (" + strings.Join(key, ", ") + ") DO ")
+		if !b.update || len(set) == 0 {
+			buf.WriteString("NOTHING")
+			return nil
+		}
+		buf.WriteString("UPDATE SET ")
+		for i, c := range set {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(c + " = EXCLUDED." + c)
+		}
+		return nil
+	}
+
+	if !b.insert && len(set) == 0 {
+		return errors.New("no columns to update")
+	}
+	if merge {
+		buf.WriteString("MERGE INTO " + table + " AS t USING (")
+	} else {
+		buf.WriteString("UPDATE " + table + " AS t SET ")
+		for i, c := range set {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(c + " = s." + c)
+		}
+		buf.WriteString(" FROM (")
+	}
+	// The empty select gives the parameters the types of the columns,
+	// they would be text otherwise.
+	buf.WriteString("SELECT " + strings.Join(cols, ", ") + " FROM " + table + " WHERE false UNION ALL ")
+	if err := b.appendValues(buf, al); err != nil {
+		return err
+	}
+	buf.WriteString(") AS s ")
+	if merge {
+		buf.WriteString("ON ")
+	} else {
+		buf.WriteString("WHERE ")
+	}
+	for i, k := range key {
+		if i > 0 {
+			buf.WriteString(" AND ")
+		}
+		buf.WriteString("t." + k + " = s." + k)
+	}
+	if !merge {
+		return nil
+	}
+
+	if b.update && len(set) > 0 {
+		buf.WriteString(" WHEN MATCHED THEN UPDATE SET ")
+		for i, c := range set {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(c + " = s." + c)
+		}
+	}
+	if b.insert {
+		buf.WriteString(" WHEN NOT MATCHED THEN INSERT (" + strings.Join(cols, ", ") + ") VALUES (")
+		for i, c := range cols {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString("s." + c)
+		}
+		buf.WriteString(")")
+	}
+	return nil
+}
+
+func (b *MergeBuilder) appendValues(buf *strings.Builder, al *argList) error {
+	buf.WriteString("VALUES ")
+	for i, row := range b.rows {
+		if len(row) != len(b.columns) {
+			return fmt.Errorf("row %d has %d values for %d columns", i, len(row), len(b.columns))
+		}
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString("(")
+		for j, v := range row {
+			if j > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(al.add(v))
+		}
+		buf.WriteString(")")
+	}
+	return nil
+}
+
+func quoteIdents(names []string) ([]string, error) {
+	ret := make([]string, len(names))
+	for i, n := range names {
+		var err error
+		if ret[i], err = QuoteIdent(n); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+// queryHashCacheSize bounds the cache of QueryHash, statements with inlined
+// values could grow it without limit otherwise.
+const queryHashCacheSize = 10000
+
+var queryHashes struct {
+	sync.RWMutex
+	m map[string]string
+}
+
+// QueryHash returns a short hash of the normalized statement, identifying
+// it in metrics and traces without the SQL text.
+func QueryHash(query string) string {
+	queryHashes.RLock()
+	h, ok := queryHashes.m[query]
+	queryHashes.RUnlock()
+	if ok {
+		return h
+	}
+
+	f := fnv.New64a()
+	f.Write([]byte(NormalizeQuery(query)))
+	h = fmt.Sprintf("%016x", f.Sum64())
+
+	queryHashes.Lock()
+	if queryHashes.m == nil || len(queryHashes.m) >= queryHashCacheSize {
+		queryHashes.m = map[string]string{}
+	}
+	queryHashes.m[query] = h
+	queryHashes.Unlock()
+	return h
+}
+
+// OpOrQueryClass classifies statements by their op name, set with
+// WithOpName or by the registry for named queries, or by the QueryHash of
+// the statement for those without one. Unlike the SQL text it's a label of
+// low cardinality for metrics and traces.
+func OpOrQueryClass(ctx context.Context, q *Query) string {
+	if q.OpName != "" {
+		return q.OpName
+	}
+	return "query:" + QueryHash(q.SQL)
+}
+
+// QueryStat holds the metrics of a class of statements.
+type QueryStat struct {
+	Label  string
+	Count  int64
+	Errors int64
+	Total  time.Duration
+	// P50, P95 and P99 are the upper bounds of the latency buckets of the
+	// percentiles.
+	P50, P95, P99 time.Duration
+}
+
+type queryMetric struct {
+	errors int64
+	total  time.Duration
+	hist   latencyHistogram
+}
+
+// QueryMetrics collects the counts, errors and latencies of statements per
+// class for exporting to a metrics backend.
+type QueryMetrics struct {
+	class   ClassFunc
+	mu      sync.Mutex
+	metrics map[string]*queryMetric
+}
+
+// NewQueryMetrics returns metrics classifying statements with class,
+// OpOrQueryClass if nil. Its Middleware must be installed with Use.
+func NewQueryMetrics(class ClassFunc) *QueryMetrics {
+	if class == nil {
+		class = OpOrQueryClass
+	}
+	return &QueryMetrics{class: class, metrics: map[string]*queryMetric{}}
+}
+
+// Middleware records the statements.
+func (m *QueryMetrics) Middleware(next QueryFunc) QueryFunc {
+	return func(ctx context.Context, q *Query) error {
+		label := m.class(ctx, q)
+		start := time.Now()
+		err := next(ctx, q)
+		d := time.Since(start)
+
+		m.mu.Lock()
+		qm := m.metrics[label]
+		if qm == nil {
+			qm = &queryMetric{}
+			m.metrics[label] = qm
+		}
+		qm.hist.add(d)
+		qm.total += d
+		if err != nil {
+			qm.errors++
+		}
+		m.mu.Unlock()
+		return err
+	}
+}
+
+// Snapshot returns the metrics collected so far, sorted by label.
+func (m *QueryMetrics) Snapshot() []QueryStat {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ret := make([]QueryStat, 0, len(m.metrics))
+	for label, qm := range m.metrics {
+		ret = append(ret, QueryStat{
+			Label:  label,
+			Count:  qm.hist.n,
+			Errors: qm.errors,
+			Total:  qm.total,
+			P50:    qm.hist.percentile(0.50),
+			P95:    qm.hist.percentile(0.95),
+			P99:    qm.hist.percentile(0.99),
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Label < ret[j].Label })
+	return ret
+}
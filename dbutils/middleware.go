@@ -0,0 +1,140 @@
+package dbutils
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Query is a statement on its way to the database. Middleware may inspect
+// or modify it before passing it on.
+type Query struct {
+	SQL  string
+	Args []interface{}
+
+	// OpName is the name set with WithOpName.
+	OpName string
+	// Caller is file:line of the code that called the helper.
+	Caller string
+	// TraceParent is the trace context set with WithTraceParent.
+	TraceParent string
+	// DB is the handle the statement runs on, as passed to RunQuery.
+	DB interface{}
+
+	// TxID and BackendPID identify the transaction of RunTx the statement
+	// runs in, when enabled with SetTxIDs.
+	TxID       int64
+	BackendPID int32
+}
+
+// QueryFunc executes q, including scanning of the results.
+type QueryFunc func(ctx context.Context, q *Query) error
+
+// Middleware wraps every statement executed by the package helpers.
+type Middleware func(next QueryFunc) QueryFunc
+
+type middlewareEntry struct {
+	mw Middleware
+}
+
+var middleware struct {
+	sync.RWMutex
+	chain []*middlewareEntry
+}
+
+// Use appends mw to the middleware chain. The first registered middleware
+// is the outermost one. The returned function removes mw from the chain.
+func Use(mw ...Middleware) (remove func()) {
+	entries := make([]*middlewareEntry, 0, len(mw))
+	for _, m := range mw {
+		entries = append(entries, &middlewareEntry{mw: m})
+	}
+
+	middleware.Lock()
+	middleware.chain = append(middleware.chain, entries...)
+	middleware.Unlock()
+
+	return func() {
+		middleware.Lock()
+		defer middleware.Unlock()
+
+		chain := make([]*middlewareEntry, 0, len(middleware.chain))
+		for _, e := range middleware.chain {
+			if !containsEntry(entries, e) {
+				chain = append(chain, e)
+			}
+		}
+		middleware.chain = chain
+	}
+}
+
+func containsEntry(entries []*middlewareEntry, e *middlewareEntry) bool {
+	for _, x := range entries {
+		if x == e {
+			return true
+		}
+	}
+	return false
+}
+
+var defaultTimeout int64
+
+// SetDefaultTimeout sets the timeout of statements run with a context
+// without a deadline, so a forgotten deadline can't let a query run forever.
+// It covers retries and, for streaming helpers, reading the rows. 0, the
+// default, means no timeout.
+func SetDefaultTimeout(d time.Duration) {
+	atomic.StoreInt64(&defaultTimeout, int64(d))
+}
+
+// RunQuery executes f for the statement through the middleware chain. It's
+// exported for helpers built on other drivers; db is the handle the
+// statement runs on.
+func RunQuery(ctx context.Context, db interface{}, query string, args []interface{}, f QueryFunc) error {
+	defer enterTx(db)()
+
+	timeout, ok := ctx.Value(timeoutKey{}).(time.Duration)
+	if !ok {
+		if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+			timeout = time.Duration(atomic.LoadInt64(&defaultTimeout))
+		}
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	ctx = sampleLog(ctx, query)
+
+	var h QueryFunc = func(ctx context.Context, q *Query) error {
+		exec := *q
+		var err error
+		if exec.SQL, exec.Args, err = rewrite(ctx, q.SQL, q.Args); err != nil {
+			return err
+		}
+		exec.Args = execModeArgs(ctx, exec.Args)
+		return withSentSQL(f(context.WithValue(ctx, queryKey{}, q), &exec), exec.SQL)
+	}
+	h = retryStaleStatement(db, h)
+	h = retryDemotedPrimary(db, h)
+	h = retryConnLoss(db, h)
+	h = retryReads(db, h)
+
+	middleware.RLock()
+	for i := len(middleware.chain) - 1; i >= 0; i-- {
+		h = middleware.chain[i].mw(h)
+	}
+	middleware.RUnlock()
+
+	q := &Query{
+		SQL:         query,
+		Args:        args,
+		OpName:      OpName(ctx),
+		Caller:      callerOutside(),
+		TraceParent: TraceParent(ctx),
+		DB:          db,
+	}
+	setTxInfo(db, q)
+	return h(ctx, q)
+}
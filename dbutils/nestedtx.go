@@ -0,0 +1,67 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/multierr"
+)
+
+type ambientTxKey struct{}
+
+type ambientTx struct {
+	tx    *sqlx.Tx
+	depth int
+}
+
+// TxFromContext returns the transaction RunInTx runs with ctx.
+func TxFromContext(ctx context.Context) (*sqlx.Tx, bool) {
+	a, ok := ctx.Value(ambientTxKey{}).(*ambientTx)
+	if !ok {
+		return nil, false
+	}
+	return a.tx, true
+}
+
+// TxCtxFunc is called by RunInTx with a context carrying the transaction.
+type TxCtxFunc func(ctx context.Context, tx *sqlx.Tx) error
+
+// RunInTx runs f in a transaction. If ctx already carries one, f joins it
+// within a savepoint, so a failure of f rolls back only its own changes and
+// the caller decides about the rest. Otherwise a transaction is started on
+// db as with RunTx. Code calling RunInTx with the context it gets is
+// transactional no matter whether its caller is.
+func RunInTx(ctx context.Context, db TxStarter, f TxCtxFunc) error {
+	if a, ok := ctx.Value(ambientTxKey{}).(*ambientTx); ok {
+		return runInSavepoint(ctx, a, f)
+	}
+
+	return RunTx(ctx, db, func(tx *sqlx.Tx) error {
+		return f(context.WithValue(ctx, ambientTxKey{}, &ambientTx{tx: tx}), tx)
+	})
+}
+
+func runInSavepoint(ctx context.Context, parent *ambientTx, f TxCtxFunc) (err error) {
+	a := &ambientTx{tx: parent.tx, depth: parent.depth + 1}
+	name := fmt.Sprintf("dbutils_sp%d", a.depth)
+
+	if _, err := Exec(ctx, a.tx, "SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("create savepoint: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			// Rolling back keeps the savepoint, release it for the next
+			// one of the same name not to nest in it.
+			_, rerr := Exec(ctx, a.tx, "ROLLBACK TO SAVEPOINT "+name)
+			if rerr == nil {
+				_, rerr = Exec(ctx, a.tx, "RELEASE SAVEPOINT "+name)
+			}
+			err = multierr.Combine(err, rerr)
+			return
+		}
+		_, err = Exec(ctx, a.tx, "RELEASE SAVEPOINT "+name)
+	}()
+
+	return f(context.WithValue(ctx, ambientTxKey{}, a), a.tx)
+}
@@ -0,0 +1,138 @@
+package dbutils
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	listRe   = regexp.MustCompile(`\(\s*\?(\s*,\s*\?)*\s*\)`)
+	arrayRe  = regexp.MustCompile(`(?i)ARRAY\s*\[\s*\?(\s*,\s*\?)*\s*\]`)
+	tuplesRe = regexp.MustCompile(`\(\.\.\.\)(\s*,\s*\(\.\.\.\))+`)
+)
+
+// NormalizeQuery reduces a statement to its shape: literals and
+// placeholders become "?", lists of them collapse to "(...)", comments are
+// dropped and whitespace is squeezed. Statements differing only in values
+// normalize to the same string, which makes it suitable as a metric label
+// and for logs that must not contain data.
+func NormalizeQuery(query string) string {
+	var buf strings.Builder
+	rs := []rune(query)
+	space := false
+
+	emit := func(s string) {
+		if space && buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		space = false
+		buf.WriteString(s)
+	}
+
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			space = true
+			i++
+		case r == '-' && i+1 < len(rs) && rs[i+1] == '-':
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+			space = true
+		case r == '/' && i+1 < len(rs) && rs[i+1] == '*':
+			end := strings.Index(string(rs[i+2:]), "*/")
+			if end < 0 {
+				i = len(rs)
+			} else {
+				i += 2 + len([]rune(string(rs[i+2:])[:end])) + 2
+			}
+			space = true
+		case r == '\'' || ((r == 'E' || r == 'e') && i+1 < len(rs) && rs[i+1] == '\''):
+			backslash := r != '\''
+			if backslash {
+				i++
+			}
+			i = skipQuoted(rs, i, backslash)
+			emit("?")
+		case r == '"':
+			start := i
+			i = skipQuoted(rs, i, false)
+			emit(string(rs[start:i]))
+		case r == '$':
+			j := i + 1
+			for j < len(rs) && unicode.IsDigit(rs[j]) {
+				j++
+			}
+			if j > i+1 {
+				emit("?")
+				i = j
+				continue
+			}
+			if end := dollarQuoteEnd(rs, i); end > 0 {
+				emit("?")
+				i = end
+				continue
+			}
+			emit("$")
+			i++
+		case unicode.IsDigit(r):
+			for i < len(rs) && (unicode.IsDigit(rs[i]) || rs[i] == '.' ||
+				rs[i] == 'e' || rs[i] == 'E' ||
+				((rs[i] == '-' || rs[i] == '+') && (rs[i-1] == 'e' || rs[i-1] == 'E'))) {
+				i++
+			}
+			emit("?")
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(rs) && (unicode.IsLetter(rs[i]) || unicode.IsDigit(rs[i]) || rs[i] == '_' || rs[i] == '$') {
+				i++
+			}
+			emit(string(rs[start:i]))
+		default:
+			emit(string(r))
+			i++
+		}
+	}
+
+	s := listRe.ReplaceAllString(buf.String(), "(...)")
+	s = arrayRe.ReplaceAllString(s, "ARRAY[...]")
+	return tuplesRe.ReplaceAllString(s, "(...)")
+}
+
+// skipQuoted returns the index after the quoted string starting at i.
+func skipQuoted(rs []rune, i int, backslash bool) int {
+	q := rs[i]
+	for i++; i < len(rs); i++ {
+		switch {
+		case backslash && rs[i] == '\\':
+			i++
+		case rs[i] == q:
+			if i+1 < len(rs) && rs[i+1] == q {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(rs)
+}
+
+// dollarQuoteEnd returns the index after a $tag$...$tag$ string starting at
+// i, or 0 if there is none.
+func dollarQuoteEnd(rs []rune, i int) int {
+	j := i + 1
+	for j < len(rs) && (unicode.IsLetter(rs[j]) || rs[j] == '_' || unicode.IsDigit(rs[j])) {
+		j++
+	}
+	if j >= len(rs) || rs[j] != '$' {
+		return 0
+	}
+	tag := string(rs[i : j+1])
+	end := strings.Index(string(rs[j+1:]), tag)
+	if end < 0 {
+		return len(rs)
+	}
+	return j + 1 + len([]rune(string(rs[j+1:])[:end])) + len([]rune(tag))
+}
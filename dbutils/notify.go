@@ -0,0 +1,136 @@
+package dbutils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+)
+
+// notifyFunc is the trigger function shared by the tables of
+// NotifyChanges. Its arguments are the channel and the key columns.
+const notifyFunc = `CREATE OR REPLACE FUNCTION dbutils_notify_change() RETURNS trigger LANGUAGE plpgsql AS $fn$
+	DECLARE
+		r jsonb;
+		pk jsonb := '{}';
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			r := to_jsonb(OLD);
+		ELSE
+			r := to_jsonb(NEW);
+		END IF;
+		FOR i IN 1 .. TG_NARGS - 1 LOOP
+			pk := pk || jsonb_build_object(TG_ARGV[i], r -> TG_ARGV[i]);
+		END LOOP;
+		PERFORM pg_notify(TG_ARGV[0], jsonb_build_object(
+			'table', TG_TABLE_NAME, 'schema', TG_TABLE_SCHEMA, 'op', TG_OP, 'pk', pk)::text);
+		RETURN NULL;
+	END
+	$fn$`
+
+// ChangeEvent is the payload of the notifications of NotifyChanges.
+type ChangeEvent struct {
+	Table  string `json:"table"`
+	Schema string `json:"schema"`
+	// Op is INSERT, UPDATE or DELETE.
+	Op string `json:"op"`
+	// PK holds the key columns of the changed row, of the old version for
+	// deletes.
+	PK map[string]interface{} `json:"pk"`
+}
+
+// NotifyChanges installs a trigger on table sending a ChangeEvent as JSON
+// to channel with NOTIFY on every inserted, updated or deleted row, for
+// ListenChanges to pick up. The key columns, "id" if none, identify the
+// row; listeners read the rest themselves. It's a lighter alternative to
+// logical replication for propagating changes within an app, but the
+// notifications of the transactions committed while no one listens are
+// lost.
+func NotifyChanges(ctx context.Context, db TxStarter, channel, table string, key ...string) error {
+	if len(key) == 0 {
+		key = []string{"id"}
+	}
+	t, err := QuoteIdent(table)
+	if err != nil {
+		return fmt.Errorf("notify changes of %s: %w", table, err)
+	}
+	args := make([]string, 0, len(key)+1)
+	for _, s := range append([]string{channel}, key...) {
+		args = append(args, quoteLiteral(s))
+	}
+
+	err = RunTx(ctx, db, func(tx *sqlx.Tx) error {
+		for _, q := range []string{
+			notifyFunc,
+			`DROP TRIGGER IF EXISTS change_notify ON ` + t,
+			`CREATE TRIGGER change_notify AFTER INSERT OR UPDATE OR DELETE ON ` + t + `
+				FOR EACH ROW EXECUTE FUNCTION dbutils_notify_change(` + strings.Join(args, ", ") + `)`,
+		} {
+			if _, err := Exec(ctx, tx, q); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("notify changes of %s: %w", table, err)
+	}
+	return nil
+}
+
+// DropNotifyChanges removes the trigger of NotifyChanges from table.
+func DropNotifyChanges(ctx context.Context, db Execer, table string) error {
+	t, err := QuoteIdent(table)
+	if err != nil {
+		return fmt.Errorf("drop notify changes of %s: %w", table, err)
+	}
+	if _, err := Exec(ctx, db, `DROP TRIGGER IF EXISTS change_notify ON `+t); err != nil {
+		return fmt.Errorf("drop notify changes of %s: %w", table, err)
+	}
+	return nil
+}
+
+// ListenChanges listens on channel on conn and calls f for every
+// ChangeEvent until ctx is done or f fails. conn is dedicated to listening
+// and shouldn't be reused afterwards.
+func ListenChanges(ctx context.Context, conn *sqlx.Conn, channel string, f func(ChangeEvent) error) error {
+	ch, err := QuoteIdent(channel)
+	if err != nil {
+		return fmt.Errorf("listen %s: %w", channel, err)
+	}
+	if _, err := Exec(ctx, conn, `LISTEN `+ch); err != nil {
+		return fmt.Errorf("listen %s: %w", channel, err)
+	}
+
+	return conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("LISTEN requires the pgx driver")
+		}
+		for {
+			n, err := c.Conn().WaitForNotification(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return fmt.Errorf("listen %s: %w", channel, err)
+			}
+
+			var ev ChangeEvent
+			if err := json.Unmarshal([]byte(n.Payload), &ev); err != nil {
+				return fmt.Errorf("listen %s: bad payload %q: %w", channel, n.Payload, err)
+			}
+			if err := f(ev); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,71 @@
+package dbutils
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type queryScopeKey struct{}
+
+// queryScope counts statements run within one request.
+type queryScope struct {
+	mu      sync.Mutex
+	queries map[string]*scopeQuery
+}
+
+type scopeQuery struct {
+	count    int
+	callers  map[string]struct{}
+	reported bool
+}
+
+// WithQueryScope starts a scope, usually a request, in which DetectNPlusOne
+// counts repeated statements.
+func WithQueryScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, queryScopeKey{}, &queryScope{queries: map[string]*scopeQuery{}})
+}
+
+// DetectNPlusOne returns a middleware, meant for development, logging
+// statements that run more than threshold times within a scope started
+// with WithQueryScope, with the call sites running them. Statements are
+// compared normalized, so the same query with different values counts as
+// one. It's reported once per scope.
+func DetectNPlusOne(threshold int) Middleware {
+	return func(next QueryFunc) QueryFunc {
+		return func(ctx context.Context, q *Query) error {
+			scope, ok := ctx.Value(queryScopeKey{}).(*queryScope)
+			if !ok {
+				return next(ctx, q)
+			}
+
+			norm := NormalizeQuery(q.SQL)
+			scope.mu.Lock()
+			sq := scope.queries[norm]
+			if sq == nil {
+				sq = &scopeQuery{callers: map[string]struct{}{}}
+				scope.queries[norm] = sq
+			}
+			sq.count++
+			sq.callers[q.Annotation()] = struct{}{}
+			var callers []string
+			if sq.count > threshold && !sq.reported {
+				sq.reported = true
+				for c := range sq.callers {
+					callers = append(callers, c)
+				}
+			}
+			count := sq.count
+			scope.mu.Unlock()
+
+			if callers != nil {
+				sort.Strings(callers)
+				log.Printf("possible N+1: %d runs of %s from %s", count, norm, strings.Join(callers, ", "))
+			}
+
+			return next(ctx, q)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jmoiron/sqlx/reflectx"
+	"go.uber.org/multierr"
+)
+
+// ScanOneToMany reads the rows of a join of parents with their children
+// into parents of type T, a struct or a pointer to one, and closes rows.
+// Rows with the same value of the key column are one parent, in the order
+// of their first rows. Children go to slice fields tagged as prefixes,
+// e.g. columns order_id and order_total of
+//
+//	Orders []Order `db:"order,prefix"`
+//
+// go to the fields id and total of an Order. A child with all columns NULL,
+// as from a LEFT JOIN of a parent without children, is skipped. Joining two
+// child tables repeats the children of each as the join does.
+func ScanOneToMany[T any](rows RowSet, key string) ([]T, error) {
+	return scanOneToMany[T](rows, key, mappingMode(context.Background()))
+}
+
+// SelectOneToMany runs query and reads the result with ScanOneToMany.
+func SelectOneToMany[T any](ctx context.Context, db Queryer, key, query string, args ...interface{}) (ret []T, err error) {
+	ctx, args = ApplyOptions(ctx, args)
+	err = RunQuery(ctx, db, query, args, func(ctx context.Context, q *Query) error {
+		rows, err := db.QueryxContext(ctx, q.SQL, q.Args...)
+		if err != nil {
+			return err
+		}
+		ret, err = scanOneToMany[T](rows, key, mappingMode(ctx))
+		return err
+	})
+	if err != nil {
+		return nil, sqlErr(err, query, args...)
+	}
+	return ret, nil
+}
+
+func scanOneToMany[T any](rows RowSet, key string, mode MappingMode) (ret []T, err error) {
+	defer func() {
+		err = multierr.Combine(err, closeRows(rows))
+	}()
+
+	m, err := newNestedMapper(reflect.TypeOf((*T)(nil)).Elem(), rows, key, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	index := map[interface{}]int{}
+	for rows.Next() {
+		var item T
+		k, children, err := m.scan(rows, reflect.ValueOf(&item).Elem())
+		if err != nil {
+			return nil, err
+		}
+		i, ok := index[k]
+		if !ok {
+			i = len(ret)
+			index[k] = i
+			ret = append(ret, item)
+		}
+		m.addChildren(reflect.ValueOf(&ret[i]).Elem(), children)
+	}
+	return ret, rows.Err()
+}
+
+// nestedMapper scans rows of a join into parent structs with child slices.
+type nestedMapper struct {
+	typ   reflect.Type
+	isPtr bool
+	// parent are the parent field indexes for the columns, nil for others.
+	parent [][]int
+	// arrays marks the parent columns needing arrayScanner.
+	arrays []bool
+	keyCol int
+	slices []childSlice
+	// child are the child fields for the columns, slice -1 for others.
+	child []childField
+}
+
+// childSlice is a slice field of the parent receiving children.
+type childSlice struct {
+	index []int
+	elem  reflect.Type
+	isPtr bool
+}
+
+type childField struct {
+	slice int
+	index []int
+	typ   reflect.Type
+}
+
+func newNestedMapper(t reflect.Type, rows RowSet, key string, mode MappingMode) (*nestedMapper, error) {
+	cols, err := rowColumns(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &nestedMapper{typ: t, keyCol: -1}
+	if t.Kind() == reflect.Ptr {
+		m.isPtr = true
+		m.typ = t.Elem()
+	}
+	if m.typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("scan one-to-many into %s, not a struct", t)
+	}
+
+	tm := idMapper.TypeMap(m.typ)
+	sm, err := structMapOf(m.typ)
+	if err != nil {
+		return nil, err
+	}
+
+	// Columns of the children by the prefixed names.
+	childCols := map[string]childField{}
+	for _, fi := range tm.Index {
+		if _, ok := fi.Options["prefix"]; !ok || fi.Field.Type.Kind() != reflect.Slice {
+			continue
+		}
+		cs := childSlice{index: fi.Index, elem: fi.Field.Type.Elem()}
+		if cs.elem.Kind() == reflect.Ptr {
+			cs.isPtr = true
+			cs.elem = cs.elem.Elem()
+		}
+		if cs.elem.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("prefix field %s of %s is not a slice of structs", fi.Field.Name, m.typ)
+		}
+		for _, cfi := range idMapper.TypeMap(cs.elem).Index {
+			if len(cfi.Children) > 0 && !reflect.PtrTo(cfi.Field.Type).Implements(scannerType) {
+				continue
+			}
+			childCols[fi.Name+"_"+strings.ReplaceAll(cfi.Path, ".", "_")] = childField{slice: len(m.slices), index: cfi.Index, typ: cfi.Field.Type}
+		}
+		m.slices = append(m.slices, cs)
+	}
+
+	_, isPgx := rows.(pgx.Rows)
+	m.parent = make([][]int, len(cols))
+	m.arrays = make([]bool, len(cols))
+	m.child = make([]childField, len(cols))
+	for i, c := range cols {
+		m.child[i].slice = -1
+		if cf, ok := childCols[c]; ok {
+			m.child[i] = cf
+			continue
+		}
+
+		fi, ok := tm.Names[c]
+		if !ok {
+			fi, ok = sm.prefixed[c]
+		}
+		if ok && fi != sm.extras {
+			m.parent[i] = fi.Index
+			m.arrays[i] = !isPgx && isArrayField(fi.Field.Type)
+			if c == key {
+				if !fi.Field.Type.Comparable() {
+					return nil, fmt.Errorf("key column %q of %s is not comparable", key, m.typ)
+				}
+				m.keyCol = i
+			}
+			continue
+		}
+
+		switch mode {
+		case MappingIgnore:
+		case MappingCollect:
+			collectUnmapped(m.typ.String(), c)
+		default:
+			return nil, fmt.Errorf("column %q has no field in %s", c, m.typ)
+		}
+	}
+	if m.keyCol < 0 {
+		return nil, fmt.Errorf("no key column %q for %s", key, m.typ)
+	}
+	return m, nil
+}
+
+// child is a child read from a row.
+type child struct {
+	slice int
+	value reflect.Value
+}
+
+// scan reads the current row into dest and returns the parent key and the
+// children of the row.
+func (m *nestedMapper) scan(rows RowSet, dest reflect.Value) (key interface{}, children []child, err error) {
+	v := dest
+	if m.isPtr {
+		v = reflect.New(m.typ)
+		dest.Set(v)
+		v = v.Elem()
+	}
+
+	ptrs := make([]interface{}, len(m.parent))
+	for i, idx := range m.parent {
+		switch {
+		case idx != nil:
+			ptrs[i] = reflectx.FieldByIndexes(v, idx).Addr().Interface()
+			if m.arrays[i] {
+				ptrs[i] = arrayScanner{ptrs[i]}
+			}
+		case m.child[i].slice >= 0:
+			// Pointers to pointers are nil for NULL.
+			ptrs[i] = reflect.New(reflect.PtrTo(m.child[i].typ)).Interface()
+		default:
+			ptrs[i] = new(interface{})
+		}
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, nil, err
+	}
+
+	values := make([]reflect.Value, len(m.slices))
+	for i, cf := range m.child {
+		if cf.slice < 0 {
+			continue
+		}
+		p := reflect.ValueOf(ptrs[i]).Elem()
+		if p.IsNil() {
+			continue
+		}
+		if !values[cf.slice].IsValid() {
+			values[cf.slice] = reflect.New(m.slices[cf.slice].elem).Elem()
+		}
+		reflectx.FieldByIndexes(values[cf.slice], cf.index).Set(p.Elem())
+	}
+	for i, cv := range values {
+		if cv.IsValid() {
+			children = append(children, child{slice: i, value: cv})
+		}
+	}
+
+	key = reflectx.FieldByIndexes(v, m.parent[m.keyCol]).Interface()
+	return key, children, nil
+}
+
+// addChildren appends children to the slices of parent.
+func (m *nestedMapper) addChildren(parent reflect.Value, children []child) {
+	if m.isPtr {
+		parent = parent.Elem()
+	}
+	for _, c := range children {
+		cs := m.slices[c.slice]
+		s := reflectx.FieldByIndexes(parent, cs.index)
+		v := c.value
+		if cs.isPtr {
+			v = v.Addr()
+		}
+		s.Set(reflect.Append(s, v))
+	}
+}
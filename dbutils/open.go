@@ -0,0 +1,273 @@
+package dbutils
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/multitracer"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/multierr"
+	"golang.org/x/sync/errgroup"
+)
+
+// Config describes how to connect to the database.
+type Config struct {
+	// ConnString is a PostgreSQL URL or keyword/value connection string.
+	// It may list several hosts, "host=db1,db2 target_session_attrs=read-write"
+	// connects to whichever of them is the primary; after a failover the
+	// connections are re-established the same way. A host starting with a
+	// slash, "host=/var/run/postgresql", is a Unix socket directory.
+	ConnString string
+
+	// SocketDir connects through the Unix socket in the directory, e.g.
+	// "/var/run/postgresql", instead of the hosts in ConnString. TLS isn't
+	// used on sockets. Without a user in ConnString the OS user name is used,
+	// as peer authentication requires.
+	SocketDir string
+
+	// SRV is a DNS SRV name, e.g. "_postgresql._tcp.db.example.com". When
+	// set, hosts and ports come from its records instead of ConnString and
+	// are re-resolved for new connections once the records' TTL expires.
+	// With sslmode=verify-full the certificates must cover the record
+	// targets, which are the names verified.
+	SRV string
+
+	// DialFunc opens the network connections instead of net.Dialer, e.g.
+	// through an SSH tunnel, a SOCKS proxy or a cloud connector. Host names
+	// are passed to it unresolved.
+	DialFunc pgconn.DialFunc
+
+	// Kerberos enables GSSAPI authentication instead of passwords.
+	Kerberos *Kerberos
+
+	// ClientCert is the TLS client certificate, e.g. one from a secrets
+	// manager, instead of the sslcert and sslkey files of ConnString.
+	ClientCert *tls.Certificate
+
+	// Tracer traces statements on the driver level, e.g. *tracelog.TraceLog.
+	Tracer pgx.QueryTracer
+
+	// MaxOpenConns limits connections to the database, callers over the
+	// limit wait for a free connection. 0 means no limit.
+	MaxOpenConns int
+	// MaxIdleConns is the number of connections kept open when idle.
+	MaxIdleConns int
+
+	// WarmUpConns connections are opened by Open, each checked with
+	// WarmUpQuery, "SELECT 1" if empty, so the first requests don't wait for
+	// connecting and auth or TLS misconfiguration fails at startup. It
+	// raises MaxIdleConns to keep them open.
+	WarmUpConns int
+	WarmUpQuery string
+
+	// AfterConnect hooks run in order on every new physical connection
+	// before it's handed out by the pool.
+	AfterConnect []ConnHook
+
+	// PgBouncer resets the session of each connection with DISCARD ALL
+	// before it's reused, dropping its prepared statements, temporary
+	// tables and settings, and runs the AfterConnect hooks again. It's for
+	// poolers such as PgBouncer which may hand server sessions used by
+	// other clients to the connections, where statements prepared by pgx
+	// fail with "prepared statement already exists". It costs a few round
+	// trips per use of a connection.
+	PgBouncer bool
+}
+
+// ConnHook initializes a session.
+type ConnHook func(ctx context.Context, conn *pgx.Conn) error
+
+// SetParams returns a hook setting session parameters such as search_path,
+// statement_timeout, application_name or custom GUCs.
+func SetParams(params map[string]string) ConnHook {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		for _, name := range names {
+			if _, err := conn.Exec(ctx, `SELECT set_config($1, $2, false)`, name, params[name]); err != nil {
+				return fmt.Errorf("set %s: %w", name, err)
+			}
+		}
+		return nil
+	}
+}
+
+// ExecOnConnect returns a hook running statements, e.g. "LOAD 'auto_explain'".
+func ExecOnConnect(stmts ...string) ConnHook {
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		for _, stmt := range stmts {
+			if _, err := conn.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("run %q: %w", stmt, err)
+			}
+		}
+		return nil
+	}
+}
+
+// Open connects to the database described by cfg using the pgx driver and
+// checks the connection.
+func Open(ctx context.Context, cfg Config) (*sqlx.DB, error) {
+	connConfig, err := pgx.ParseConfig(cfg.ConnString)
+	if err != nil {
+		return nil, fmt.Errorf("parse connection string: %w", err)
+	}
+	stmts := &stmtTracer{}
+	tracers := []pgx.QueryTracer{stmts}
+	var primary *primaryTracer
+	if targetsPrimary(&connConfig.Config) {
+		primary = &primaryTracer{}
+		tracers = append(tracers, primary)
+	}
+	if cfg.Tracer != nil {
+		tracers = append(tracers, cfg.Tracer)
+	}
+	connConfig.Tracer = multitracer.New(tracers...)
+
+	if cfg.SocketDir != "" {
+		if cfg.SRV != "" {
+			return nil, errors.New("SocketDir and SRV can't be used together")
+		}
+		connConfig.Host = cfg.SocketDir
+		connConfig.Fallbacks = nil
+		connConfig.TLSConfig = nil
+	}
+
+	if cfg.ClientCert != nil {
+		if connConfig.TLSConfig == nil {
+			return nil, errors.New("ClientCert requires TLS, check sslmode")
+		}
+		connConfig.TLSConfig = withClientCert(connConfig.TLSConfig, *cfg.ClientCert)
+		for _, fb := range connConfig.Fallbacks {
+			if fb.TLSConfig != nil {
+				fb.TLSConfig = withClientCert(fb.TLSConfig, *cfg.ClientCert)
+			}
+		}
+	}
+
+	if cfg.DialFunc != nil {
+		connConfig.DialFunc = cfg.DialFunc
+		connConfig.LookupFunc = func(ctx context.Context, host string) ([]string, error) {
+			return []string{host}, nil
+		}
+	}
+
+	if k := cfg.Kerberos; k != nil {
+		registerGSS(*k)
+		connConfig.KerberosSrvName = k.ServiceName
+		connConfig.KerberosSpn = k.SPN
+	}
+
+	var opts []stdlib.OptionOpenDB
+	if cfg.SRV != "" {
+		r := &srvResolver{name: cfg.SRV}
+		opts = append(opts, stdlib.OptionBeforeConnect(r.configure))
+	}
+
+	hooks := cfg.AfterConnect
+	db := stdlib.OpenDB(*connConfig, append(opts,
+		stdlib.OptionAfterConnect(func(ctx context.Context, conn *pgx.Conn) error {
+			stmts.markConn(conn)
+			if primary != nil {
+				primary.markConn(conn)
+			}
+			for _, h := range hooks {
+				if err := h(ctx, conn); err != nil {
+					return fmt.Errorf("initialize connection: %w", err)
+				}
+			}
+			return nil
+		}),
+		stdlib.OptionResetSession(func(ctx context.Context, conn *pgx.Conn) error {
+			if primary != nil {
+				if err := primary.dropDemotedConn(ctx, conn); err != nil {
+					return err
+				}
+			}
+			if cfg.PgBouncer {
+				return resetPooledSession(ctx, conn, hooks)
+			}
+			return stmts.flushStaleConn(ctx, conn)
+		}),
+	)...)
+
+	warmUp := cfg.WarmUpConns
+	if cfg.MaxOpenConns > 0 && warmUp > cfg.MaxOpenConns {
+		warmUp = cfg.MaxOpenConns
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	if idle := cfg.MaxIdleConns; idle > 0 || warmUp > 2 {
+		if idle < warmUp {
+			idle = warmUp
+		}
+		db.SetMaxIdleConns(idle)
+	}
+
+	dbh := sqlx.NewDb(db, "pgx")
+	if err := dbh.PingContext(ctx); err != nil {
+		return nil, multierr.Combine(fmt.Errorf("prepare db connection: %w", err), dbh.Close())
+	}
+	if err := warmUpPool(ctx, dbh, warmUp, cfg.WarmUpQuery); err != nil {
+		return nil, multierr.Combine(fmt.Errorf("warm up db connections: %w", err), dbh.Close())
+	}
+
+	return dbh, nil
+}
+
+func withClientCert(c *tls.Config, cert tls.Certificate) *tls.Config {
+	c = c.Clone()
+	c.Certificates = []tls.Certificate{cert}
+	return c
+}
+
+// warmUpPool opens n connections at once and runs query on each.
+func warmUpPool(ctx context.Context, db *sqlx.DB, n int, query string) error {
+	if n <= 0 {
+		return nil
+	}
+	if query == "" {
+		query = "SELECT 1"
+	}
+
+	conns := make([]*sqlx.Conn, n)
+	defer func() {
+		for _, c := range conns {
+			if c != nil {
+				c.Close()
+			}
+		}
+	}()
+
+	g, gctx := errgroup.WithContext(ctx)
+	for i := range conns {
+		i := i
+		g.Go(func() error {
+			c, err := db.Connx(gctx)
+			if err != nil {
+				return err
+			}
+			conns[i] = c
+			rows, err := c.QueryContext(gctx, query)
+			if err != nil {
+				return fmt.Errorf("connection %d: %w", i+1, err)
+			}
+			defer rows.Close()
+			for rows.Next() {
+			}
+			if err := rows.Err(); err != nil {
+				return fmt.Errorf("connection %d: %w", i+1, err)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
@@ -0,0 +1,148 @@
+package dbutils
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// QueryOption tunes a single call of a helper. Options are passed among the
+// query arguments, e.g.
+//
+//	dbutils.Get(ctx, db, &u, q, id, dbutils.OptTimeout(time.Second))
+//
+// and are removed from them before the statement runs. Each option has a
+// context equivalent covering all statements run with the context.
+type QueryOption func(ctx context.Context) context.Context
+
+// ApplyOptions removes the options from args and applies them to ctx. It's
+// exported for helpers built on other drivers.
+func ApplyOptions(ctx context.Context, args []interface{}) (context.Context, []interface{}) {
+	n := 0
+	for _, a := range args {
+		if _, ok := a.(QueryOption); ok {
+			n++
+		}
+	}
+	if n == 0 {
+		return ctx, args
+	}
+
+	rest := make([]interface{}, 0, len(args)-n)
+	for _, a := range args {
+		if o, ok := a.(QueryOption); ok {
+			ctx = o(ctx)
+			continue
+		}
+		rest = append(rest, a)
+	}
+	return ctx, rest
+}
+
+type timeoutKey struct{}
+
+// OptTimeout limits the statement to d, overriding SetDefaultTimeout. A
+// deadline of the context still applies if it's earlier.
+func OptTimeout(d time.Duration) QueryOption {
+	return func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, timeoutKey{}, d)
+	}
+}
+
+// OptMaxRows is WithMaxRows for one call.
+func OptMaxRows(n int) QueryOption {
+	return func(ctx context.Context) context.Context {
+		return WithMaxRows(ctx, n)
+	}
+}
+
+// OptNoLog is WithoutLog for one call.
+func OptNoLog() QueryOption {
+	return WithoutLog
+}
+
+// OptNoRetry turns off the retries after a connection loss for one call.
+func OptNoRetry() QueryOption {
+	return withoutRetry
+}
+
+// OptIdempotent is WithIdempotent for one call.
+func OptIdempotent() QueryOption {
+	return WithIdempotent
+}
+
+// OptReplicaOK is WithReplicaOK for one call.
+func OptReplicaOK() QueryOption {
+	return WithReplicaOK
+}
+
+// OptOpName is WithOpName for one call.
+func OptOpName(name string) QueryOption {
+	return func(ctx context.Context) context.Context {
+		return WithOpName(ctx, name)
+	}
+}
+
+// OptLogSample is WithLogSampling for one call.
+func OptLogSample(n int) QueryOption {
+	return func(ctx context.Context) context.Context {
+		return WithLogSampling(ctx, n)
+	}
+}
+
+// OptStrictGet is WithStrictGet for one call.
+func OptStrictGet(enabled bool) QueryOption {
+	return func(ctx context.Context) context.Context {
+		return WithStrictGet(ctx, enabled)
+	}
+}
+
+// OptMapNulls is WithMapNulls for one call.
+func OptMapNulls(n MapNulls) QueryOption {
+	return func(ctx context.Context) context.Context {
+		return WithMapNulls(ctx, n)
+	}
+}
+
+type noLogKey struct{}
+
+// WithoutLog suppresses logging of statements executed with ctx, e.g.
+// heartbeats. It's honored by LogSlowQueries and by loggers checking
+// LogSuppressed.
+func WithoutLog(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noLogKey{}, true)
+}
+
+// LogSuppressed tells if statements executed with ctx should not be logged.
+// Driver-level loggers get the context of the helper.
+func LogSuppressed(ctx context.Context) bool {
+	v, _ := ctx.Value(noLogKey{}).(bool)
+	return v
+}
+
+type logSampleKey struct{}
+
+// WithLogSampling lets only every n-th execution of each statement run with
+// ctx be logged, the others are suppressed as with WithoutLog. It's meant
+// for high-frequency statements such as heartbeats and queue polling.
+func WithLogSampling(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, logSampleKey{}, n)
+}
+
+// logSamples counts executions of sampled statements by normalized SQL.
+var logSamples sync.Map
+
+// sampleLog suppresses logging of the statement unless it's sampled.
+func sampleLog(ctx context.Context, query string) context.Context {
+	n, _ := ctx.Value(logSampleKey{}).(int)
+	if n <= 1 || LogSuppressed(ctx) {
+		return ctx
+	}
+
+	c, _ := logSamples.LoadOrStore(NormalizeQuery(query), new(uint64))
+	if atomic.AddUint64(c.(*uint64), 1)%uint64(n) != 1 {
+		return WithoutLog(ctx)
+	}
+	return ctx
+}
@@ -0,0 +1,101 @@
+package dbutils
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultPageLimit is the page size of SelectPage when the request has none.
+const DefaultPageLimit = 50
+
+// ListResult is a page of a list, the envelope to return from list APIs.
+type ListResult[T any] struct {
+	Items []T `json:"items"`
+	// Total is the number of rows in all pages, nil unless requested.
+	Total *int64 `json:"total,omitempty"`
+	// NextCursor requests the next page, empty on the last one.
+	NextCursor string `json:"nextCursor,omitempty"`
+	HasMore    bool   `json:"hasMore"`
+}
+
+// PageRequest selects a page of a list.
+type PageRequest struct {
+	Limit int
+	// Cursor is NextCursor of the previous page, empty for the first page.
+	Cursor string
+	// WithTotal counts all matching rows, which costs an extra query.
+	WithTotal bool
+}
+
+// ErrInvalidCursor is returned by SelectPage for a cursor it didn't make,
+// with the InvalidArgument code.
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+const cursorPrefix = "o:"
+
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(b), cursorPrefix) {
+		return 0, ErrInvalidCursor
+	}
+	offset, err := strconv.Atoi(string(b[len(cursorPrefix):]))
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
+
+// SelectPage selects a page of rows of b. b should be ordered by a unique
+// key for pages to be stable; its own limit and offset are ignored.
+func SelectPage[T any](ctx context.Context, db Queryer, b *SelectBuilder, page PageRequest) (ListResult[T], error) {
+	offset, err := decodeCursor(page.Cursor)
+	if err != nil {
+		return ListResult[T]{}, err
+	}
+	limit := page.Limit
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+
+	pb := *b
+	pb.limit, pb.offset = limit+1, offset
+	query, args, err := pb.Build()
+	if err != nil {
+		return ListResult[T]{}, fmt.Errorf("build page query: %w", err)
+	}
+
+	ret := ListResult[T]{Items: []T{}}
+	if err := Select(ctx, db, &ret.Items, query, args...); err != nil {
+		return ListResult[T]{}, err
+	}
+	if len(ret.Items) > limit {
+		ret.Items = ret.Items[:limit]
+		ret.HasMore = true
+		ret.NextCursor = encodeCursor(offset + limit)
+	}
+
+	if page.WithTotal {
+		query, args, err := b.BuildCount()
+		if err != nil {
+			return ListResult[T]{}, fmt.Errorf("build count query: %w", err)
+		}
+		var total int64
+		if err := Get(ctx, db, &total, query, args...); err != nil {
+			return ListResult[T]{}, err
+		}
+		ret.Total = &total
+	}
+
+	return ret, nil
+}
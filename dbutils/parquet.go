@@ -0,0 +1,153 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/multierr"
+)
+
+// parquetRowGroupSize is the buffered size after which a row group is
+// written out.
+const parquetRowGroupSize = 16 << 20
+
+// parquetColumn converts values of a result column to a Parquet type.
+type parquetColumn struct {
+	typ       int32
+	converted int32
+	convert   func(v interface{}) (interface{}, bool)
+}
+
+func parquetColumnFor(dbType string) parquetColumn {
+	switch strings.ToUpper(dbType) {
+	case "BOOL":
+		return parquetColumn{parquetBoolean, noConverted, func(v interface{}) (interface{}, bool) {
+			b, ok := v.(bool)
+			return b, ok
+		}}
+	case "INT2", "INT4":
+		return parquetColumn{parquetInt32, noConverted, func(v interface{}) (interface{}, bool) {
+			n, ok := v.(int64)
+			return int32(n), ok
+		}}
+	case "INT8":
+		return parquetColumn{parquetInt64, noConverted, func(v interface{}) (interface{}, bool) {
+			n, ok := v.(int64)
+			return n, ok
+		}}
+	case "FLOAT4":
+		return parquetColumn{parquetFloat, noConverted, func(v interface{}) (interface{}, bool) {
+			f, ok := v.(float64)
+			return float32(f), ok
+		}}
+	case "FLOAT8":
+		return parquetColumn{parquetDouble, noConverted, func(v interface{}) (interface{}, bool) {
+			f, ok := v.(float64)
+			return f, ok
+		}}
+	case "DATE":
+		return parquetColumn{parquetInt32, parquetDate, func(v interface{}) (interface{}, bool) {
+			t, ok := v.(time.Time)
+			return int32(t.Unix() / 86400), ok
+		}}
+	case "TIMESTAMP", "TIMESTAMPTZ":
+		return parquetColumn{parquetInt64, parquetTimestampMicros, func(v interface{}) (interface{}, bool) {
+			t, ok := v.(time.Time)
+			return t.UnixMicro(), ok
+		}}
+	case "BYTEA":
+		return parquetColumn{parquetByteArray, noConverted, func(v interface{}) (interface{}, bool) {
+			b, ok := v.([]byte)
+			return b, ok
+		}}
+	}
+
+	// numeric, text, json, uuid and everything else in its text form.
+	return parquetColumn{parquetByteArray, parquetUTF8, func(v interface{}) (interface{}, bool) {
+		switch v := v.(type) {
+		case string:
+			return v, true
+		case []byte:
+			return string(v), true
+		case time.Time:
+			return v.Format(time.RFC3339Nano), true
+		}
+		return fmt.Sprint(v), true
+	}}
+}
+
+// ExportParquet writes the result of the query to w as a Parquet file. The
+// schema follows the result columns: integers, floats, booleans, dates and
+// timestamps keep their types, bytea is binary and other columns are exported
+// as text. Rows are streamed and written out in row groups. The file is
+// uncompressed, compress it on the way if needed. Values encrypted with
+// Encrypt aren't exported, the export fails on them: they can only be
+// decrypted into the fields they were encrypted for.
+func ExportParquet(ctx context.Context, db Queryer, w io.Writer, query string, args ...interface{}) error {
+	ctx, args = ApplyOptions(ctx, args)
+	err := RunQuery(withoutRetry(ctx), db, query, args, func(ctx context.Context, q *Query) (err error) {
+		rows, err := db.QueryxContext(ctx, q.SQL, q.Args...)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err = multierr.Combine(err, rows.Close())
+		}()
+
+		return writeParquet(rows, w)
+	})
+	if err != nil {
+		return sqlErr(err, query, args...)
+	}
+
+	return nil
+}
+
+func writeParquet(rows *sqlx.Rows, w io.Writer) error {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+
+	cols := make([]parquetColumn, len(types))
+	bufs := make([]*parquetColumnBuf, len(types))
+	for i, t := range types {
+		cols[i] = parquetColumnFor(t.DatabaseTypeName())
+		bufs[i] = &parquetColumnBuf{name: t.Name(), typ: cols[i].typ, converted: cols[i].converted}
+	}
+	pw := newParquetWriter(w, bufs)
+
+	for rows.Next() {
+		rec, err := rows.SliceScan()
+		if err != nil {
+			return err
+		}
+		for i, v := range rec {
+			if v == nil {
+				continue
+			}
+			var ok bool
+			if rec[i], ok = cols[i].convert(v); !ok {
+				return fmt.Errorf("column %s: unexpected %T for %s", types[i].Name(), v, types[i].DatabaseTypeName())
+			}
+			if isEncryptedValue(rec[i]) {
+				return fmt.Errorf("column %s holds encrypted values, leave it out of the export", types[i].Name())
+			}
+		}
+		if err := pw.writeRow(rec); err != nil {
+			return fmt.Errorf("write parquet: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := pw.close(); err != nil {
+		return fmt.Errorf("write parquet: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,380 @@
+package dbutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// A minimal Parquet writer: flat schemas of optional columns, PLAIN
+// encoding, no compression, one data page per column chunk.
+
+// Parquet physical types.
+const (
+	parquetBoolean   = 0
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetFloat     = 4
+	parquetDouble    = 5
+	parquetByteArray = 6
+)
+
+// Parquet converted (logical) types, noConverted if the column has none.
+const (
+	noConverted            = -1
+	parquetUTF8            = 0
+	parquetDate            = 6
+	parquetTimestampMicros = 10
+)
+
+const (
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+	parquetOptional      = 1
+	parquetDataPage      = 0
+)
+
+var parquetMagic = []byte("PAR1")
+
+// parquetColumnBuf collects the values of a column for a row group.
+type parquetColumnBuf struct {
+	name      string
+	typ       int32
+	converted int32
+
+	defined []bool
+	values  bytes.Buffer
+	bools   []bool
+}
+
+func (c *parquetColumnBuf) add(v interface{}) {
+	c.defined = append(c.defined, v != nil)
+	if v == nil {
+		return
+	}
+
+	var b [8]byte
+	switch v := v.(type) {
+	case bool:
+		c.bools = append(c.bools, v)
+	case int32:
+		binary.LittleEndian.PutUint32(b[:4], uint32(v))
+		c.values.Write(b[:4])
+	case int64:
+		binary.LittleEndian.PutUint64(b[:], uint64(v))
+		c.values.Write(b[:])
+	case float32:
+		binary.LittleEndian.PutUint32(b[:4], math.Float32bits(v))
+		c.values.Write(b[:4])
+	case float64:
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+		c.values.Write(b[:])
+	case string:
+		binary.LittleEndian.PutUint32(b[:4], uint32(len(v)))
+		c.values.Write(b[:4])
+		c.values.WriteString(v)
+	case []byte:
+		binary.LittleEndian.PutUint32(b[:4], uint32(len(v)))
+		c.values.Write(b[:4])
+		c.values.Write(v)
+	}
+}
+
+func (c *parquetColumnBuf) size() int {
+	return c.values.Len() + len(c.bools)/8 + len(c.defined)/8
+}
+
+func (c *parquetColumnBuf) reset() {
+	c.defined = c.defined[:0]
+	c.values.Reset()
+	c.bools = c.bools[:0]
+}
+
+// page returns the data page: definition levels and values.
+func (c *parquetColumnBuf) page() []byte {
+	var page bytes.Buffer
+
+	// Definition levels as one bit-packed run of the RLE hybrid encoding,
+	// prefixed with its length.
+	var levels bytes.Buffer
+	groups := (len(c.defined) + 7) / 8
+	writeUvarint(&levels, uint64(groups)<<1|1)
+	levels.Write(packBits(c.defined, groups))
+
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(levels.Len()))
+	page.Write(n[:])
+	page.Write(levels.Bytes())
+
+	if c.typ == parquetBoolean {
+		page.Write(packBits(c.bools, (len(c.bools)+7)/8))
+	} else {
+		page.Write(c.values.Bytes())
+	}
+	return page.Bytes()
+}
+
+func packBits(bits []bool, n int) []byte {
+	packed := make([]byte, n)
+	for i, b := range bits {
+		if b {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+type parquetChunkMeta struct {
+	col    *parquetColumnBuf
+	offset int64
+	size   int64
+	values int64
+}
+
+type parquetRowGroup struct {
+	chunks []parquetChunkMeta
+	rows   int64
+	size   int64
+}
+
+// parquetWriter writes a Parquet file row group by row group.
+type parquetWriter struct {
+	w      io.Writer
+	offset int64
+	err    error
+
+	columns   []*parquetColumnBuf
+	rows      int64
+	groups    []parquetRowGroup
+	totalRows int64
+}
+
+func newParquetWriter(w io.Writer, columns []*parquetColumnBuf) *parquetWriter {
+	pw := &parquetWriter{w: w, columns: columns}
+	pw.write(parquetMagic)
+	return pw
+}
+
+func (pw *parquetWriter) write(b []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(b)
+	pw.offset += int64(n)
+	pw.err = err
+}
+
+// writeRow adds a row of values of the column types, nil for NULL.
+func (pw *parquetWriter) writeRow(row []interface{}) error {
+	size := 0
+	for i, v := range row {
+		pw.columns[i].add(v)
+		size += pw.columns[i].size()
+	}
+	pw.rows++
+
+	if size >= parquetRowGroupSize {
+		pw.flushRowGroup()
+	}
+	return pw.err
+}
+
+func (pw *parquetWriter) flushRowGroup() {
+	if pw.rows == 0 {
+		return
+	}
+
+	g := parquetRowGroup{rows: pw.rows}
+	for _, c := range pw.columns {
+		page := c.page()
+
+		var header thriftWriter
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(page)))
+		header.i32(3, int32(len(page)))
+		header.beginStruct(5)
+		header.i32(1, int32(len(c.defined)))
+		header.i32(2, parquetEncodingPlain)
+		header.i32(3, parquetEncodingRLE)
+		header.i32(4, parquetEncodingRLE)
+		header.endStruct()
+		header.stop()
+
+		meta := parquetChunkMeta{
+			col:    c,
+			offset: pw.offset,
+			size:   int64(header.buf.Len() + len(page)),
+			values: int64(len(c.defined)),
+		}
+		pw.write(header.buf.Bytes())
+		pw.write(page)
+
+		g.chunks = append(g.chunks, meta)
+		g.size += meta.size
+		c.reset()
+	}
+
+	pw.groups = append(pw.groups, g)
+	pw.totalRows += pw.rows
+	pw.rows = 0
+}
+
+// close writes the last row group and the footer.
+func (pw *parquetWriter) close() error {
+	pw.flushRowGroup()
+
+	var meta thriftWriter
+	meta.i32(1, 1)
+
+	meta.beginList(2, thriftStruct, len(pw.columns)+1)
+	meta.elemBegin()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(pw.columns)))
+	meta.elemEnd()
+	for _, c := range pw.columns {
+		meta.elemBegin()
+		meta.i32(1, c.typ)
+		meta.i32(3, parquetOptional)
+		meta.binary(4, c.name)
+		if c.converted != noConverted {
+			meta.i32(6, c.converted)
+		}
+		meta.elemEnd()
+	}
+
+	meta.i64(3, pw.totalRows)
+
+	meta.beginList(4, thriftStruct, len(pw.groups))
+	for _, g := range pw.groups {
+		meta.elemBegin()
+		meta.beginList(1, thriftStruct, len(g.chunks))
+		for _, ch := range g.chunks {
+			meta.elemBegin()
+			meta.i64(2, ch.offset)
+			meta.beginStruct(3)
+			meta.i32(1, ch.col.typ)
+			meta.beginList(2, thriftI32, 2)
+			meta.elemI32(parquetEncodingPlain)
+			meta.elemI32(parquetEncodingRLE)
+			meta.beginList(3, thriftBinary, 1)
+			meta.elemBinary(ch.col.name)
+			meta.i32(4, 0)
+			meta.i64(5, ch.values)
+			meta.i64(6, ch.size)
+			meta.i64(7, ch.size)
+			meta.i64(9, ch.offset)
+			meta.endStruct()
+			meta.elemEnd()
+		}
+		meta.i64(2, g.size)
+		meta.i64(3, g.rows)
+		meta.elemEnd()
+	}
+
+	meta.binary(6, "db-example dbutils")
+	meta.stop()
+
+	pw.write(meta.buf.Bytes())
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(meta.buf.Len()))
+	pw.write(n[:])
+	pw.write(parquetMagic)
+
+	return pw.err
+}
+
+// Thrift compact protocol types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs in the Thrift compact protocol, which is
+// what Parquet metadata uses.
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16
+	cur  int16
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if d := id - t.cur; d > 0 && d <= 15 {
+		t.buf.WriteByte(byte(d)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		writeUvarint(&t.buf, zigzag(int64(id)))
+	}
+	t.cur = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	writeUvarint(&t.buf, zigzag(int64(v)))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	writeUvarint(&t.buf, zigzag(v))
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.elemBinary(s)
+}
+
+func (t *thriftWriter) beginStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.elemBegin()
+}
+
+func (t *thriftWriter) endStruct() {
+	t.elemEnd()
+}
+
+func (t *thriftWriter) beginList(id int16, elemType byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elemType)
+	} else {
+		t.buf.WriteByte(0xf0 | elemType)
+		writeUvarint(&t.buf, uint64(n))
+	}
+}
+
+// elemBegin starts a struct that is a list element or a field value.
+func (t *thriftWriter) elemBegin() {
+	t.last = append(t.last, t.cur)
+	t.cur = 0
+}
+
+func (t *thriftWriter) elemEnd() {
+	t.stop()
+	t.cur = t.last[len(t.last)-1]
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftWriter) elemI32(v int32) {
+	writeUvarint(&t.buf, zigzag(int64(v)))
+}
+
+func (t *thriftWriter) elemBinary(s string) {
+	writeUvarint(&t.buf, uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+func (t *thriftWriter) stop() {
+	t.buf.WriteByte(0)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
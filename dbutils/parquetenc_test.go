@@ -0,0 +1,339 @@
+package dbutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// The reader below is independent of the writer: it decodes the Thrift
+// compact protocol generically and follows the Parquet format
+// specification, so the test catches mistakes made the same way on both
+// sides only if they're in the specification too.
+
+// thriftReader decodes Thrift compact protocol structs into maps from
+// field IDs to int64, float64, bool, string, []interface{} or nested maps.
+type thriftReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *thriftReader) byte() byte {
+	c := r.b[r.pos]
+	r.pos++
+	return c
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b[r.pos:])
+	if n <= 0 {
+		panic(fmt.Sprintf("bad varint at %d", r.pos))
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) varint() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1, 2:
+		// Booleans of fields are in the type; list elements are bytes.
+		return typ == 1
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, 5, 6:
+		return r.varint()
+	case 7:
+		v := math.Float64frombits(binary.LittleEndian.Uint64(r.b[r.pos:]))
+		r.pos += 8
+		return v
+	case 8:
+		n := int(r.uvarint())
+		s := string(r.b[r.pos : r.pos+n])
+		r.pos += n
+		return s
+	case 9, 10:
+		h := r.byte()
+		n, elemType := int(h>>4), h&0x0f
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			if elemType == 1 || elemType == 2 {
+				list[i] = r.byte() == 1
+				continue
+			}
+			list[i] = r.value(elemType)
+		}
+		return list
+	case 12:
+		return r.readStruct()
+	}
+	panic(fmt.Sprintf("unsupported thrift type %d at %d", typ, r.pos))
+}
+
+func (r *thriftReader) readStruct() map[int16]interface{} {
+	s := map[int16]interface{}{}
+	var id int16
+	for {
+		h := r.byte()
+		if h == 0 {
+			return s
+		}
+		if d := h >> 4; d != 0 {
+			id += int16(d)
+		} else {
+			id = int16(r.varint())
+		}
+		s[id] = r.value(h & 0x0f)
+	}
+}
+
+type parquetTestColumn struct {
+	name      string
+	typ       int64
+	converted int64 // -1 if none
+	values    []interface{}
+}
+
+type parquetTestFile struct {
+	meta    map[int16]interface{}
+	columns []parquetTestColumn
+	groups  []int64 // rows per row group
+}
+
+func readParquetForTest(t *testing.T, data []byte) *parquetTestFile {
+	t.Helper()
+	if !bytes.HasPrefix(data, parquetMagic) || !bytes.HasSuffix(data, parquetMagic) {
+		t.Fatal("missing PAR1 magic")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := data[len(data)-8-footerLen : len(data)-8]
+	fr := &thriftReader{b: footer}
+	meta := fr.readStruct()
+	if fr.pos != len(footer) {
+		t.Fatalf("footer is %d bytes, metadata %d", len(footer), fr.pos)
+	}
+
+	f := &parquetTestFile{meta: meta}
+	schema := meta[2].([]interface{})
+	root := schema[0].(map[int16]interface{})
+	if n := root[5].(int64); n != int64(len(schema)-1) {
+		t.Fatalf("root has %d children, schema %d columns", n, len(schema)-1)
+	}
+	for _, e := range schema[1:] {
+		el := e.(map[int16]interface{})
+		if el[3].(int64) != parquetOptional {
+			t.Errorf("column %s: repetition %d, want OPTIONAL", el[4], el[3])
+		}
+		c := parquetTestColumn{name: el[4].(string), typ: el[1].(int64), converted: -1}
+		if v, ok := el[6]; ok {
+			c.converted = v.(int64)
+		}
+		f.columns = append(f.columns, c)
+	}
+
+	var total int64
+	for _, g := range meta[4].([]interface{}) {
+		group := g.(map[int16]interface{})
+		rows := group[3].(int64)
+		f.groups = append(f.groups, rows)
+		total += rows
+
+		var groupSize int64
+		for i, ch := range group[1].([]interface{}) {
+			cm := ch.(map[int16]interface{})[3].(map[int16]interface{})
+			col := &f.columns[i]
+			if path := cm[3].([]interface{}); len(path) != 1 || path[0] != col.name {
+				t.Errorf("chunk %d: path %v, want %s", i, path, col.name)
+			}
+			if cm[1].(int64) != col.typ || cm[4].(int64) != 0 {
+				t.Errorf("column %s: chunk type %d codec %d", col.name, cm[1], cm[4])
+			}
+			if cm[5].(int64) != rows {
+				t.Errorf("column %s: %d values in a group of %d rows", col.name, cm[5], rows)
+			}
+
+			off := cm[9].(int64)
+			pr := &thriftReader{b: data, pos: int(off)}
+			header := pr.readStruct()
+			size := header[3].(int64)
+			if header[1].(int64) != parquetDataPage || header[2].(int64) != size {
+				t.Fatalf("column %s: page header %v", col.name, header)
+			}
+			if chunkSize := int64(pr.pos) - off + size; cm[6].(int64) != chunkSize || cm[7].(int64) != chunkSize {
+				t.Errorf("column %s: chunk size %d/%d, page takes %d", col.name, cm[6], cm[7], chunkSize)
+			}
+			groupSize += cm[7].(int64)
+
+			dp := header[5].(map[int16]interface{})
+			if dp[1].(int64) != rows || dp[2].(int64) != parquetEncodingPlain || dp[3].(int64) != parquetEncodingRLE {
+				t.Fatalf("column %s: data page header %v", col.name, dp)
+			}
+			col.values = append(col.values, decodeParquetPage(t, col.typ, int(rows), data[pr.pos:pr.pos+int(size)])...)
+		}
+		if group[2].(int64) != groupSize {
+			t.Errorf("row group size %d, chunks take %d", group[2], groupSize)
+		}
+	}
+	if meta[3].(int64) != total {
+		t.Errorf("file has %d rows, row groups %d", meta[3], total)
+	}
+	return f
+}
+
+// decodeParquetPage decodes a data page v1 of an optional column: the
+// definition levels in the RLE/bit-packed hybrid encoding of width 1,
+// prefixed with their length, then the PLAIN values of defined rows.
+func decodeParquetPage(t *testing.T, typ int64, n int, page []byte) []interface{} {
+	t.Helper()
+	levelsLen := int(binary.LittleEndian.Uint32(page))
+	lr := &thriftReader{b: page[4 : 4+levelsLen]}
+	var defined []bool
+	for len(defined) < n {
+		h := lr.uvarint()
+		if h&1 == 1 {
+			for i := 0; i < int(h>>1)*8; i++ {
+				if i%8 == 0 {
+					lr.pos++
+				}
+				defined = append(defined, lr.b[lr.pos-1]>>(i%8)&1 == 1)
+			}
+		} else {
+			v := lr.byte() == 1
+			for i := 0; i < int(h>>1); i++ {
+				defined = append(defined, v)
+			}
+		}
+	}
+	if lr.pos != levelsLen {
+		t.Fatalf("definition levels take %d of %d bytes", lr.pos, levelsLen)
+	}
+
+	vals := page[4+levelsLen:]
+	pos, nbool := 0, 0
+	out := make([]interface{}, n)
+	for i := range out {
+		if !defined[i] {
+			continue
+		}
+		switch typ {
+		case parquetBoolean:
+			out[i] = vals[nbool/8]>>(nbool%8)&1 == 1
+			nbool++
+		case parquetInt32:
+			out[i] = int32(binary.LittleEndian.Uint32(vals[pos:]))
+			pos += 4
+		case parquetInt64:
+			out[i] = int64(binary.LittleEndian.Uint64(vals[pos:]))
+			pos += 8
+		case parquetFloat:
+			out[i] = math.Float32frombits(binary.LittleEndian.Uint32(vals[pos:]))
+			pos += 4
+		case parquetDouble:
+			out[i] = math.Float64frombits(binary.LittleEndian.Uint64(vals[pos:]))
+			pos += 8
+		case parquetByteArray:
+			l := int(binary.LittleEndian.Uint32(vals[pos:]))
+			out[i] = string(vals[pos+4 : pos+4+l])
+			pos += 4 + l
+		default:
+			t.Fatalf("unexpected type %d", typ)
+		}
+	}
+	if typ == parquetBoolean {
+		pos = (nbool + 7) / 8
+	}
+	if pos != len(vals) {
+		t.Fatalf("values take %d of %d bytes", pos, len(vals))
+	}
+	return out
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	cols := []*parquetColumnBuf{
+		{name: "flag", typ: parquetBoolean, converted: noConverted},
+		{name: "small", typ: parquetInt32, converted: noConverted},
+		{name: "id", typ: parquetInt64, converted: noConverted},
+		{name: "ratio", typ: parquetFloat, converted: noConverted},
+		{name: "amount", typ: parquetDouble, converted: noConverted},
+		{name: "day", typ: parquetInt32, converted: parquetDate},
+		{name: "at", typ: parquetInt64, converted: parquetTimestampMicros},
+		{name: "name", typ: parquetByteArray, converted: parquetUTF8},
+		{name: "blob", typ: parquetByteArray, converted: noConverted},
+		{name: "empty", typ: parquetInt64, converted: noConverted},
+	}
+
+	var rows [][]interface{}
+	for i := 0; i < 30; i++ {
+		row := []interface{}{
+			i%3 == 0,
+			int32(-i),
+			int64(i) << 40,
+			float32(i) / 4,
+			float64(i) * 1.5,
+			int32(19000 + i),
+			int64(1700000000000000 + i),
+			fmt.Sprintf("имя %d", i),
+			string([]byte{byte(i), 0, 0xff}),
+			nil,
+		}
+		// NULLs in every column at different rows, whole bytes of NULLs
+		// in some.
+		for j := range row {
+			if (i+j)%4 == 0 || (j == 2 && i >= 8 && i < 16) {
+				row[j] = nil
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	var buf bytes.Buffer
+	pw := newParquetWriter(&buf, cols)
+	// Row groups of 5, 12 and 13 rows.
+	for i, row := range rows {
+		w := append([]interface{}(nil), row...)
+		if s, ok := w[8].(string); ok {
+			w[8] = []byte(s)
+		}
+		if err := pw.writeRow(w); err != nil {
+			t.Fatal(err)
+		}
+		if i == 4 || i == 16 {
+			pw.flushRowGroup()
+		}
+	}
+	if err := pw.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f := readParquetForTest(t, buf.Bytes())
+	if want := []int64{5, 12, 13}; !reflect.DeepEqual(f.groups, want) {
+		t.Errorf("row groups %v, want %v", f.groups, want)
+	}
+	if f.meta[1].(int64) != 1 || f.meta[6] != "db-example dbutils" {
+		t.Errorf("version %v, created_by %v", f.meta[1], f.meta[6])
+	}
+	if len(f.columns) != len(cols) {
+		t.Fatalf("%d columns, want %d", len(f.columns), len(cols))
+	}
+	for j, c := range f.columns {
+		if c.name != cols[j].name || c.typ != int64(cols[j].typ) || c.converted != int64(cols[j].converted) {
+			t.Errorf("column %d: %s type %d converted %d, want %s %d %d", j,
+				c.name, c.typ, c.converted, cols[j].name, cols[j].typ, cols[j].converted)
+		}
+		for i, row := range rows {
+			if !reflect.DeepEqual(c.values[i], row[j]) {
+				t.Errorf("row %d column %s: got %#v, want %#v", i, c.name, c.values[i], row[j])
+			}
+		}
+	}
+}
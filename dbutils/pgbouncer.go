@@ -0,0 +1,84 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+)
+
+// DeallocateAll drops the prepared statements of db, also from the
+// statement caches of pgx. For a *sqlx.DB or *sql.DB made by Open, the
+// other connections of the pool drop them when they're next taken from it;
+// for a *sqlx.Conn or *sql.Conn it's done right away.
+func DeallocateAll(ctx context.Context, db interface{}) error {
+	var conn *sql.Conn
+	pool := false
+	switch db := db.(type) {
+	case *sqlx.DB:
+		return DeallocateAll(ctx, db.DB)
+	case *sql.DB:
+		c, err := db.Conn(ctx)
+		if err != nil {
+			return fmt.Errorf("deallocate all: %w", err)
+		}
+		defer c.Close()
+		conn, pool = c, true
+	case *sqlx.Conn:
+		conn = db.Conn
+	case *sql.Conn:
+		conn = db
+	default:
+		return fmt.Errorf("deallocate all: unsupported %T", db)
+	}
+
+	err := conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("requires the pgx driver")
+		}
+		if pool {
+			// The connections of the pool flush their caches on reuse
+			// when its generation changes, as after a schema change.
+			t := connStmtTracer(c.Conn())
+			if t == nil {
+				return errors.New("requires a db made by Open")
+			}
+			atomic.AddInt64(&t.generation, 1)
+		}
+		if err := c.Conn().DeallocateAll(ctx); err != nil {
+			return err
+		}
+		markConnGeneration(c.Conn())
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("deallocate all: %w", err)
+	}
+	return nil
+}
+
+// resetPooledSession resets the session of conn to a fresh one and runs the
+// hooks initializing it again.
+func resetPooledSession(ctx context.Context, conn *pgx.Conn, hooks []ConnHook) error {
+	// The simple protocol, so DISCARD ALL itself isn't prepared.
+	if _, err := conn.PgConn().Exec(ctx, `DISCARD ALL`).ReadAll(); err != nil {
+		return fmt.Errorf("reset session: %w", err)
+	}
+	// Clears the caches of pgx referring to the discarded statements.
+	if err := conn.DeallocateAll(ctx); err != nil {
+		return fmt.Errorf("reset session: %w", err)
+	}
+	markConnGeneration(conn)
+	for _, h := range hooks {
+		if err := h(ctx, conn); err != nil {
+			return fmt.Errorf("initialize connection: %w", err)
+		}
+	}
+	return nil
+}
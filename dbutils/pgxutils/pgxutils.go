@@ -0,0 +1,221 @@
+// Package pgxutils provides the dbutils helpers on top of native pgx v5
+// connections and pools, bypassing database/sql.
+//
+// The functions have the same names and semantics as in dbutils, queries go
+// through the dbutils middleware chain and errors are *dbutils.Error.
+package pgxutils
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/multierr"
+
+	"db-example/dbutils"
+)
+
+// Querier is implemented by *pgx.Conn, *pgxpool.Pool and pgx.Tx.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// TxStarter is implemented by *pgx.Conn and *pgxpool.Pool.
+type TxStarter interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+func namedQuery(ctx context.Context, query string, arg interface{}) (nq string, args []interface{}, err error) {
+	if arg, err = dbutils.EncryptFields(ctx, arg); err != nil {
+		return "", nil, dbutils.QueryError(err, query)
+	}
+
+	nq, args, err = sqlx.Named(query, arg)
+	if err != nil {
+		return "", nil, dbutils.QueryError(err, query, args...)
+	}
+	return sqlx.Rebind(sqlx.DOLLAR, nq), args, nil
+}
+
+func Exec(ctx context.Context, db Querier, query string, args ...interface{}) (pgconn.CommandTag, error) {
+	ctx, args = dbutils.ApplyOptions(ctx, args)
+	var tag pgconn.CommandTag
+	err := dbutils.RunQuery(ctx, db, query, args, func(ctx context.Context, q *dbutils.Query) (err error) {
+		tag, err = db.Exec(ctx, q.SQL, q.Args...)
+		return err
+	})
+	if err != nil {
+		return tag, dbutils.QueryError(err, query, args...)
+	}
+
+	return tag, nil
+}
+
+func NamedExec(ctx context.Context, db Querier, query string, arg interface{}) (pgconn.CommandTag, error) {
+	nq, args, err := namedQuery(ctx, query, arg)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+
+	return Exec(ctx, db, nq, args...)
+}
+
+// rowToFunc scans structs by column name and everything else as a single
+// column value.
+func rowToFunc[T any]() pgx.RowToFunc[T] {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() == reflect.Struct && t != reflect.TypeOf(time.Time{}) &&
+		!reflect.PointerTo(t).Implements(reflect.TypeOf((*interface{ Scan(interface{}) error })(nil)).Elem()) {
+		return pgx.RowToStructByName[T]
+	}
+	return pgx.RowTo[T]
+}
+
+func Select[T any](ctx context.Context, db Querier, dest *[]T, query string, args ...interface{}) error {
+	ctx, args = dbutils.ApplyOptions(ctx, args)
+	err := dbutils.RunQuery(ctx, db, query, args, func(ctx context.Context, q *dbutils.Query) error {
+		rows, err := db.Query(ctx, q.SQL, q.Args...)
+		if err != nil {
+			return err
+		}
+		ret, err := pgx.CollectRows(rows, rowToFunc[T]())
+		if err != nil {
+			return err
+		}
+		*dest = ret
+		return nil
+	})
+	if err != nil {
+		return dbutils.QueryError(err, query, args...)
+	}
+
+	return nil
+}
+
+func NamedSelect[T any](ctx context.Context, db Querier, dest *[]T, query string, arg interface{}) error {
+	nq, args, err := namedQuery(ctx, query, arg)
+	if err != nil {
+		return err
+	}
+
+	return Select(ctx, db, dest, nq, args...)
+}
+
+func Get[T any](ctx context.Context, db Querier, dest *T, query string, args ...interface{}) error {
+	ctx, args = dbutils.ApplyOptions(ctx, args)
+	err := dbutils.RunQuery(ctx, db, query, args, func(ctx context.Context, q *dbutils.Query) error {
+		rows, err := db.Query(ctx, q.SQL, q.Args...)
+		if err != nil {
+			return err
+		}
+		ret, err := pgx.CollectOneRow(rows, rowToFunc[T]())
+		if err != nil {
+			return err
+		}
+		*dest = ret
+		return nil
+	})
+	if err != nil {
+		return dbutils.QueryError(err, query, args...)
+	}
+
+	return nil
+}
+
+func NamedGet[T any](ctx context.Context, db Querier, dest *T, query string, arg interface{}) error {
+	nq, args, err := namedQuery(ctx, query, arg)
+	if err != nil {
+		return err
+	}
+
+	return Get(ctx, db, dest, nq, args...)
+}
+
+func SelectMaps(ctx context.Context, db Querier, query string, args ...interface{}) (ret []map[string]interface{}, err error) {
+	ctx, args = dbutils.ApplyOptions(ctx, args)
+	err = dbutils.RunQuery(ctx, db, query, args, func(ctx context.Context, q *dbutils.Query) error {
+		rows, err := db.Query(ctx, q.SQL, q.Args...)
+		if err != nil {
+			return err
+		}
+		maps, err := pgx.CollectRows(rows, pgx.RowToMap)
+		if err != nil {
+			return err
+		}
+
+		ret = make([]map[string]interface{}, len(maps))
+		for i, m := range maps {
+			ret[i] = dbutils.TransformMap(ctx, m)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, dbutils.QueryError(err, query, args...)
+	}
+
+	return ret, nil
+}
+
+func NamedSelectMaps(ctx context.Context, db Querier, query string, arg interface{}) ([]map[string]interface{}, error) {
+	nq, args, err := namedQuery(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	return SelectMaps(ctx, db, nq, args...)
+}
+
+func GetMap(ctx context.Context, db Querier, query string, args ...interface{}) (ret map[string]interface{}, err error) {
+	ctx, args = dbutils.ApplyOptions(ctx, args)
+	err = dbutils.RunQuery(ctx, db, query, args, func(ctx context.Context, q *dbutils.Query) error {
+		rows, err := db.Query(ctx, q.SQL, q.Args...)
+		if err != nil {
+			return err
+		}
+		m, err := pgx.CollectOneRow(rows, pgx.RowToMap)
+		if err != nil {
+			return err
+		}
+
+		ret = dbutils.TransformMap(ctx, m)
+		return nil
+	})
+	if err != nil {
+		return nil, dbutils.QueryError(err, query, args...)
+	}
+
+	return ret, nil
+}
+
+func NamedGetMap(ctx context.Context, db Querier, query string, arg interface{}) (map[string]interface{}, error) {
+	nq, args, err := namedQuery(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetMap(ctx, db, nq, args...)
+}
+
+type TxFunc func(tx pgx.Tx) error
+
+func RunTx(ctx context.Context, db TxStarter, f TxFunc) (err error) {
+	tx, err := db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			err = multierr.Combine(err, tx.Rollback(ctx))
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	return f(tx)
+}
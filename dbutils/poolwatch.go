@@ -0,0 +1,122 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PoolSaturation describes callers queuing for connections during an
+// interval of RunPoolWatchdog.
+type PoolSaturation struct {
+	// WaitCount and WaitDuration are the number of waits for a connection
+	// and their total time in the interval.
+	WaitCount    int64
+	WaitDuration time.Duration
+	InUse        int
+	Open         int
+	MaxOpen      int
+	// Pending are the statements in flight at the end of the interval by
+	// operation name or caller, the most frequent first.
+	Pending []PendingOps
+}
+
+// PendingOps is the number of statements in flight of an operation.
+type PendingOps struct {
+	Name  string
+	Count int
+}
+
+func (s PoolSaturation) String() string {
+	ops := make([]string, len(s.Pending))
+	for i, p := range s.Pending {
+		ops[i] = fmt.Sprintf("%s=%d", p.Name, p.Count)
+	}
+	return fmt.Sprintf("%d waits for %s, %d/%d connections in use (max %d), pending: %s",
+		s.WaitCount, s.WaitDuration.Round(time.Millisecond), s.InUse, s.Open, s.MaxOpen, strings.Join(ops, " "))
+}
+
+// poolWatchTop is how many pending operations are reported.
+const poolWatchTop = 5
+
+// RunPoolWatchdog checks the pool of db every interval until ctx is done
+// and calls alert, or logs if it's nil, when callers waited for connections
+// longer than threshold in total during the interval, to catch pool
+// exhaustion before requests start timing out. While it runs, statements
+// in flight are counted by OpOrCallerClass to name the operations holding
+// or waiting for the connections.
+func RunPoolWatchdog(ctx context.Context, db interface{ Stats() sql.DBStats }, interval, threshold time.Duration, alert func(PoolSaturation)) {
+	if alert == nil {
+		alert = func(s PoolSaturation) {
+			log.Printf("connection pool saturated: %s", s)
+		}
+	}
+
+	var (
+		mu      sync.Mutex
+		pending = map[string]int{}
+	)
+	remove := Use(func(next QueryFunc) QueryFunc {
+		return func(ctx context.Context, q *Query) error {
+			name := OpOrCallerClass(ctx, q)
+			mu.Lock()
+			pending[name]++
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				if pending[name]--; pending[name] == 0 {
+					delete(pending, name)
+				}
+				mu.Unlock()
+			}()
+			return next(ctx, q)
+		}
+	})
+	defer remove()
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	prev := db.Stats()
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+
+		st := db.Stats()
+		s := PoolSaturation{
+			WaitCount:    st.WaitCount - prev.WaitCount,
+			WaitDuration: st.WaitDuration - prev.WaitDuration,
+			InUse:        st.InUse,
+			Open:         st.OpenConnections,
+			MaxOpen:      st.MaxOpenConnections,
+		}
+		prev = st
+		if s.WaitDuration <= threshold {
+			continue
+		}
+
+		mu.Lock()
+		for name, n := range pending {
+			s.Pending = append(s.Pending, PendingOps{Name: name, Count: n})
+		}
+		mu.Unlock()
+		sort.Slice(s.Pending, func(i, j int) bool {
+			if s.Pending[i].Count != s.Pending[j].Count {
+				return s.Pending[i].Count > s.Pending[j].Count
+			}
+			return s.Pending[i].Name < s.Pending[j].Name
+		})
+		if len(s.Pending) > poolWatchTop {
+			s.Pending = s.Pending[:poolWatchTop]
+		}
+		alert(s)
+	}
+}
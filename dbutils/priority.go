@@ -0,0 +1,44 @@
+package dbutils
+
+import "context"
+
+// Priority is the workload class of a statement.
+type Priority int
+
+const (
+	// Interactive is latency-sensitive request traffic, the default.
+	Interactive Priority = iota
+	// Batch is bulk work such as exports and backfills.
+	Batch
+)
+
+func (p Priority) String() string {
+	if p == Batch {
+		return "batch"
+	}
+	return "interactive"
+}
+
+type priorityKey struct{}
+
+// WithPriority sets the priority of statements executed with ctx.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityOf returns the priority set with WithPriority.
+func PriorityOf(ctx context.Context) Priority {
+	p, _ := ctx.Value(priorityKey{}).(Priority)
+	return p
+}
+
+// PriorityClass classifies statements by priority, "interactive" or
+// "batch". Combined with LimitConcurrencyByClass it keeps batch work from
+// taking all the connections:
+//
+//	dbutils.Use(dbutils.LimitConcurrencyByClass(dbutils.PriorityClass, map[string]int{
+//		"batch": 4,
+//	}))
+func PriorityClass(ctx context.Context, q *Query) string {
+	return PriorityOf(ctx).String()
+}
@@ -0,0 +1,270 @@
+package dbutils
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RangeBounds holds the flags shared by all range types. An unbounded side
+// ignores the corresponding Lower/Upper value.
+type RangeBounds struct {
+	LowerInclusive bool
+	UpperInclusive bool
+	LowerUnbounded bool
+	UpperUnbounded bool
+	Empty          bool
+}
+
+// Int4Range maps a PostgreSQL int4range.
+type Int4Range struct {
+	Lower, Upper int32
+	RangeBounds
+}
+
+// NumRange maps a PostgreSQL numrange.
+type NumRange struct {
+	Lower, Upper float64
+	RangeBounds
+}
+
+// TstzRange maps a PostgreSQL tstzrange.
+type TstzRange struct {
+	Lower, Upper time.Time
+	RangeBounds
+}
+
+type rangeValue interface {
+	driver.Valuer
+	pgRangeType() string
+}
+
+func (Int4Range) pgRangeType() string { return "int4range" }
+func (NumRange) pgRangeType() string  { return "numrange" }
+func (TstzRange) pgRangeType() string { return "tstzrange" }
+
+func (r *Int4Range) Scan(src interface{}) error {
+	return scanRange(src, &r.RangeBounds, func(lower, upper string) error {
+		var err error
+		if r.Lower, err = parseInt4Bound(lower, r.LowerUnbounded); err != nil {
+			return err
+		}
+		r.Upper, err = parseInt4Bound(upper, r.UpperUnbounded)
+		return err
+	})
+}
+
+func (r Int4Range) Value() (driver.Value, error) {
+	return formatRange(r.RangeBounds,
+		strconv.FormatInt(int64(r.Lower), 10),
+		strconv.FormatInt(int64(r.Upper), 10)), nil
+}
+
+func (r *NumRange) Scan(src interface{}) error {
+	return scanRange(src, &r.RangeBounds, func(lower, upper string) error {
+		var err error
+		if r.Lower, err = parseNumBound(lower, r.LowerUnbounded); err != nil {
+			return err
+		}
+		r.Upper, err = parseNumBound(upper, r.UpperUnbounded)
+		return err
+	})
+}
+
+func (r NumRange) Value() (driver.Value, error) {
+	return formatRange(r.RangeBounds,
+		strconv.FormatFloat(r.Lower, 'f', -1, 64),
+		strconv.FormatFloat(r.Upper, 'f', -1, 64)), nil
+}
+
+func (r *TstzRange) Scan(src interface{}) error {
+	return scanRange(src, &r.RangeBounds, func(lower, upper string) error {
+		var err error
+		if r.Lower, err = parseTstzBound(lower, r.LowerUnbounded); err != nil {
+			return err
+		}
+		r.Upper, err = parseTstzBound(upper, r.UpperUnbounded)
+		return err
+	})
+}
+
+func (r TstzRange) Value() (driver.Value, error) {
+	return formatRange(r.RangeBounds,
+		strconv.Quote(r.Lower.Format(time.RFC3339Nano)),
+		strconv.Quote(r.Upper.Format(time.RFC3339Nano))), nil
+}
+
+func scanRange(src interface{}, b *RangeBounds, parseBounds func(lower, upper string) error) error {
+	var s string
+	switch v := src.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case nil:
+		return errors.New("scan range: NULL value, use a pointer destination")
+	default:
+		return fmt.Errorf("scan range: unsupported source type %T", src)
+	}
+
+	lower, upper, err := parseRange(s, b)
+	if err != nil {
+		return fmt.Errorf("scan range %q: %w", s, err)
+	}
+	if b.Empty {
+		return nil
+	}
+	if err := parseBounds(lower, upper); err != nil {
+		return fmt.Errorf("scan range %q: %w", s, err)
+	}
+
+	return nil
+}
+
+// parseRange splits the text representation of a range, e.g. "[1,10)",
+// into its bounds and fills in the flags.
+func parseRange(s string, b *RangeBounds) (lower, upper string, err error) {
+	*b = RangeBounds{}
+
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, "empty") {
+		b.Empty = true
+		return "", "", nil
+	}
+	if len(s) < 3 {
+		return "", "", errors.New("malformed range")
+	}
+
+	switch s[0] {
+	case '[':
+		b.LowerInclusive = true
+	case '(':
+	default:
+		return "", "", errors.New("malformed range lower bound")
+	}
+	switch s[len(s)-1] {
+	case ']':
+		b.UpperInclusive = true
+	case ')':
+	default:
+		return "", "", errors.New("malformed range upper bound")
+	}
+
+	body := s[1 : len(s)-1]
+	lower, rest, err := readRangeBound(body)
+	if err != nil {
+		return "", "", err
+	}
+	if !strings.HasPrefix(rest, ",") {
+		return "", "", errors.New("malformed range: missing comma")
+	}
+	upper, rest, err = readRangeBound(rest[1:])
+	if err != nil {
+		return "", "", err
+	}
+	if rest != "" {
+		return "", "", errors.New("malformed range: trailing data")
+	}
+
+	b.LowerUnbounded = lower == ""
+	b.UpperUnbounded = upper == ""
+
+	return lower, upper, nil
+}
+
+func readRangeBound(s string) (bound, rest string, err error) {
+	if !strings.HasPrefix(s, `"`) {
+		i := strings.IndexByte(s, ',')
+		if i < 0 {
+			return s, "", nil
+		}
+		return s[:i], s[i:], nil
+	}
+
+	var buf strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", "", errors.New("malformed range: unterminated escape")
+			}
+			buf.WriteByte(s[i])
+		case '"':
+			if i+1 < len(s) && s[i+1] == '"' {
+				buf.WriteByte('"')
+				i++
+				continue
+			}
+			return buf.String(), s[i+1:], nil
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return "", "", errors.New("malformed range: unterminated quote")
+}
+
+func formatRange(b RangeBounds, lower, upper string) string {
+	if b.Empty {
+		return "empty"
+	}
+
+	var buf strings.Builder
+	if b.LowerInclusive && !b.LowerUnbounded {
+		buf.WriteByte('[')
+	} else {
+		buf.WriteByte('(')
+	}
+	if !b.LowerUnbounded {
+		buf.WriteString(lower)
+	}
+	buf.WriteByte(',')
+	if !b.UpperUnbounded {
+		buf.WriteString(upper)
+	}
+	if b.UpperInclusive && !b.UpperUnbounded {
+		buf.WriteByte(']')
+	} else {
+		buf.WriteByte(')')
+	}
+
+	return buf.String()
+}
+
+func parseInt4Bound(s string, unbounded bool) (int32, error) {
+	if unbounded {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(s, 10, 32)
+	return int32(v), err
+}
+
+func parseNumBound(s string, unbounded bool) (float64, error) {
+	if unbounded {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+var tstzLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999-07:00:00",
+	time.RFC3339Nano,
+}
+
+func parseTstzBound(s string, unbounded bool) (time.Time, error) {
+	if unbounded {
+		return time.Time{}, nil
+	}
+	for _, layout := range tstzLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("parse timestamptz bound %q", s)
+}
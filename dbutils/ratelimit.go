@@ -0,0 +1,108 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Rate is a token bucket configuration: PerSecond statements on average
+// with bursts of up to Burst statements. A zero PerSecond means no limit.
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   Rate
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(r Rate) *tokenBucket {
+	if r.Burst < 1 {
+		r.Burst = 1
+	}
+	return &tokenBucket{rate: r, tokens: float64(r.Burst), last: time.Now()}
+}
+
+// reserve takes a token and returns how long to wait before using it.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate.PerSecond <= 0 {
+		return 0
+	}
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate.PerSecond
+	if max := float64(b.rate.Burst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate.PerSecond * float64(time.Second))
+}
+
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	if b.rate.PerSecond > 0 {
+		b.tokens++
+	}
+	b.mu.Unlock()
+}
+
+func (b *tokenBucket) wait(ctx context.Context) error {
+	d := b.reserve()
+	if d == 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return fmt.Errorf("wait for database rate limit: %w", ctx.Err())
+	}
+}
+
+// OpNameClass classifies statements by their full op name.
+func OpNameClass(ctx context.Context, q *Query) string {
+	return q.OpName
+}
+
+// RateLimit returns a middleware throttling all statements to r.
+func RateLimit(r Rate) Middleware {
+	return RateLimitByClass(func(context.Context, *Query) string { return "" }, map[string]Rate{"": r})
+}
+
+// RateLimitByClass throttles each class of statements separately, e.g. with
+// OpNameClass per op name. Classes missing in limits aren't throttled.
+func RateLimitByClass(class ClassFunc, limits map[string]Rate) Middleware {
+	buckets := make(map[string]*tokenBucket, len(limits))
+	for c, r := range limits {
+		buckets[c] = newTokenBucket(r)
+	}
+
+	return func(next QueryFunc) QueryFunc {
+		return func(ctx context.Context, q *Query) error {
+			if b, ok := buckets[class(ctx, q)]; ok {
+				if err := b.wait(ctx); err != nil {
+					return err
+				}
+			}
+			return next(ctx, q)
+		}
+	}
+}
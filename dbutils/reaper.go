@@ -0,0 +1,70 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// ReapIdleTransactions terminates the sessions of the application idle in a
+// transaction for longer than threshold, since leaked transactions block
+// vacuum and migrations. It returns the terminated backends. A session that
+// got busy since it was found is left alone. Terminating requires
+// pg_signal_backend or the same role.
+func ReapIdleTransactions(ctx context.Context, db Queryer, applicationName string, threshold time.Duration) ([]Backend, error) {
+	if applicationName == "" {
+		return nil, errors.New("reap idle transactions: no application name")
+	}
+
+	var reaped []Backend
+	for _, state := range []string{"idle in transaction", "idle in transaction (aborted)"} {
+		backends, err := Activity(ctx, db, ActivityFilter{
+			ApplicationName: applicationName,
+			State:           state,
+			MinDuration:     threshold,
+		})
+		if err != nil {
+			return reaped, err
+		}
+
+		for _, b := range backends {
+			// CASE makes sure the state is checked before terminating.
+			q := `SELECT coalesce(bool_or(CASE WHEN state = $2 AND state_change = $3
+					THEN pg_terminate_backend(pid) ELSE false END), false)
+				FROM pg_stat_activity WHERE pid = $1`
+			var ok bool
+			if err := Get(ctx, db, &ok, q, b.PID, b.State, b.StateChange); err != nil {
+				return reaped, err
+			}
+			if ok {
+				reaped = append(reaped, b)
+			}
+		}
+	}
+	return reaped, nil
+}
+
+// RunIdleTransactionReaper calls ReapIdleTransactions every interval until
+// ctx is done, logging the terminated sessions.
+func RunIdleTransactionReaper(ctx context.Context, db Queryer, applicationName string, threshold, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+
+		reaped, err := ReapIdleTransactions(ctx, db, applicationName, threshold)
+		for _, b := range reaped {
+			log.Printf("terminated session %d idle in transaction for %s, last query: %s",
+				b.PID, b.Duration.Round(time.Second), NormalizeQuery(b.Query))
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("reap idle transactions: %v", err)
+		}
+	}
+}
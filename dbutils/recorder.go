@@ -0,0 +1,84 @@
+package dbutils
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// RecordedQuery is a line of the log written by RecordQueries.
+type RecordedQuery struct {
+	Time     time.Time     `json:"time"`
+	SQL      string        `json:"sql"`
+	Args     []interface{} `json:"args,omitempty"`
+	Duration time.Duration `json:"duration"`
+	OpName   string        `json:"op,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// RecordQueries returns a middleware writing every statement as a JSON line
+// to w, to be replayed later against another database. Arguments are
+// recorded as they are, so only record where the data may be kept.
+func RecordQueries(w io.Writer) Middleware {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+
+	return func(next QueryFunc) QueryFunc {
+		return func(ctx context.Context, q *Query) error {
+			start := time.Now()
+			err := next(ctx, q)
+
+			rec := RecordedQuery{
+				Time:     start,
+				SQL:      q.SQL,
+				Args:     q.Args,
+				Duration: time.Since(start),
+				OpName:   q.OpName,
+			}
+			if err != nil {
+				rec.Error = err.Error()
+			}
+
+			mu.Lock()
+			werr := enc.Encode(rec)
+			mu.Unlock()
+			if werr != nil {
+				log.Printf("record query: %v", werr)
+			}
+			return err
+		}
+	}
+}
+
+// ReadRecordedQueries calls f for each statement of a log written by
+// RecordQueries. JSON numbers are passed to f as int64 when integral.
+func ReadRecordedQueries(r io.Reader, f func(RecordedQuery) error) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	for {
+		var rec RecordedQuery
+		if err := dec.Decode(&rec); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		for i, a := range rec.Args {
+			n, ok := a.(json.Number)
+			if !ok {
+				continue
+			}
+			if v, err := n.Int64(); err == nil {
+				rec.Args[i] = v
+			} else if v, err := n.Float64(); err == nil {
+				rec.Args[i] = v
+			}
+		}
+		if err := f(rec); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package dbutils
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/multierr"
+)
+
+// NamedQuery is a query of a Registry.
+type NamedQuery struct {
+	Name string
+	SQL  string
+	// File and Line locate the query, for error messages.
+	File string
+	Line int
+
+	// The metadata of the header comments, enforced when the query is run
+	// with the methods of Registry.
+	Timeout time.Duration
+	MaxRows int
+	// Retryable is nil if unset, the default of SetConnRetries applies.
+	Retryable *bool
+	ReplicaOK bool
+}
+
+// Options returns the query options applying the metadata of q and naming
+// the operation after q, unless it's named already.
+func (q *NamedQuery) Options() []QueryOption {
+	opts := []QueryOption{func(ctx context.Context) context.Context {
+		if OpName(ctx) != "" {
+			return ctx
+		}
+		return WithOpName(ctx, q.Name)
+	}}
+	if q.Timeout > 0 {
+		opts = append(opts, OptTimeout(q.Timeout))
+	}
+	if q.MaxRows > 0 {
+		opts = append(opts, OptMaxRows(q.MaxRows))
+	}
+	if q.Retryable != nil {
+		if *q.Retryable {
+			opts = append(opts, OptIdempotent())
+		} else {
+			opts = append(opts, OptNoRetry())
+		}
+	}
+	if q.ReplicaOK {
+		opts = append(opts, OptReplicaOK())
+	}
+	return opts
+}
+
+// setMeta sets the metadata key of a header comment. Other comments are
+// ignored.
+func (q *NamedQuery) setMeta(key, value string) error {
+	var err error
+	switch strings.ReplaceAll(strings.ToLower(key), "-", "_") {
+	case "timeout":
+		q.Timeout, err = time.ParseDuration(value)
+	case "max_rows":
+		q.MaxRows, err = strconv.Atoi(value)
+	case "retryable":
+		var v bool
+		v, err = strconv.ParseBool(value)
+		q.Retryable = &v
+	case "replica_ok":
+		q.ReplicaOK, err = strconv.ParseBool(value)
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", key, value)
+	}
+	return nil
+}
+
+// Registry holds named queries kept in .sql files, typically embedded:
+//
+//	//go:embed queries/*.sql
+//	var queries embed.FS
+//
+//	var registry = dbutils.MustLoadRegistry(queries, "queries/*.sql")
+//
+// Each query starts with a "-- name: <name>" comment line and runs until
+// the next one. The comments right after the name may set the timeout,
+// max_rows, retryable and replica_ok metadata of the query:
+//
+//	-- name: ListOrders
+//	-- timeout: 2s
+//	-- max_rows: 1000
+//	-- replica_ok: true
+//	SELECT * FROM orders WHERE user_id = $1
+type Registry struct {
+	queries map[string]*NamedQuery
+}
+
+// LoadRegistry loads the queries of the files of fsys matching patterns,
+// "*.sql" if none.
+func LoadRegistry(fsys fs.FS, patterns ...string) (*Registry, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"*.sql"}
+	}
+
+	r := &Registry{queries: map[string]*NamedQuery{}}
+	for _, p := range patterns {
+		files, err := fs.Glob(fsys, p)
+		if err != nil {
+			return nil, fmt.Errorf("load queries: %w", err)
+		}
+		for _, f := range files {
+			data, err := fs.ReadFile(fsys, f)
+			if err != nil {
+				return nil, fmt.Errorf("load queries: %w", err)
+			}
+			if err := r.parse(f, string(data)); err != nil {
+				return nil, fmt.Errorf("load queries: %w", err)
+			}
+		}
+	}
+	return r, nil
+}
+
+// MustLoadRegistry is like LoadRegistry but panics on errors, for
+// initializing package variables from embedded files.
+func MustLoadRegistry(fsys fs.FS, patterns ...string) *Registry {
+	r, err := LoadRegistry(fsys, patterns...)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func (r *Registry) parse(file, data string) error {
+	var (
+		cur    *NamedQuery
+		body   []string
+		header bool
+	)
+	flush := func() error {
+		if cur == nil {
+			return nil
+		}
+		cur.SQL = strings.TrimSpace(strings.Join(body, "\n"))
+		if cur.SQL == "" {
+			return fmt.Errorf("%s:%d: query %s is empty", file, cur.Line, cur.Name)
+		}
+		r.queries[cur.Name] = cur
+		return nil
+	}
+
+	s := bufio.NewScanner(strings.NewReader(data))
+	s.Buffer(nil, 1<<20)
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		if name, ok := queryName(text); ok {
+			if err := flush(); err != nil {
+				return err
+			}
+			if prev, ok := r.queries[name]; ok {
+				return fmt.Errorf("%s:%d: query %s is already defined at %s:%d", file, line, name, prev.File, prev.Line)
+			}
+			cur, body, header = &NamedQuery{Name: name, File: file, Line: line}, nil, true
+			continue
+		}
+		if cur != nil && header {
+			comment, ok := strings.CutPrefix(strings.TrimSpace(text), "--")
+			if ok {
+				if key, value, ok := strings.Cut(comment, ":"); ok {
+					if err := cur.setMeta(strings.TrimSpace(key), strings.TrimSpace(value)); err != nil {
+						return fmt.Errorf("%s:%d: query %s: %w", file, line, cur.Name, err)
+					}
+				}
+				continue
+			}
+			header = false
+		}
+		if cur == nil {
+			if strings.TrimSpace(text) != "" && !strings.HasPrefix(strings.TrimSpace(text), "--") {
+				return fmt.Errorf("%s:%d: statement outside of a named query", file, line)
+			}
+			continue
+		}
+		body = append(body, text)
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return flush()
+}
+
+// queryName returns the name of a "-- name: <name>" line.
+func queryName(line string) (string, bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), "--")
+	if !ok {
+		return "", false
+	}
+	rest, ok = strings.CutPrefix(strings.TrimSpace(rest), "name:")
+	if !ok {
+		return "", false
+	}
+	name := strings.TrimSpace(rest)
+	return name, name != ""
+}
+
+// Query returns the query name.
+func (r *Registry) Query(name string) (*NamedQuery, bool) {
+	q, ok := r.queries[name]
+	return q, ok
+}
+
+// SQL returns the text of the query name, panicking if there's none, as
+// the names are fixed in the code.
+func (r *Registry) SQL(name string) string {
+	q, ok := r.queries[name]
+	if !ok {
+		panic(fmt.Sprintf("dbutils: no query %s", name))
+	}
+	return q.SQL
+}
+
+// query returns the query name and its arguments with the options of its
+// metadata first, so options passed by the caller take precedence.
+func (r *Registry) query(name string, args []interface{}) (string, []interface{}) {
+	q, ok := r.queries[name]
+	if !ok {
+		panic(fmt.Sprintf("dbutils: no query %s", name))
+	}
+	opts := q.Options()
+	all := make([]interface{}, 0, len(opts)+len(args))
+	for _, o := range opts {
+		all = append(all, o)
+	}
+	return q.SQL, append(all, args...)
+}
+
+// Select runs the query name like Select, enforcing its metadata.
+func (r *Registry) Select(ctx context.Context, db Queryer, dest interface{}, name string, args ...interface{}) error {
+	query, args := r.query(name, args)
+	return Select(ctx, db, dest, query, args...)
+}
+
+// Get runs the query name like Get, enforcing its metadata.
+func (r *Registry) Get(ctx context.Context, db Queryer, dest interface{}, name string, args ...interface{}) error {
+	query, args := r.query(name, args)
+	return Get(ctx, db, dest, query, args...)
+}
+
+// Exec runs the query name like Exec, enforcing its metadata.
+func (r *Registry) Exec(ctx context.Context, db Execer, name string, args ...interface{}) (sql.Result, error) {
+	query, args := r.query(name, args)
+	return Exec(ctx, db, query, args...)
+}
+
+// Names returns the names of the queries, sorted.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.queries))
+	for name := range r.queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate prepares every query on db, without running it, to catch syntax
+// errors and references to missing tables and columns before the queries
+// are first used, e.g. at startup or in a test against a dev database with
+// the current schema. It returns the errors of all the failed queries.
+func (r *Registry) Validate(ctx context.Context, db TxStarter) error {
+	var errs error
+	err := RunTx(ctx, db, func(tx *sqlx.Tx) error {
+		for _, name := range r.Names() {
+			q := r.queries[name]
+			// A failed statement aborts the transaction, so each is
+			// prepared in a savepoint.
+			if _, err := Exec(ctx, tx, `SAVEPOINT dbutils_validate`); err != nil {
+				return err
+			}
+			stmts := []string{`DEALLOCATE dbutils_validate`, `RELEASE SAVEPOINT dbutils_validate`}
+			if _, err := Exec(ctx, tx, `PREPARE dbutils_validate AS `+q.SQL); err != nil {
+				errs = multierr.Append(errs, fmt.Errorf("query %s (%s:%d): %w", q.Name, q.File, q.Line, err))
+				stmts = []string{`ROLLBACK TO SAVEPOINT dbutils_validate`, `RELEASE SAVEPOINT dbutils_validate`}
+			}
+			for _, stmt := range stmts {
+				if _, err := Exec(ctx, tx, stmt); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("validate queries: %w", err)
+	}
+	return errs
+}
@@ -0,0 +1,235 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Repo reads rows of a table into values of T, a struct with a field for
+// the id column, loading declared relationships on request. A relationship
+// is a slice field tagged with the child table and its column referencing
+// the parent's id:
+//
+//	Orders []Order `db:"-" rel:"orders,user_id"`
+//
+// The children are structs, or pointers to them, with fields for all their
+// columns; they may declare relationships of their own.
+type Repo[T any] struct {
+	db    Queryer
+	table string
+	with  []string
+}
+
+// NewRepo returns a repository of rows of table.
+func NewRepo[T any](db Queryer, table string) *Repo[T] {
+	return &Repo[T]{db: db, table: table}
+}
+
+// With returns a copy of the repository loading the relationships with the
+// paths, e.g. With("orders", "orders.items") loads the orders of the users
+// and the items of the orders. Each relationship takes one query with
+// "WHERE <column> = ANY(<ids>)" for all the rows read, so there are neither
+// per-row queries nor joins multiplying the rows.
+func (r *Repo[T]) With(paths ...string) *Repo[T] {
+	c := *r
+	c.with = append(append([]string(nil), r.with...), paths...)
+	return &c
+}
+
+// Get returns the row with the id. A missing row is a NotFound error.
+func (r *Repo[T]) Get(ctx context.Context, id interface{}) (T, error) {
+	var item T
+	q, args, err := NewSelect(r.table).Where(Eq("id", id)).Build()
+	if err != nil {
+		return item, fmt.Errorf("get from %s: %w", r.table, err)
+	}
+	if err := Get(ctx, r.db, &item, q, args...); err != nil {
+		return item, err
+	}
+
+	items := []T{item}
+	if err := loadRelations(ctx, r.db, reflect.ValueOf(items), r.with); err != nil {
+		return item, err
+	}
+	return items[0], nil
+}
+
+// Find returns the rows matching where, all if nil.
+func (r *Repo[T]) Find(ctx context.Context, where Cond) ([]T, error) {
+	b := NewSelect(r.table)
+	if where != nil {
+		b.Where(where)
+	}
+	q, args, err := b.Build()
+	if err != nil {
+		return nil, fmt.Errorf("find in %s: %w", r.table, err)
+	}
+
+	var items []T
+	if err := Select(ctx, r.db, &items, q, args...); err != nil {
+		return nil, err
+	}
+	if err := loadRelations(ctx, r.db, reflect.ValueOf(items), r.with); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// relation is a relationship field of a struct.
+type relation struct {
+	index  []int
+	table  string
+	column string
+	elem   reflect.Type
+}
+
+func relationOf(t reflect.Type, name string) (*relation, error) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("rel")
+		if !ok {
+			continue
+		}
+		table, column, ok := strings.Cut(tag, ",")
+		if !ok || table == "" || column == "" {
+			return nil, fmt.Errorf("rel tag %q of %s.%s is not \"table,column\"", tag, t, f.Name)
+		}
+		if table != name {
+			continue
+		}
+		if f.Type.Kind() != reflect.Slice || structType(f.Type.Elem()) == nil {
+			return nil, fmt.Errorf("relationship field %s.%s is not a slice of structs", t, f.Name)
+		}
+		return &relation{index: f.Index, table: table, column: column, elem: f.Type.Elem()}, nil
+	}
+	return nil, fmt.Errorf("%s has no relationship %q", t, name)
+}
+
+// loadRelations loads the relationships with the paths into the elements
+// of items, a slice of structs or pointers to them.
+func loadRelations(ctx context.Context, db Queryer, items reflect.Value, paths []string) error {
+	if len(paths) == 0 || items.Len() == 0 {
+		return nil
+	}
+
+	var names []string
+	nested := map[string][]string{}
+	for _, p := range paths {
+		name, rest, _ := strings.Cut(p, ".")
+		if _, ok := nested[name]; !ok {
+			names = append(names, name)
+			nested[name] = nil
+		}
+		if rest != "" {
+			nested[name] = append(nested[name], rest)
+		}
+	}
+
+	st := structType(items.Type().Elem())
+	for _, name := range names {
+		rel, err := relationOf(st, name)
+		if err != nil {
+			return err
+		}
+		if err := loadRelation(ctx, db, items, rel, nested[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadRelation(ctx context.Context, db Queryer, items reflect.Value, rel *relation, nested []string) error {
+	// Parents by ID, rows may repeat.
+	parents := map[interface{}][]reflect.Value{}
+	var ids reflect.Value
+	for i := 0; i < items.Len(); i++ {
+		v := reflect.Indirect(items.Index(i))
+		if !v.IsValid() {
+			continue
+		}
+		f := idMapper.FieldByName(v, "id")
+		if !f.IsValid() {
+			return fmt.Errorf("%s has no field for the id column", v.Type())
+		}
+		id := relKey(f)
+		if id == nil {
+			continue
+		}
+		if _, ok := parents[id]; !ok {
+			if !ids.IsValid() {
+				ids = reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(id)), 0, items.Len())
+			}
+			ids = reflect.Append(ids, reflect.ValueOf(id))
+		}
+		parents[id] = append(parents[id], v)
+	}
+	if !ids.IsValid() {
+		return nil
+	}
+
+	table, err := QuoteIdent(rel.table)
+	if err != nil {
+		return fmt.Errorf("load %s: %w", rel.table, err)
+	}
+	column, err := QuoteIdent(rel.column)
+	if err != nil {
+		return fmt.Errorf("load %s: %w", rel.table, err)
+	}
+	children := reflect.New(reflect.SliceOf(rel.elem))
+	q := `SELECT * FROM ` + table + ` WHERE ` + column + ` = ANY($1)`
+	if err := Select(ctx, db, children.Interface(), q, ids.Interface()); err != nil {
+		return err
+	}
+	children = children.Elem()
+	if err := loadRelations(ctx, db, children, nested); err != nil {
+		return err
+	}
+
+	for i := 0; i < children.Len(); i++ {
+		c := children.Index(i)
+		f := idMapper.FieldByName(reflect.Indirect(c), rel.column)
+		if !f.IsValid() {
+			return fmt.Errorf("%s has no field for the %s column", rel.elem, rel.column)
+		}
+		for _, p := range parents[relKey(f)] {
+			s := p.FieldByIndex(rel.index)
+			s.Set(reflect.Append(s, c))
+		}
+	}
+	return nil
+}
+
+// relKey returns the value of an ID field comparable with the other ID
+// fields, so that an int32 foreign key matches an int64 primary key. It's
+// nil for NULL.
+func relKey(f reflect.Value) interface{} {
+	if f.Kind() == reflect.Ptr {
+		if f.IsNil() {
+			return nil
+		}
+		f = f.Elem()
+	}
+	if f.Type().Implements(valuerType) {
+		v, err := f.Interface().(driver.Valuer).Value()
+		if err != nil || v == nil {
+			return nil
+		}
+		f = reflect.ValueOf(v)
+	}
+
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return f.Int()
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return int64(f.Uint())
+	case reflect.String:
+		return f.String()
+	}
+	if !f.Type().Comparable() {
+		return fmt.Sprint(f.Interface())
+	}
+	return f.Interface()
+}
@@ -0,0 +1,245 @@
+package dbutils
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CacheBackend stores the results cached with OptCache, serialized.
+// Backends shared by several instances of an app, such as RedisCache and
+// MemcacheCache, share the cached results between them.
+type CacheBackend interface {
+	// Get returns the value of key, false if there's none.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+func init() {
+	// The types of values of maps, the basic ones are registered by gob.
+	gob.Register(time.Time{})
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
+// dbCache is where the results of one database handle are cached.
+type dbCache struct {
+	backend   CacheBackend
+	namespace string
+}
+
+var resultCache = struct {
+	sync.RWMutex
+	backend CacheBackend
+	dbs     map[interface{}]dbCache
+}{backend: NewLRUCache(1000), dbs: map[interface{}]dbCache{}}
+
+// SetResultCache sets the default backend of the cache of OptCache, an
+// LRUCache of 1000 results by default. nil turns the caching off. The keys
+// of the results include the identity of the database handle in the
+// process, so the results of one database are never returned for another,
+// but neither are they shared between instances of an app; for that use
+// SetDBResultCache.
+func SetResultCache(b CacheBackend) {
+	resultCache.Lock()
+	resultCache.backend = b
+	resultCache.Unlock()
+}
+
+// SetDBResultCache sets the backend caching the results of statements run
+// on db, the handle passed to the helpers such as an *sqlx.DB or a
+// *Cluster, with the keys in namespace. Instances of an app connected to
+// the same database should use the same namespace to share the results,
+// different databases need different ones. A nil b turns caching off for
+// db. ClearDBResultCache undoes it.
+func SetDBResultCache(db interface{}, namespace string, b CacheBackend) {
+	resultCache.Lock()
+	resultCache.dbs[db] = dbCache{backend: b, namespace: namespace}
+	resultCache.Unlock()
+}
+
+// ClearDBResultCache makes db use the default backend again, e.g. when db
+// is closed.
+func ClearDBResultCache(db interface{}) {
+	resultCache.Lock()
+	delete(resultCache.dbs, db)
+	resultCache.Unlock()
+}
+
+// DefaultCacheTimeout limits each cache operation when not changed with
+// SetCacheTimeout.
+const DefaultCacheTimeout = 100 * time.Millisecond
+
+var cacheTimeout = int64(DefaultCacheTimeout)
+
+// SetCacheTimeout limits each get and set of a cached result to d, so that
+// a stalled cache server delays queries by at most d; the query then runs
+// as on a cache miss.
+func SetCacheTimeout(d time.Duration) {
+	atomic.StoreInt64(&cacheTimeout, int64(d))
+}
+
+// cacheContext bounds a cache operation by the cache timeout.
+func cacheContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, time.Duration(atomic.LoadInt64(&cacheTimeout)))
+}
+
+func resultCacheOf(db interface{}) dbCache {
+	resultCache.RLock()
+	defer resultCache.RUnlock()
+	if c, ok := resultCache.dbs[db]; ok {
+		return c
+	}
+	return dbCache{backend: resultCache.backend, namespace: fmt.Sprintf("%T@%p", db, db)}
+}
+
+type cacheTTLKey struct{}
+
+// WithCache makes Select, Get, SelectMaps and GetMap called with ctx cache
+// their results for ttl, 0 turns it off. Only reads outside of
+// transactions are cached. Results are serialized with encoding/gob, so
+// struct fields must be exported.
+func WithCache(ctx context.Context, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, cacheTTLKey{}, ttl)
+}
+
+// OptCache is WithCache for one call.
+func OptCache(ttl time.Duration) QueryOption {
+	return func(ctx context.Context) context.Context {
+		return WithCache(ctx, ttl)
+	}
+}
+
+// resultCacheTarget is where and for how long results are cached.
+type resultCacheTarget struct {
+	dbCache
+	ttl time.Duration
+}
+
+// resultCaching returns where the results of query on db are cached, if
+// they are.
+func resultCaching(ctx context.Context, db interface{}, query string) (*resultCacheTarget, bool) {
+	ttl, _ := ctx.Value(cacheTTLKey{}).(time.Duration)
+	if ttl <= 0 || !isReadOnlySQL(query) {
+		return nil, false
+	}
+	if _, ok := db.(*sqlx.Tx); ok {
+		return nil, false
+	}
+	c := resultCacheOf(db)
+	if c.backend == nil {
+		return nil, false
+	}
+	return &resultCacheTarget{dbCache: c, ttl: ttl}, true
+}
+
+// cachedResult returns a value of the type dest points to, from the cache
+// or loaded into it by load and cached. Cache failures are logged and the
+// result is loaded, as on a miss.
+func cachedResult(ctx context.Context, c *resultCacheTarget, kind string, dest interface{}, query string, args []interface{}, load func(ctx context.Context, dest interface{}) error) (reflect.Value, error) {
+	b, ttl := c.backend, c.ttl
+	t := reflect.TypeOf(dest).Elem()
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%#v", c.namespace, kind, t, query, args)))
+	key := "dbutils:" + hex.EncodeToString(sum[:])
+
+	v := reflect.New(t)
+	cctx, cancel := cacheContext(ctx)
+	data, ok, err := b.Get(cctx, key)
+	cancel()
+	if err != nil {
+		log.Printf("get cached result of %s: %v", NormalizeQuery(query), err)
+	}
+	if ok {
+		err := gob.NewDecoder(bytes.NewReader(data)).DecodeValue(v)
+		if err == nil {
+			return v.Elem(), nil
+		}
+		log.Printf("decode cached result of %s: %v", NormalizeQuery(query), err)
+		v = reflect.New(t)
+	}
+
+	if err := load(WithCache(ctx, 0), v.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).EncodeValue(v); err != nil {
+		log.Printf("encode result of %s for the cache: %v", NormalizeQuery(query), err)
+	} else {
+		cctx, cancel := cacheContext(ctx)
+		if err := b.Set(cctx, key, buf.Bytes(), ttl); err != nil {
+			log.Printf("cache result of %s: %v", NormalizeQuery(query), err)
+		}
+		cancel()
+	}
+	return v.Elem(), nil
+}
+
+// LRUCache is an in-process CacheBackend keeping the most recently used
+// results.
+type LRUCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRUCache returns a cache of up to size results.
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{size: size, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+// Get implements CacheBackend.
+func (c *LRUCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := el.Value.(*lruEntry)
+	if time.Now().After(e.expires) {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		return nil, false, nil
+	}
+	c.ll.MoveToFront(el)
+	return e.value, true, nil
+}
+
+// Set implements CacheBackend.
+func (c *LRUCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := &lruEntry{key: key, value: value, expires: time.Now().Add(ttl)}
+	if el, ok := c.items[key]; ok {
+		el.Value = e
+		c.ll.MoveToFront(el)
+		return nil
+	}
+	c.items[key] = c.ll.PushFront(e)
+	for c.ll.Len() > c.size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.items, el.Value.(*lruEntry).key)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrResultTooLarge is returned by SelectMaps when the estimated size of
+// the result passes the limit set with SetMaxResultBytes. Such results
+// should be read with SelectMapsEach.
+var ErrResultTooLarge = errors.New("result too large to buffer, use SelectMapsEach")
+
+var defaultMaxResultBytes int64
+
+// SetMaxResultBytes sets the estimated memory size of a SelectMaps result
+// after which it fails with ErrResultTooLarge. 0 means no limit.
+func SetMaxResultBytes(n int) {
+	atomic.StoreInt64(&defaultMaxResultBytes, int64(n))
+}
+
+type maxResultBytesKey struct{}
+
+// WithMaxResultBytes overrides the result size limit for helpers called
+// with ctx, 0 turns it off.
+func WithMaxResultBytes(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, maxResultBytesKey{}, n)
+}
+
+func maxResultBytes(ctx context.Context) int {
+	if n, ok := ctx.Value(maxResultBytesKey{}).(int); ok {
+		return n
+	}
+	return int(atomic.LoadInt64(&defaultMaxResultBytes))
+}
+
+func resultTooLargeErr(n int) error {
+	return fmt.Errorf("%w: more than %d bytes", ErrResultTooLarge, n)
+}
+
+// mapEntryOverhead roughly accounts for the map bucket, the key header and
+// the interface of an entry.
+const mapEntryOverhead = 48
+
+// mapSize estimates the memory taken by a map row.
+func mapSize(m map[string]interface{}) int {
+	size := mapEntryOverhead
+	for k, v := range m {
+		size += mapEntryOverhead + len(k)
+		switch v := v.(type) {
+		case string:
+			size += len(v)
+		case []byte:
+			size += len(v)
+		case time.Time:
+			size += 24
+		case nil:
+		default:
+			size += 8
+		}
+	}
+	return size
+}
@@ -0,0 +1,121 @@
+package dbutils
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var connRetries int32 = 2
+
+// SetConnRetries sets how many times a read-only or idempotent statement is
+// retried after its connection died mid-query. 0 disables the retries.
+func SetConnRetries(n int) {
+	atomic.StoreInt32(&connRetries, int32(n))
+}
+
+type idempotentKey struct{}
+
+// WithIdempotent marks statements executed with ctx as safe to repeat, so
+// writes are retried after a connection loss like reads are.
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+type noRetryKey struct{}
+
+// withoutRetry turns off the retries of statements with results handed to
+// the caller row by row, a repeated attempt would deliver rows twice.
+func withoutRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetryKey{}, true)
+}
+
+func isIdempotent(ctx context.Context, q *Query) bool {
+	if v, _ := ctx.Value(idempotentKey{}).(bool); v {
+		return true
+	}
+	return isReadOnlySQL(q.SQL)
+}
+
+// isReadOnlySQL recognizes plain SELECTs and WITH queries without writes.
+func isReadOnlySQL(query string) bool {
+	fields := strings.Fields(strings.ToUpper(NormalizeQuery(query)))
+	if len(fields) == 0 {
+		return false
+	}
+	switch fields[0] {
+	case "SELECT", "VALUES", "TABLE", "SHOW":
+	case "WITH":
+		for _, f := range fields {
+			switch f {
+			case "INSERT", "UPDATE", "DELETE", "MERGE":
+				return false
+			}
+		}
+	default:
+		return false
+	}
+	for _, f := range fields {
+		if f == "INTO" {
+			// SELECT ... INTO creates a table
+			return false
+		}
+	}
+	return true
+}
+
+// retryConnLoss repeats f when the connection was lost during a statement
+// that can safely run again. database/sql hands out a fresh connection for
+// the next attempt because the broken one fails validation.
+func retryConnLoss(db interface{}, f QueryFunc) QueryFunc {
+	return func(ctx context.Context, q *Query) error {
+		err := f(ctx, q)
+		if _, ok := db.(*sqlx.Tx); ok {
+			return err
+		}
+		if v, _ := ctx.Value(noRetryKey{}).(bool); v {
+			return err
+		}
+
+		retries := int(atomic.LoadInt32(&connRetries))
+		for attempt := 1; attempt <= retries && err != nil; attempt++ {
+			if classify(err) != Unavailable || ctx.Err() != nil || !isIdempotent(ctx, q) {
+				return err
+			}
+
+			log.Printf("connection lost, retrying (%d/%d) %s: %v", attempt, retries, q.Annotation(), err)
+			select {
+			case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+			case <-ctx.Done():
+				return err
+			}
+			err = f(ctx, q)
+		}
+		return err
+	}
+}
+
+func sliceLen(dest interface{}) int {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return 0
+	}
+	return v.Elem().Len()
+}
+
+// truncateSlice cuts the slice dest points to back to n elements, so a
+// repeated Select doesn't keep rows of a failed attempt.
+func truncateSlice(dest interface{}, n int) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return
+	}
+	if v = v.Elem(); v.Kind() == reflect.Slice && v.CanSet() && v.Len() > n {
+		v.SetLen(n)
+	}
+}
@@ -0,0 +1,109 @@
+package dbutils
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// RetryPolicy says how RetryReads repeats a failed read.
+type RetryPolicy struct {
+	// Attempts is the number of retries after the first failure.
+	Attempts int
+	// Backoff is the pause before the first retry, doubled for each next
+	// one up to MaxBackoff if set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable tells the failures worth another attempt, IsRetryable if
+	// nil: lost connections, timeouts, serialization failures, deadlocks
+	// and lock timeouts.
+	Retryable func(error) bool
+}
+
+type retryReadsKey struct{}
+
+// RetryReads re-executes the statement of one call per policy when it
+// fails transiently, if it's a read: SELECT and other statements without
+// writes. Writes are never repeated by it, even when marked idempotent, nor
+// are statements in transactions, which are aborted by the failure. It's
+// independent of the retries after connection losses of SetConnRetries.
+func RetryReads(policy RetryPolicy) QueryOption {
+	return func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, retryReadsKey{}, policy)
+	}
+}
+
+// RetryStats counts the retries of RetryReads since the start.
+type RetryStats struct {
+	// Retries is the number of repeated attempts.
+	Retries int64
+	// Recovered is the number of statements that succeeded after failing.
+	Recovered int64
+	// Exhausted is the number of statements failed after all the attempts.
+	Exhausted int64
+}
+
+var readRetryStats RetryStats
+
+// ReadRetryStats returns the counts of the retries of RetryReads, e.g. for
+// exporting as metrics.
+func ReadRetryStats() RetryStats {
+	return RetryStats{
+		Retries:   atomic.LoadInt64(&readRetryStats.Retries),
+		Recovered: atomic.LoadInt64(&readRetryStats.Recovered),
+		Exhausted: atomic.LoadInt64(&readRetryStats.Exhausted),
+	}
+}
+
+// retryReads repeats f for reads run with a RetryReads policy.
+func retryReads(db interface{}, f QueryFunc) QueryFunc {
+	return func(ctx context.Context, q *Query) error {
+		err := f(ctx, q)
+		if err == nil {
+			return nil
+		}
+		p, ok := ctx.Value(retryReadsKey{}).(RetryPolicy)
+		if !ok || p.Attempts <= 0 || !isReadOnlySQL(q.SQL) {
+			return err
+		}
+		if _, ok := db.(*sqlx.Tx); ok {
+			return err
+		}
+		if v, _ := ctx.Value(noRetryKey{}).(bool); v {
+			return err
+		}
+		retryable := p.Retryable
+		if retryable == nil {
+			retryable = IsRetryable
+		}
+
+		backoff := p.Backoff
+		for attempt := 1; attempt <= p.Attempts; attempt++ {
+			if !retryable(err) || ctx.Err() != nil {
+				break
+			}
+
+			log.Printf("retrying read (%d/%d) %s: %v", attempt, p.Attempts, q.Annotation(), err)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				atomic.AddInt64(&readRetryStats.Exhausted, 1)
+				return err
+			}
+			if backoff *= 2; p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+				backoff = p.MaxBackoff
+			}
+
+			atomic.AddInt64(&readRetryStats.Retries, 1)
+			if err = f(ctx, q); err == nil {
+				atomic.AddInt64(&readRetryStats.Recovered, 1)
+				return nil
+			}
+		}
+		atomic.AddInt64(&readRetryStats.Exhausted, 1)
+		return err
+	}
+}
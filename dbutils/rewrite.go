@@ -0,0 +1,56 @@
+package dbutils
+
+import (
+	"context"
+	"sync"
+)
+
+// Rewriter rewrites a statement right before it's sent to the server, e.g.
+// to add a tenant predicate, a comment or to use another table. It runs
+// for every statement of the helpers, in and out of transactions, and for
+// every retry of it.
+type Rewriter func(ctx context.Context, query string, args []interface{}) (string, []interface{}, error)
+
+var rewriters struct {
+	sync.RWMutex
+	list []*Rewriter
+}
+
+// AddRewriter appends r to the rewriters, which run in the order they were
+// added, after the middleware. Middleware, including loggers, sees the
+// statements as the callers wrote them. The returned function removes r.
+func AddRewriter(r Rewriter) (remove func()) {
+	p := &r
+
+	rewriters.Lock()
+	rewriters.list = append(rewriters.list, p)
+	rewriters.Unlock()
+
+	return func() {
+		rewriters.Lock()
+		defer rewriters.Unlock()
+
+		list := make([]*Rewriter, 0, len(rewriters.list))
+		for _, x := range rewriters.list {
+			if x != p {
+				list = append(list, x)
+			}
+		}
+		rewriters.list = list
+	}
+}
+
+// rewrite applies the rewriters to the statement.
+func rewrite(ctx context.Context, query string, args []interface{}) (string, []interface{}, error) {
+	rewriters.RLock()
+	list := rewriters.list
+	rewriters.RUnlock()
+
+	for _, r := range list {
+		var err error
+		if query, args, err = (*r)(ctx, query, args); err != nil {
+			return "", nil, err
+		}
+	}
+	return query, args, nil
+}
@@ -0,0 +1,282 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jmoiron/sqlx/reflectx"
+	"go.uber.org/multierr"
+)
+
+// RowSet is a result set of database/sql, sqlx or pgx, as read by ScanAll and
+// ScanOne.
+type RowSet interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+}
+
+// ScanAll reads the remaining rows into a slice of T and closes rows. T is
+// a struct, or a pointer to one, with the columns matched to its fields by
+// name as sqlx does; a column without a field is an error naming it unless
+// SetMappingMode allows it. T may also be a scannable type for
+// single-column results.
+func ScanAll[T any](rows RowSet) (ret []T, err error) {
+	defer func() {
+		err = multierr.Combine(err, closeRows(rows))
+	}()
+
+	m, err := newRowMapper(reflect.TypeOf((*T)(nil)).Elem(), rows, mappingMode(context.Background()))
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var item T
+		if err := m.scan(rows, reflect.ValueOf(&item).Elem()); err != nil {
+			return nil, err
+		}
+		ret = append(ret, item)
+	}
+	return ret, rows.Err()
+}
+
+// ScanOne reads the first row into a T like ScanAll does and closes rows.
+// An empty result is sql.ErrNoRows.
+func ScanOne[T any](rows RowSet) (item T, err error) {
+	defer func() {
+		err = multierr.Combine(err, closeRows(rows))
+	}()
+
+	m, err := newRowMapper(reflect.TypeOf((*T)(nil)).Elem(), rows, mappingMode(context.Background()))
+	if err != nil {
+		return item, err
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return item, err
+		}
+		return item, sql.ErrNoRows
+	}
+	err = m.scan(rows, reflect.ValueOf(&item).Elem())
+	return item, err
+}
+
+func rowColumns(rows RowSet) ([]string, error) {
+	switch r := rows.(type) {
+	case interface{ Columns() ([]string, error) }:
+		return r.Columns()
+	case pgx.Rows:
+		fds := r.FieldDescriptions()
+		cols := make([]string, len(fds))
+		for i, fd := range fds {
+			cols[i] = fd.Name
+		}
+		return cols, nil
+	}
+	return nil, fmt.Errorf("can't get the columns of %T", rows)
+}
+
+func closeRows(rows RowSet) error {
+	switch r := rows.(type) {
+	case interface{ Close() error }:
+		return r.Close()
+	case interface{ Close() }:
+		r.Close()
+	}
+	return nil
+}
+
+// rowMapper scans rows of a result into values of a type.
+type rowMapper struct {
+	typ       reflect.Type
+	isPtr     bool
+	scannable bool
+	// fields are the field indexes for the columns, nil for skipped ones.
+	fields [][]int
+	// extras is the index of the extras field, extraCols the names of the
+	// columns going there.
+	extras    []int
+	extraCols map[int]string
+	// arrays marks the columns going to slice fields, which need
+	// arrayScanner unless rows are pgx ones.
+	arrays []bool
+}
+
+func newRowMapper(t reflect.Type, rows RowSet, mode MappingMode) (*rowMapper, error) {
+	cols, err := rowColumns(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &rowMapper{typ: t}
+	if t.Kind() == reflect.Ptr {
+		m.isPtr = true
+		m.typ = t.Elem()
+	}
+	m.scannable = m.typ.Kind() != reflect.Struct || reflect.PtrTo(m.typ).Implements(scannerType) ||
+		len(idMapper.TypeMap(m.typ).Index) == 0
+
+	if m.scannable {
+		if len(cols) != 1 {
+			return nil, fmt.Errorf("scan %d columns into %s, a single value", len(cols), t)
+		}
+		return m, nil
+	}
+
+	tm := idMapper.TypeMap(m.typ)
+	sm, err := structMapOf(m.typ)
+	if err != nil {
+		return nil, err
+	}
+	extras := sm.extras
+	if extras != nil {
+		m.extras = extras.Index
+		m.extraCols = map[int]string{}
+	}
+
+	_, isPgx := rows.(pgx.Rows)
+	m.fields = make([][]int, len(cols))
+	for i, c := range cols {
+		fi, ok := tm.Names[c]
+		if !ok {
+			fi, ok = sm.prefixed[c]
+		}
+		if ok && fi != extras {
+			m.fields[i] = fi.Index
+			if !isPgx && isArrayField(fi.Field.Type) {
+				if m.arrays == nil {
+					m.arrays = make([]bool, len(cols))
+				}
+				m.arrays[i] = true
+			}
+			continue
+		}
+		if extras != nil {
+			m.extraCols[i] = c
+			continue
+		}
+
+		switch mode {
+		case MappingIgnore:
+		case MappingCollect:
+			collectUnmapped(m.typ.String(), c)
+		default:
+			return nil, fmt.Errorf("column %q has no field in %s", c, m.typ)
+		}
+	}
+	return m, nil
+}
+
+// scan reads the current row into dest, a settable value of the type.
+func (m *rowMapper) scan(rows RowSet, dest reflect.Value) error {
+	v := dest
+	if m.isPtr {
+		v = reflect.New(m.typ)
+		dest.Set(v)
+		v = v.Elem()
+	}
+
+	if m.scannable {
+		return rows.Scan(v.Addr().Interface())
+	}
+
+	ptrs := make([]interface{}, len(m.fields))
+	for i, idx := range m.fields {
+		if idx == nil {
+			ptrs[i] = new(interface{})
+			continue
+		}
+		ptrs[i] = reflectx.FieldByIndexes(v, idx).Addr().Interface()
+		if m.arrays != nil && m.arrays[i] {
+			ptrs[i] = arrayScanner{ptrs[i]}
+		}
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return err
+	}
+
+	if m.extras != nil {
+		extras := make(map[string]interface{}, len(m.extraCols))
+		for i, c := range m.extraCols {
+			extras[c] = *ptrs[i].(*interface{})
+		}
+		reflectx.FieldByIndexes(v, m.extras).Set(reflect.ValueOf(extras))
+	}
+	return nil
+}
+
+// selectRows is sqlx.SelectContext scanning with the mapping mode and
+// failing as soon as the result has more than max rows, if max is not 0.
+func selectRows(ctx context.Context, db Queryer, dest interface{}, max int, query string, args ...interface{}) (err error) {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("expected a pointer to a slice, got %T", dest)
+	}
+	dv = dv.Elem()
+
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = multierr.Combine(err, rows.Close())
+	}()
+
+	m, err := newRowMapper(dv.Type().Elem(), rows, mappingMode(ctx))
+	if err != nil {
+		return err
+	}
+
+	for n := 0; rows.Next(); n++ {
+		if max > 0 && n >= max {
+			return maxRowsErr(max)
+		}
+
+		item := reflect.New(dv.Type().Elem()).Elem()
+		if err := m.scan(rows, item); err != nil {
+			return err
+		}
+		dv.Set(reflect.Append(dv, item))
+	}
+
+	return rows.Err()
+}
+
+// getRow is sqlx.GetContext scanning with the mapping mode.
+func getRow(ctx context.Context, db Queryer, dest interface{}, query string, args ...interface{}) (err error) {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return fmt.Errorf("expected a pointer, got %T", dest)
+	}
+
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = multierr.Combine(err, rows.Close())
+	}()
+
+	m, err := newRowMapper(dv.Type().Elem(), rows, mappingMode(ctx))
+	if err != nil {
+		return err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	if err := m.scan(rows, dv.Elem()); err != nil {
+		return err
+	}
+	if strictGet(ctx) && rows.Next() {
+		return ErrTooManyRows
+	}
+	return rows.Err()
+}
@@ -0,0 +1,130 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SplitStatements splits a script into statements at semicolons outside of
+// quotes, dollar quotes and comments. Empty statements are dropped.
+func SplitStatements(script string) []string {
+	var ret []string
+	rs := []rune(script)
+	start := 0
+	add := func(end int) {
+		if s := strings.TrimSpace(string(rs[start:end])); s != "" {
+			ret = append(ret, s)
+		}
+	}
+
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case r == '-' && i+1 < len(rs) && rs[i+1] == '-':
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(rs) && rs[i+1] == '*':
+			end := strings.Index(string(rs[i+2:]), "*/")
+			if end < 0 {
+				i = len(rs)
+			} else {
+				i += 2 + len([]rune(string(rs[i+2:])[:end])) + 2
+			}
+		case r == '\'' || r == '"':
+			backslash := r == '\'' && i > 0 && (rs[i-1] == 'E' || rs[i-1] == 'e')
+			i = skipQuoted(rs, i, backslash)
+		case r == '$' && (i == 0 || !(unicode.IsLetter(rs[i-1]) || unicode.IsDigit(rs[i-1]) || rs[i-1] == '_')):
+			if end := dollarQuoteEnd(rs, i); end > 0 {
+				i = end
+			} else {
+				i++
+			}
+		case r == ';':
+			add(i)
+			i++
+			start = i
+		default:
+			i++
+		}
+	}
+	add(len(rs))
+	return ret
+}
+
+// ScriptOptions tune RunScript.
+type ScriptOptions struct {
+	// ContinueOnError runs each statement in a savepoint and goes on after
+	// a failure, e.g. for seed scripts creating objects that may already
+	// exist. The failures are in the report.
+	ContinueOnError bool
+}
+
+// StatementResult is the outcome of a statement of a script.
+type StatementResult struct {
+	// Index is the position of the statement in the script, from 0.
+	Index int
+	SQL   string
+	Err   error
+}
+
+// ScriptReport lists the outcomes of the statements RunScript ran.
+type ScriptReport struct {
+	Statements []StatementResult
+}
+
+// Failed returns the statements that failed.
+func (r *ScriptReport) Failed() []StatementResult {
+	var ret []StatementResult
+	for _, s := range r.Statements {
+		if s.Err != nil {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// RunScript runs the statements of script one by one in a transaction. By
+// default the first failure rolls it back and is returned; with
+// ContinueOnError the failed statements are rolled back to their savepoint
+// and the rest is committed. Statements which can't run in a transaction,
+// such as CREATE INDEX CONCURRENTLY, are not supported.
+func RunScript(ctx context.Context, db TxStarter, script string, opts ScriptOptions) (*ScriptReport, error) {
+	report := &ScriptReport{}
+	err := RunTx(ctx, db, func(tx *sqlx.Tx) error {
+		report.Statements = report.Statements[:0]
+		for i, stmt := range SplitStatements(script) {
+			if !opts.ContinueOnError {
+				_, err := Exec(ctx, tx, stmt)
+				report.Statements = append(report.Statements, StatementResult{Index: i, SQL: stmt, Err: err})
+				if err != nil {
+					return fmt.Errorf("statement %d: %w", i+1, err)
+				}
+				continue
+			}
+
+			if _, err := Exec(ctx, tx, `SAVEPOINT dbutils_script`); err != nil {
+				return err
+			}
+			_, err := Exec(ctx, tx, stmt)
+			report.Statements = append(report.Statements, StatementResult{Index: i, SQL: stmt, Err: err})
+			// The savepoint is released also after rolling back to it, or
+			// every failure would leave a subtransaction open until commit.
+			stmts := []string{`RELEASE SAVEPOINT dbutils_script`}
+			if err != nil {
+				stmts = []string{`ROLLBACK TO SAVEPOINT dbutils_script`, `RELEASE SAVEPOINT dbutils_script`}
+			}
+			for _, stmt := range stmts {
+				if _, err := Exec(ctx, tx, stmt); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return report, err
+}
@@ -0,0 +1,179 @@
+package dbutils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SecretSource fetches secrets, such as the database password or TLS keys,
+// from a secrets manager.
+type SecretSource interface {
+	// Secret returns the field key of the secret at path, or the whole
+	// secret if key is empty.
+	Secret(ctx context.Context, path, key string) (string, error)
+}
+
+var (
+	secretSourcesMu sync.Mutex
+	secretSources   = map[string]SecretSource{}
+)
+
+// RegisterSecretSource makes src resolve the references
+// "secret://name/path#key" in profiles, e.g. after
+//
+//	dbutils.RegisterSecretSource("vault", dbutils.NewVaultSource("", ""))
+//
+// "secret://vault/secret/data/db/prod#password" is the field password of
+// the secret secret/data/db/prod in Vault.
+func RegisterSecretSource(name string, src SecretSource) {
+	secretSourcesMu.Lock()
+	defer secretSourcesMu.Unlock()
+	secretSources[name] = src
+}
+
+const secretScheme = "secret://"
+
+// isSecretRef reports whether v refers to a secret.
+func isSecretRef(v string) bool {
+	return strings.HasPrefix(v, secretScheme)
+}
+
+// resolveSecret returns v or, if it refers to a secret, the secret.
+func resolveSecret(ctx context.Context, v string) (string, error) {
+	if !isSecretRef(v) {
+		return v, nil
+	}
+	ref := strings.TrimPrefix(v, secretScheme)
+	ref, key, _ := strings.Cut(ref, "#")
+	name, path, ok := strings.Cut(ref, "/")
+	if !ok || path == "" {
+		return "", fmt.Errorf("invalid secret reference %q, want secret://source/path#key", v)
+	}
+
+	secretSourcesMu.Lock()
+	src, ok := secretSources[name]
+	secretSourcesMu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("secret %s: unknown secret source %q", ref, name)
+	}
+	s, err := src.Secret(ctx, path, key)
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", ref, err)
+	}
+	return s, nil
+}
+
+// secretField returns the field key of a secret stored as a JSON object,
+// or the secret itself if key is empty.
+func secretField(secret, key string) (string, error) {
+	if key == "" {
+		return secret, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("field %s: secret isn't a JSON object", key)
+	}
+	return fieldString(fields, key)
+}
+
+func fieldString(fields map[string]interface{}, key string) (string, error) {
+	v, ok := fields[key]
+	if !ok {
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("no field %s, have %s", key, strings.Join(names, ", "))
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	return "", fmt.Errorf("field %s isn't a string", key)
+}
+
+// VaultSource reads secrets from HashiCorp Vault over its HTTP API. Paths
+// are API paths without /v1, e.g. "secret/data/db/prod" for the KV version
+// 2 engine mounted at secret.
+type VaultSource struct {
+	Addr   string
+	Token  string
+	Client *http.Client
+}
+
+// NewVaultSource returns a source reading from Vault at addr with token,
+// VAULT_ADDR and VAULT_TOKEN if empty.
+func NewVaultSource(addr, token string) *VaultSource {
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	return &VaultSource{Addr: addr, Token: token, Client: http.DefaultClient}
+}
+
+// Secret implements SecretSource.
+func (v *VaultSource) Secret(ctx context.Context, path, key string) (string, error) {
+	u, err := url.JoinPath(v.Addr, "v1", path)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := doJSON(v.Client, req, &resp); err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+
+	fields := resp.Data
+	// KV version 2 nests the fields with the metadata.
+	if data, ok := fields["data"].(map[string]interface{}); ok {
+		if _, ok := fields["metadata"]; ok {
+			fields = data
+		}
+	}
+	if key == "" {
+		return "", fmt.Errorf("vault: secret %s needs a field", path)
+	}
+	s, err := fieldString(fields, key)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	return s, nil
+}
+
+// doJSON sends req and decodes the JSON response into dest.
+func doJSON(client *http.Client, req *http.Request, dest interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, dest)
+}
@@ -0,0 +1,140 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+type seedColumn struct {
+	Name      string `db:"column_name"`
+	Type      string `db:"data_type"`
+	Generated bool   `db:"generated"`
+	Nullable  bool   `db:"nullable"`
+}
+
+// Seed inserts n rows of realistic fake data into table, e.g. for load
+// tests and demo environments. The columns are introspected: names, logins,
+// emails and phones are recognized by the column name, other values follow
+// the column type. Columns with defaults, such as serial IDs, are left to
+// the database. The rows are loaded with COPY.
+func Seed(ctx context.Context, db *sqlx.DB, table string, n int) (int64, error) {
+	schema, name := "", table
+	if i := strings.IndexByte(table, '.'); i >= 0 {
+		schema, name = table[:i], table[i+1:]
+	}
+
+	var cols []seedColumn
+	q := `SELECT column_name, data_type,
+			column_default IS NOT NULL OR is_identity = 'YES' AS generated,
+			is_nullable = 'YES' AS nullable
+		FROM information_schema.columns
+		WHERE table_schema = coalesce(nullif($1, ''), current_schema()) AND table_name = $2
+		ORDER BY ordinal_position`
+	if err := Select(ctx, db, &cols, q, schema, name); err != nil {
+		return 0, err
+	}
+	if len(cols) == 0 {
+		return 0, fmt.Errorf("seed %s: no such table", table)
+	}
+
+	var (
+		columns []string
+		gens    []func(*rand.Rand) interface{}
+	)
+	for _, c := range cols {
+		if c.Generated {
+			continue
+		}
+		gen := fakeValue(c)
+		if gen == nil {
+			return 0, fmt.Errorf("seed %s: can't generate %s values for %s", table, c.Type, c.Name)
+		}
+		columns = append(columns, c.Name)
+		gens = append(gens, gen)
+	}
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	rows := pgx.CopyFromSlice(n, func(int) ([]interface{}, error) {
+		row := make([]interface{}, len(gens))
+		for i, gen := range gens {
+			row[i] = gen(rnd)
+		}
+		return row, nil
+	})
+
+	return CopyFrom(ctx, db, table, columns, rows)
+}
+
+var (
+	fakeFirstNames = []string{"Alice", "Bob", "Carol", "Dave", "Eve", "Frank", "Grace", "Heidi",
+		"Ivan", "Judy", "Mallory", "Oscar", "Peggy", "Rupert", "Sybil", "Trent", "Victor", "Walter"}
+	fakeLastNames = []string{"Smith", "Johnson", "Williams", "Brown", "Jones", "Miller", "Davis",
+		"Wilson", "Moore", "Taylor", "Anderson", "Thomas", "Jackson", "White", "Harris", "Martin"}
+	fakeWords = []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel",
+		"india", "juliet", "kilo", "lima", "mike", "november", "oscar", "papa"}
+)
+
+// fakeValue returns a generator of values for the column, nil if its type is
+// not supported.
+func fakeValue(c seedColumn) func(*rand.Rand) interface{} {
+	name := strings.ToLower(c.Name)
+	typ := strings.ToLower(c.Type)
+
+	switch {
+	case strings.HasPrefix(typ, "timestamp"), typ == "date":
+		return func(r *rand.Rand) interface{} {
+			return time.Now().Add(-time.Duration(r.Int63n(int64(365 * 24 * time.Hour)))).Truncate(time.Microsecond)
+		}
+	case typ == "boolean":
+		return func(r *rand.Rand) interface{} { return r.Intn(2) == 1 }
+	case typ == "smallint":
+		return func(r *rand.Rand) interface{} { return int16(r.Intn(1 << 15)) }
+	case typ == "integer":
+		return func(r *rand.Rand) interface{} { return int32(r.Intn(1_000_000)) }
+	case typ == "bigint":
+		return func(r *rand.Rand) interface{} { return r.Int63n(1_000_000_000) }
+	case typ == "numeric", typ == "real", typ == "double precision":
+		return func(r *rand.Rand) interface{} { return float64(r.Intn(100_000)) / 100 }
+	case typ == "uuid":
+		return func(r *rand.Rand) interface{} {
+			var b [16]byte
+			r.Read(b[:])
+			b[6] = b[6]&0x0f | 0x40
+			b[8] = b[8]&0x3f | 0x80
+			return b
+		}
+	case typ == "json", typ == "jsonb":
+		return func(*rand.Rand) interface{} { return "{}" }
+	case typ == "text", strings.HasPrefix(typ, "character"):
+	default:
+		return nil
+	}
+
+	switch {
+	case strings.Contains(name, "email"):
+		return func(r *rand.Rand) interface{} { return fakeLogin(r) + "@example.com" }
+	case strings.Contains(name, "login"), strings.Contains(name, "username"), strings.Contains(name, "user_name"):
+		return func(r *rand.Rand) interface{} { return fakeLogin(r) }
+	case strings.Contains(name, "phone"):
+		return func(r *rand.Rand) interface{} { return fmt.Sprintf("+1555%07d", r.Intn(10_000_000)) }
+	case strings.Contains(name, "name"):
+		return func(r *rand.Rand) interface{} {
+			return fakeFirstNames[r.Intn(len(fakeFirstNames))] + " " + fakeLastNames[r.Intn(len(fakeLastNames))]
+		}
+	}
+	return func(r *rand.Rand) interface{} {
+		return fakeWords[r.Intn(len(fakeWords))] + " " + fakeWords[r.Intn(len(fakeWords))]
+	}
+}
+
+// fakeLogin returns e.g. "alice.smith42", unique enough for demo data.
+func fakeLogin(r *rand.Rand) string {
+	return fmt.Sprintf("%s.%s%d", strings.ToLower(fakeFirstNames[r.Intn(len(fakeFirstNames))]),
+		strings.ToLower(fakeLastNames[r.Intn(len(fakeLastNames))]), r.Intn(100_000))
+}
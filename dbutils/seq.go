@@ -0,0 +1,64 @@
+//go:build go1.23
+
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// errStopSeq ends SelectEach when the loop over Rows stops early.
+var errStopSeq = errors.New("iteration stopped")
+
+// Rows returns an iterator over the rows of the result, scanned into
+// T as ScanAll does, for range loops:
+//
+//	for u, err := range dbutils.Rows[User](ctx, db, `SELECT * FROM users`) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// The statement runs when the loop starts and the rows are read as it goes,
+// like with SelectEach; the result is closed when the loop ends, also on
+// break. An error is yielded once, with the zero T, as the last element.
+// It's available with Go 1.23 and later.
+func Rows[T any](ctx context.Context, db Queryer, query string, args ...interface{}) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		t := reflect.TypeOf((*T)(nil)).Elem()
+		var m *rowMapper
+		err := SelectEach(ctx, db, query, args, func(rows *sqlx.Rows) error {
+			if m == nil {
+				var err error
+				if m, err = newRowMapper(t, rows, mappingMode(ctx)); err != nil {
+					return err
+				}
+			}
+
+			var item T
+			if err := m.scan(rows, reflect.ValueOf(&item).Elem()); err != nil {
+				return err
+			}
+			dest := interface{}(&item)
+			if t.Kind() == reflect.Ptr {
+				dest = item
+			}
+			if err := DecryptFields(ctx, dest); err != nil {
+				return err
+			}
+			if !yield(item, nil) {
+				return errStopSeq
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopSeq) {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+//go:build go1.23
+
+package dbutils_test
+
+import (
+	"context"
+	"fmt"
+
+	"db-example/dbutils"
+	"db-example/dbutils/fake"
+)
+
+func ExampleRows() {
+	ctx := context.Background()
+	db := fake.New()
+	defer db.Close()
+
+	db.MustExecContext(ctx, "CREATE TABLE users (id bigint, name text)")
+	for i, name := range []string{"Ann", "Bob", "Cid"} {
+		db.MustExecContext(ctx, "INSERT INTO users (id, name) VALUES ($1, $2)", i+1, name)
+	}
+
+	type user struct {
+		ID   int64  `db:"id"`
+		Name string `db:"name"`
+	}
+	for u, err := range dbutils.Rows[user](ctx, db, "SELECT id, name FROM users ORDER BY id") {
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(u.ID, u.Name)
+		if u.Name == "Bob" {
+			break
+		}
+	}
+	// Output:
+	// 1 Ann
+	// 2 Bob
+}
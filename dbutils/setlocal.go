@@ -0,0 +1,73 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// paramName matches names of settings, including custom ones like
+// "app.user_id".
+var paramName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// SetLocal sets a parameter for the rest of the transaction tx, as SET LOCAL
+// does. The value is passed as a query argument, never spliced into SQL.
+func SetLocal(ctx context.Context, tx Execer, name, value string) error {
+	if !paramName.MatchString(name) {
+		return fmt.Errorf("invalid parameter name %q", name)
+	}
+	_, err := Exec(ctx, tx, `SELECT set_config($1, $2, true)`, name, value)
+	return err
+}
+
+// SetLocalStatementTimeout limits statements of the rest of the transaction
+// to d, 0 turns the limit off.
+func SetLocalStatementTimeout(ctx context.Context, tx Execer, d time.Duration) error {
+	return setLocalDuration(ctx, tx, "statement_timeout", d)
+}
+
+// SetLocalLockTimeout limits waiting for locks in the rest of the
+// transaction to d, 0 turns the limit off.
+func SetLocalLockTimeout(ctx context.Context, tx Execer, d time.Duration) error {
+	return setLocalDuration(ctx, tx, "lock_timeout", d)
+}
+
+// SetLocalIdleTimeout limits idling in the transaction to d, 0 turns the
+// limit off.
+func SetLocalIdleTimeout(ctx context.Context, tx Execer, d time.Duration) error {
+	return setLocalDuration(ctx, tx, "idle_in_transaction_session_timeout", d)
+}
+
+func setLocalDuration(ctx context.Context, tx Execer, name string, d time.Duration) error {
+	if d < 0 {
+		return fmt.Errorf("negative %s %s", name, d)
+	}
+	ms := d.Milliseconds()
+	if d > 0 && ms == 0 {
+		// Less than a millisecond would turn the limit off.
+		ms = 1
+	}
+	return SetLocal(ctx, tx, name, strconv.FormatInt(ms, 10))
+}
+
+// SetLocalWorkMem sets the memory of sorts and hashes of the rest of the
+// transaction, in bytes. The server rounds it to kilobytes and requires at
+// least 64kB.
+func SetLocalWorkMem(ctx context.Context, tx Execer, bytes int64) error {
+	if bytes < 64<<10 {
+		return fmt.Errorf("work_mem %d is less than 64kB", bytes)
+	}
+	return SetLocal(ctx, tx, "work_mem", strconv.FormatInt(bytes>>10, 10)+"kB")
+}
+
+// SetLocalRole switches to role for the rest of the transaction, e.g. to
+// apply row-level security policies of the role.
+func SetLocalRole(ctx context.Context, tx Execer, role string) error {
+	if role == "" {
+		return errors.New("empty role")
+	}
+	return SetLocal(ctx, tx, "role", role)
+}
@@ -0,0 +1,22 @@
+package dbutils
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// LogSlowQueries returns a middleware logging statements that took longer
+// than threshold. Statements are logged normalized, without values.
+func LogSlowQueries(threshold time.Duration) Middleware {
+	return func(next QueryFunc) QueryFunc {
+		return func(ctx context.Context, q *Query) error {
+			start := time.Now()
+			err := next(ctx, q)
+			if d := time.Since(start); d >= threshold && !LogSuppressed(ctx) {
+				log.Printf("slow query (%s) %s%s: %s", d, q.Annotation(), q.txAnnotation(), NormalizeQuery(q.SQL))
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package dbutils
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// defaultSRVTTL is used when the TTL of the records isn't known, i.e. when
+// the records came from the system resolver.
+const defaultSRVTTL = 30 * time.Second
+
+// srvResolver keeps the endpoints of an SRV name until their TTL expires.
+type srvResolver struct {
+	name string
+
+	mu      sync.Mutex
+	records []*net.SRV
+	expires time.Time
+}
+
+func (r *srvResolver) lookup(ctx context.Context) ([]*net.SRV, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.records != nil && time.Now().Before(r.expires) {
+		return r.records, nil
+	}
+
+	records, ttl, err := lookupSRV(ctx, r.name)
+	if err != nil {
+		if r.records != nil {
+			// Keep using the stale endpoints rather than failing to connect.
+			return r.records, nil
+		}
+		return nil, fmt.Errorf("resolve SRV %s: %w", r.name, err)
+	}
+
+	r.records, r.expires = records, time.Now().Add(ttl)
+	return records, nil
+}
+
+// configure points config at the resolved endpoints, the first one as the
+// main host and the rest as fallbacks. With TLS each endpoint verifies the
+// certificate against its own target name, not the SRV name of the
+// connection string.
+func (r *srvResolver) configure(ctx context.Context, config *pgx.ConnConfig) error {
+	records, err := r.lookup(ctx)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("resolve SRV %s: no records", r.name)
+	}
+
+	tlsConfig := config.TLSConfig
+	config.Host = strings.TrimSuffix(records[0].Target, ".")
+	config.Port = records[0].Port
+	config.TLSConfig = targetTLSConfig(tlsConfig, config.Host)
+	// config is a shallow copy, don't reuse the Fallbacks of the original.
+	config.Fallbacks = nil
+	for _, rec := range records[1:] {
+		host := strings.TrimSuffix(rec.Target, ".")
+		config.Fallbacks = append(config.Fallbacks, &pgconn.FallbackConfig{
+			Host:      host,
+			Port:      rec.Port,
+			TLSConfig: targetTLSConfig(tlsConfig, host),
+		})
+	}
+	return nil
+}
+
+// targetTLSConfig returns a copy of c verifying the server name host.
+func targetTLSConfig(c *tls.Config, host string) *tls.Config {
+	if c == nil {
+		return nil
+	}
+	c = c.Clone()
+	c.ServerName = host
+	return c
+}
+
+// lookupSRV asks the configured name servers directly to learn the record
+// TTL and falls back to the system resolver.
+func lookupSRV(ctx context.Context, name string) ([]*net.SRV, time.Duration, error) {
+	for _, server := range nameServers() {
+		records, ttl, err := querySRV(ctx, server, name)
+		if err == nil && len(records) > 0 {
+			return records, ttl, nil
+		}
+	}
+
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+	return records, defaultSRVTTL, err
+}
+
+func nameServers() []string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var servers []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers
+}
+
+func querySRV(ctx context.Context, server, name string) ([]*net.SRV, time.Duration, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	id := uint16(rand.Intn(1 << 16))
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	if err := b.StartQuestions(); err != nil {
+		return nil, 0, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: qname, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, 0, err
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", net.JoinHostPort(server, "53"))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, 0, err
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return nil, 0, err
+	}
+
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var p dnsmessage.Parser
+	h, err := p.Start(buf[:n])
+	if err != nil {
+		return nil, 0, err
+	}
+	if h.ID != id || h.Truncated || h.RCode != dnsmessage.RCodeSuccess {
+		return nil, 0, errors.New("unusable DNS response")
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, 0, err
+	}
+
+	var records []*net.SRV
+	var ttl uint32
+	for {
+		ah, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if ah.Type != dnsmessage.TypeSRV {
+			if err := p.SkipAnswer(); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		r, err := p.SRVResource()
+		if err != nil {
+			return nil, 0, err
+		}
+		records = append(records, &net.SRV{Target: r.Target.String(), Port: r.Port, Priority: r.Priority, Weight: r.Weight})
+		if len(records) == 1 || ah.TTL < ttl {
+			ttl = ah.TTL
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Priority != records[j].Priority {
+			return records[i].Priority < records[j].Priority
+		}
+		return records[i].Weight > records[j].Weight
+	})
+	return records, time.Duration(ttl) * time.Second, nil
+}
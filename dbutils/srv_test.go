@@ -0,0 +1,50 @@
+package dbutils
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestSRVResolverServerName(t *testing.T) {
+	r := &srvResolver{
+		name: "_postgresql._tcp.db.example.com",
+		records: []*net.SRV{
+			{Target: "pg1.example.com.", Port: 5432},
+			{Target: "pg2.example.com.", Port: 5433},
+		},
+		expires: time.Now().Add(time.Hour),
+	}
+
+	tlsConfig := &tls.Config{ServerName: "_postgresql._tcp.db.example.com"}
+	config := &pgx.ConnConfig{}
+	config.TLSConfig = tlsConfig
+	if err := r.configure(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Host != "pg1.example.com" || config.TLSConfig.ServerName != "pg1.example.com" {
+		t.Errorf("main host %s, server name %s, want pg1.example.com", config.Host, config.TLSConfig.ServerName)
+	}
+	if len(config.Fallbacks) != 1 {
+		t.Fatalf("%d fallbacks, want 1", len(config.Fallbacks))
+	}
+	if fb := config.Fallbacks[0]; fb.Host != "pg2.example.com" || fb.TLSConfig.ServerName != "pg2.example.com" {
+		t.Errorf("fallback host %s, server name %s, want pg2.example.com", fb.Host, fb.TLSConfig.ServerName)
+	}
+	if tlsConfig.ServerName != "_postgresql._tcp.db.example.com" {
+		t.Errorf("original TLS config modified, server name %s", tlsConfig.ServerName)
+	}
+
+	config = &pgx.ConnConfig{}
+	if err := r.configure(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if config.TLSConfig != nil || config.Fallbacks[0].TLSConfig != nil {
+		t.Error("TLS enabled for a plain connection")
+	}
+}
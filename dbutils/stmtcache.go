@@ -0,0 +1,110 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
+)
+
+// stmtTracer keeps the statement cache generation of one pool. It's bumped
+// whenever a statement fails because the schema changed under a cached
+// prepared statement. Connections of the pool with an older generation
+// flush their caches before they're reused.
+type stmtTracer struct {
+	generation int64
+}
+
+const (
+	generationKey = "dbutils.schemaGeneration"
+	stmtTracerKey = "dbutils.stmtTracer"
+)
+
+func (t *stmtTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return ctx
+}
+
+func (t *stmtTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	if isStaleStatementErr(data.Err) {
+		atomic.AddInt64(&t.generation, 1)
+	}
+}
+
+func isStaleStatementErr(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	switch pgErr.Code {
+	case "0A000":
+		// feature_not_supported, raised for changed result types
+		return strings.Contains(pgErr.Message, "cached plan must not change result type")
+	case "26000":
+		// invalid_sql_statement_name: the prepared statement is gone
+		return true
+	case "42P05":
+		// duplicate_prepared_statement: the session was used by another
+		// client of a pooler
+		return true
+	}
+	return false
+}
+
+// retryStaleStatement retries f once when the statement cache turned out to
+// be stale, e.g. after a migration changed a table. Statements inside a
+// transaction can't be retried since the transaction is aborted.
+func retryStaleStatement(db interface{}, f QueryFunc) QueryFunc {
+	return func(ctx context.Context, q *Query) error {
+		err := f(ctx, q)
+		if err == nil || !isStaleStatementErr(err) {
+			return err
+		}
+
+		if _, ok := db.(*sqlx.Tx); ok {
+			return err
+		}
+
+		log.Printf("statement cache is stale, retrying %s: %v", q.Annotation(), err)
+		return f(ctx, q)
+	}
+}
+
+func (t *stmtTracer) markConn(conn *pgx.Conn) {
+	conn.PgConn().CustomData()[stmtTracerKey] = t
+	conn.PgConn().CustomData()[generationKey] = atomic.LoadInt64(&t.generation)
+}
+
+// connStmtTracer returns the tracer of the pool conn belongs to, nil for
+// connections not made by Open.
+func connStmtTracer(conn *pgx.Conn) *stmtTracer {
+	t, _ := conn.PgConn().CustomData()[stmtTracerKey].(*stmtTracer)
+	return t
+}
+
+// markConnGeneration records that the caches of conn are up to date with
+// its pool.
+func markConnGeneration(conn *pgx.Conn) {
+	if t := connStmtTracer(conn); t != nil {
+		t.markConn(conn)
+	}
+}
+
+// flushStaleConn drops the prepared statements of conn if they predate the
+// last schema change detected in the pool.
+func (t *stmtTracer) flushStaleConn(ctx context.Context, conn *pgx.Conn) error {
+	gen := atomic.LoadInt64(&t.generation)
+	if connGen, _ := conn.PgConn().CustomData()[generationKey].(int64); connGen == gen {
+		return nil
+	}
+
+	if err := conn.DeallocateAll(ctx); err != nil {
+		return err
+	}
+	conn.PgConn().CustomData()[generationKey] = gen
+	return nil
+}
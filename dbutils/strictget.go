@@ -0,0 +1,90 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"sync/atomic"
+
+	"go.uber.org/multierr"
+)
+
+// ErrTooManyRows is returned by Get and GetMap in strict mode when the
+// query matched more than one row.
+var ErrTooManyRows = errors.New("more than one row in result")
+
+var strictGets int32
+
+// SetStrictGet makes Get and GetMap check that the query matched a single
+// row and fail with ErrTooManyRows otherwise, instead of returning an
+// arbitrary one, to catch missing unique constraints and wrong WHERE
+// clauses. They read a second row to check it, so it's meant for
+// development and tests; building with the dbutils_dev tag turns it on from
+// the start.
+func SetStrictGet(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&strictGets, v)
+}
+
+type strictGetKey struct{}
+
+// WithStrictGet overrides SetStrictGet for helpers called with ctx.
+func WithStrictGet(ctx context.Context, enabled bool) context.Context {
+	return context.WithValue(ctx, strictGetKey{}, enabled)
+}
+
+func strictGet(ctx context.Context) bool {
+	if v, ok := ctx.Value(strictGetKey{}).(bool); ok {
+		return v
+	}
+	return atomic.LoadInt32(&strictGets) != 0
+}
+
+// getStrict is sqlx.GetContext failing with ErrTooManyRows if the query
+// returns more than one row.
+func getStrict(ctx context.Context, db Queryer, dest interface{}, query string, args ...interface{}) (err error) {
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = multierr.Combine(err, rows.Close())
+	}()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	if isScannable(reflect.TypeOf(dest).Elem()) {
+		err = rows.Scan(dest)
+	} else {
+		err = rows.StructScan(dest)
+	}
+	if err != nil {
+		return err
+	}
+	if rows.Next() {
+		return ErrTooManyRows
+	}
+	return rows.Err()
+}
+
+// isScannable reports whether values of t are scanned from a single column,
+// as sqlx decides it.
+func isScannable(t reflect.Type) bool {
+	if reflect.PtrTo(t).Implements(scannerType) || t.Kind() != reflect.Struct {
+		return true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,7 @@
+//go:build dbutils_dev
+
+package dbutils
+
+func init() {
+	SetStrictGet(true)
+}
@@ -0,0 +1,165 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// CreateTempTable creates a temporary table name dropped at the end of the
+// transaction tx, with the columns of the fields of T as InsertMany maps
+// them. Column types follow the field types, bigint for int64, text for
+// string and so on; a `sqltype:"numeric(12,2)"` tag sets one explicitly.
+// It's meant for loading rows with LoadTempTable and joining them with
+// other tables in one statement:
+//
+//	conn, err := db.Connx(ctx)
+//	...
+//	defer conn.Close()
+//	err = dbutils.RunTx(ctx, conn, func(tx *sqlx.Tx) error {
+//		if err := dbutils.CreateTempTable[price](ctx, tx, "new_prices"); err != nil {
+//			return err
+//		}
+//		if _, err := dbutils.LoadTempTable(ctx, conn, "new_prices", prices); err != nil {
+//			return err
+//		}
+//		_, err := dbutils.Exec(ctx, tx, `UPDATE prices p SET amount = n.amount
+//			FROM new_prices n WHERE p.id = n.id`)
+//		return err
+//	})
+func CreateTempTable[T any](ctx context.Context, tx Execer, name string) error {
+	table, err := tempTableIdent(name)
+	if err != nil {
+		return err
+	}
+	st := structType(reflect.TypeOf((*T)(nil)).Elem())
+	if st == nil {
+		return fmt.Errorf("temp table of %s: not a struct", reflect.TypeOf((*T)(nil)).Elem())
+	}
+	fields := insertFields(st)
+	if len(fields) == 0 {
+		return fmt.Errorf("temp table of %s: no fields with db tags", st)
+	}
+
+	cols := make([]string, len(fields))
+	for i, f := range fields {
+		col, err := QuoteIdent(f.Name)
+		if err != nil {
+			return fmt.Errorf("temp table column %s: %w", f.Name, err)
+		}
+		typ := f.Field.Tag.Get("sqltype")
+		if typ == "" {
+			if typ, err = sqlTypeOf(f.Field.Type); err != nil {
+				return fmt.Errorf("temp table column %s: %w", f.Name, err)
+			}
+		}
+		cols[i] = col + " " + typ
+	}
+
+	_, err = Exec(ctx, tx, `CREATE TEMP TABLE `+table+` (`+strings.Join(cols, ", ")+`) ON COMMIT DROP`)
+	return err
+}
+
+// LoadTempTable loads rows into the table created by CreateTempTable with
+// COPY on conn, the connection the transaction runs on. Fields tagged as
+// encrypted are encrypted as by InsertMany.
+func LoadTempTable[T any](ctx context.Context, conn *sqlx.Conn, name string, rows []T) (int64, error) {
+	if _, err := tempTableIdent(name); err != nil {
+		return 0, err
+	}
+	st := structType(reflect.TypeOf((*T)(nil)).Elem())
+	if st == nil {
+		return 0, fmt.Errorf("load temp table with %s: not a struct", reflect.TypeOf((*T)(nil)).Elem())
+	}
+	fields := insertFields(st)
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = f.Name
+	}
+
+	src := pgx.CopyFromSlice(len(rows), func(i int) ([]interface{}, error) {
+		enc, err := EncryptFields(ctx, rows[i])
+		if err != nil {
+			return nil, err
+		}
+		v := reflect.Indirect(reflect.ValueOf(enc))
+		if !v.IsValid() {
+			return nil, fmt.Errorf("row %d is nil", i)
+		}
+		values := make([]interface{}, len(fields))
+		for j, f := range fields {
+			values[j] = reflectx.FieldByIndexesReadOnly(v, f.Index).Interface()
+		}
+		return values, nil
+	})
+	return CopyFromConn(ctx, conn, name, columns, src)
+}
+
+func tempTableIdent(name string) (string, error) {
+	if strings.Contains(name, ".") {
+		return "", fmt.Errorf("invalid temp table name %q", name)
+	}
+	qn, err := QuoteIdent(name)
+	if err != nil {
+		return "", fmt.Errorf("temp table %q: %w", name, err)
+	}
+	return qn, nil
+}
+
+var sqlTypes = map[reflect.Type]string{
+	reflect.TypeOf(time.Time{}):         "timestamptz",
+	reflect.TypeOf(json.RawMessage{}):   "jsonb",
+	reflect.TypeOf([]byte{}):            "bytea",
+	reflect.TypeOf(sql.NullString{}):    "text",
+	reflect.TypeOf(sql.NullInt64{}):     "bigint",
+	reflect.TypeOf(sql.NullInt32{}):     "integer",
+	reflect.TypeOf(sql.NullInt16{}):     "smallint",
+	reflect.TypeOf(sql.NullByte{}):      "smallint",
+	reflect.TypeOf(sql.NullFloat64{}):   "double precision",
+	reflect.TypeOf(sql.NullBool{}):      "boolean",
+	reflect.TypeOf(sql.NullTime{}):      "timestamptz",
+	reflect.TypeOf(map[string]string{}): "jsonb",
+	extrasType:                          "jsonb",
+}
+
+// sqlTypeOf returns the column type for values of t.
+func sqlTypeOf(t reflect.Type) (string, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if typ, ok := sqlTypes[t]; ok {
+		return typ, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean", nil
+	case reflect.Int8, reflect.Int16, reflect.Uint8:
+		return "smallint", nil
+	case reflect.Int32, reflect.Uint16:
+		return "integer", nil
+	case reflect.Int, reflect.Int64, reflect.Uint32:
+		return "bigint", nil
+	case reflect.Float32:
+		return "real", nil
+	case reflect.Float64:
+		return "double precision", nil
+	case reflect.String:
+		return "text", nil
+	case reflect.Slice:
+		elem, err := sqlTypeOf(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		return elem + "[]", nil
+	}
+	return "", fmt.Errorf("no column type for %s, set it with a sqltype tag", t)
+}
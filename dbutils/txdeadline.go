@@ -0,0 +1,48 @@
+package dbutils
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var txDeadlines int32
+
+// SetTxDeadlines makes RunTx with a context deadline set statement_timeout
+// and idle_in_transaction_session_timeout of the transaction to the time
+// left, so the server ends the transaction and frees its locks even if the
+// client doesn't, e.g. after losing the connection mid-request. It costs a
+// round trip per transaction with a deadline.
+func SetTxDeadlines(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&txDeadlines, v)
+}
+
+func setTxDeadline(ctx context.Context, tx *sqlx.Tx) error {
+	if atomic.LoadInt32(&txDeadlines) == 0 {
+		return nil
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+
+	// 0 would turn the timeouts off.
+	ms := time.Until(deadline).Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	q := `SELECT set_config('statement_timeout', $1, true),
+		set_config('idle_in_transaction_session_timeout', $1, true)`
+	arg := strconv.FormatInt(ms, 10)
+	if _, err := tx.ExecContext(ctx, q, arg); err != nil {
+		return sqlErr(err, q, arg)
+	}
+	return nil
+}
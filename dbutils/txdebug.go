@@ -0,0 +1,120 @@
+package dbutils
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TxDebugMode selects what happens when a transaction started by RunTx is
+// used by two statements at once, e.g. from goroutines sharing it.
+type TxDebugMode int32
+
+const (
+	TxDebugOff TxDebugMode = iota
+	TxDebugLog
+	TxDebugPanic
+)
+
+var txDebugMode int32
+
+// SetTxDebug enables checks of transactions passed to TxFunc: a statement
+// starting while another one of the transaction is still running, reading
+// its rows included, and the transaction ending while a statement runs are
+// reported with the stacks involved. Handing a transaction over to another
+// goroutine between statements is fine.
+//
+// Only statements run by the helpers of this package, through RunQuery,
+// are seen; calling ExecContext, QueryxContext and the like on the
+// *sqlx.Tx directly bypasses the checks. The checks cost a stack capture
+// per statement, so they are meant for development and tests.
+func SetTxDebug(mode TxDebugMode) {
+	atomic.StoreInt32(&txDebugMode, int32(mode))
+}
+
+type txOwner struct {
+	// started is the stack of RunTx.
+	started []byte
+
+	mu       sync.Mutex
+	inFlight int
+	// running is the stack of the first statement in flight.
+	running []byte
+}
+
+var txOwners sync.Map
+
+func trackTx(tx *sqlx.Tx) (untrack func()) {
+	if TxDebugMode(atomic.LoadInt32(&txDebugMode)) == TxDebugOff {
+		return func() {}
+	}
+
+	owner := &txOwner{started: currentStack()}
+	txOwners.Store(tx, owner)
+	return func() {
+		txOwners.Delete(tx)
+
+		owner.mu.Lock()
+		running := owner.running
+		owner.mu.Unlock()
+		if running != nil {
+			reportTxMisuse(fmt.Sprintf("transaction ends while a statement is running\n%s\nstatement:\n%s\nstarted at:\n%s",
+				currentStack(), running, owner.started))
+		}
+	}
+}
+
+// enterTx marks a statement running on db, if it's a tracked transaction,
+// until leave is called.
+func enterTx(db interface{}) (leave func()) {
+	tx, ok := db.(*sqlx.Tx)
+	if !ok {
+		return func() {}
+	}
+	v, ok := txOwners.Load(tx)
+	if !ok {
+		return func() {}
+	}
+	owner := v.(*txOwner)
+
+	stack := currentStack()
+	owner.mu.Lock()
+	running := owner.running
+	if owner.inFlight++; owner.inFlight == 1 {
+		owner.running = stack
+	}
+	owner.mu.Unlock()
+
+	leave = func() {
+		owner.mu.Lock()
+		if owner.inFlight--; owner.inFlight == 0 {
+			owner.running = nil
+		}
+		owner.mu.Unlock()
+	}
+	if running != nil {
+		if TxDebugMode(atomic.LoadInt32(&txDebugMode)) == TxDebugPanic {
+			// The caller won't get to leave.
+			leave()
+		}
+		reportTxMisuse(fmt.Sprintf("transaction is used by concurrent statements\n%s\nrunning statement:\n%s\nstarted at:\n%s",
+			stack, running, owner.started))
+	}
+	return leave
+}
+
+func reportTxMisuse(msg string) {
+	if TxDebugMode(atomic.LoadInt32(&txDebugMode)) == TxDebugPanic {
+		panic(msg)
+	}
+	log.Print(msg)
+}
+
+func currentStack() []byte {
+	buf := make([]byte, 4096)
+	return buf[:runtime.Stack(buf, false)]
+}
@@ -0,0 +1,85 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var txIDs int32
+
+// SetTxIDs makes RunTx fetch the transaction ID and the backend PID at the
+// start of every transaction. They are set in the Query of its statements,
+// for loggers, and in the errors returned by RunTx, so application logs can
+// be matched with the server logs. It costs a round trip per transaction.
+func SetTxIDs(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&txIDs, v)
+}
+
+// txInfo identifies a transaction on the server.
+type txInfo struct {
+	TxID       int64 `db:"txid"`
+	BackendPID int32 `db:"pid"`
+}
+
+var txInfos sync.Map
+
+// captureTxInfo fetches the IDs of tx if enabled, nil otherwise.
+func captureTxInfo(ctx context.Context, tx *sqlx.Tx) (info *txInfo, untrack func(), err error) {
+	if atomic.LoadInt32(&txIDs) == 0 {
+		return nil, func() {}, nil
+	}
+
+	info = &txInfo{}
+	q := `SELECT txid_current() AS txid, pg_backend_pid() AS pid`
+	if err := tx.QueryRowxContext(ctx, q).StructScan(info); err != nil {
+		return nil, func() {}, sqlErr(err, q)
+	}
+
+	txInfos.Store(tx, info)
+	return info, func() { txInfos.Delete(tx) }, nil
+}
+
+// setTxInfo fills the IDs of the transaction db is, if known, into q.
+func setTxInfo(db interface{}, q *Query) {
+	tx, ok := db.(*sqlx.Tx)
+	if !ok {
+		return
+	}
+	if v, ok := txInfos.Load(tx); ok {
+		info := v.(*txInfo)
+		q.TxID, q.BackendPID = info.TxID, info.BackendPID
+	}
+}
+
+// annotateTxErr sets the transaction IDs in the *Error in err.
+func annotateTxErr(err error, info *txInfo) {
+	var e *Error
+	if info != nil && errors.As(err, &e) && e.TxID == 0 {
+		e.TxID, e.BackendPID = info.TxID, info.BackendPID
+	}
+}
+
+func (e *Error) txSuffix() string {
+	if e.TxID == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (txid %d, backend pid %d)", e.TxID, e.BackendPID)
+}
+
+// txAnnotation returns " txid=... pid=..." for statements with known
+// transaction IDs.
+func (q *Query) txAnnotation() string {
+	if q.TxID == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" txid=%d pid=%d", q.TxID, q.BackendPID)
+}
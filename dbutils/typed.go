@@ -0,0 +1,40 @@
+package dbutils
+
+import (
+	"context"
+	"reflect"
+)
+
+// SelectT is Select returning the rows in a new slice of T, never nil, so
+// callers don't declare it:
+//
+//	users, err := dbutils.SelectT[User](ctx, db, `SELECT * FROM users WHERE active`)
+func SelectT[T any](ctx context.Context, db Queryer, query string, args ...interface{}) ([]T, error) {
+	ret := []T{}
+	if err := Select(ctx, db, &ret, query, args...); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetT is Get returning the row as a T, a struct, a pointer to one or a
+// scannable type for single-column results:
+//
+//	n, err := dbutils.GetT[int64](ctx, db, `SELECT count(*) FROM users`)
+func GetT[T any](ctx context.Context, db Queryer, query string, args ...interface{}) (T, error) {
+	var ret T
+	rv := reflect.ValueOf(&ret).Elem()
+	dest := rv.Addr()
+	if t := rv.Type(); t.Kind() == reflect.Ptr && structType(t) != nil {
+		dest = reflect.New(t.Elem())
+	}
+
+	if err := Get(ctx, db, dest.Interface(), query, args...); err != nil {
+		var zero T
+		return zero, err
+	}
+	if dest.Type() != rv.Addr().Type() {
+		rv.Set(dest)
+	}
+	return ret, nil
+}
@@ -0,0 +1,81 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// UpdateMany updates the setCols of the rows of table matching rows, structs
+// or pointers to them, by keyCols, with one UPDATE ... FROM (VALUES ...)
+// per as many rows as the parameter limit allows, instead of a statement
+// per row. Columns are mapped to fields by their db tags. It returns the
+// number of updated rows; rows without a match are ignored.
+func UpdateMany[T any](ctx context.Context, db Execer, table string, rows []T, keyCols, setCols []string) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	if len(keyCols) == 0 || len(setCols) == 0 {
+		return 0, fmt.Errorf("update %s: no key or set columns", table)
+	}
+
+	st := structType(reflect.TypeOf((*T)(nil)).Elem())
+	if st == nil {
+		return 0, fmt.Errorf("update %T: not a struct", rows[0])
+	}
+	columns := append(append([]string(nil), keyCols...), setCols...)
+	tm := idMapper.TypeMap(st)
+	fields := make([]*reflectx.FieldInfo, len(columns))
+	for i, c := range columns {
+		if fields[i] = tm.Names[c]; fields[i] == nil {
+			return 0, fmt.Errorf("update %T: no field for the %s column", rows[0], c)
+		}
+	}
+
+	var n int64
+	batch := maxParams / len(columns)
+	for start := 0; start < len(rows); start += batch {
+		end := start + batch
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		b := NewMerge(table, keyCols...).Columns(columns...).WhenMatchedUpdate(setCols...)
+		for i, row := range rows[start:end] {
+			enc, err := EncryptFields(ctx, row)
+			if err != nil {
+				return n, err
+			}
+			v := reflect.Indirect(reflect.ValueOf(enc))
+			if !v.IsValid() {
+				return n, fmt.Errorf("update: row %d is nil", start+i)
+			}
+			values := make([]interface{}, len(fields))
+			for j, f := range fields {
+				values[j] = reflectx.FieldByIndexesReadOnly(v, f.Index).Interface()
+			}
+			b.Values(values...)
+		}
+
+		// Without inserts the fallback of MERGE is the UPDATE ... FROM
+		// wanted on all servers.
+		var buf strings.Builder
+		var al argList
+		if err := b.appendQuery(&buf, &al, false); err != nil {
+			return n, fmt.Errorf("build update: %w", err)
+		}
+		res, err := Exec(ctx, db, buf.String(), al.args...)
+		if err != nil {
+			return n, err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return n, err
+		}
+		n += affected
+	}
+	return n, nil
+}
@@ -0,0 +1,49 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	waitReadyMinDelay = 100 * time.Millisecond
+	waitReadyMaxDelay = 5 * time.Second
+)
+
+// WaitReady waits up to maxWait for the database of cfg to accept
+// connections, e.g. at startup next to a database container. It connects and
+// pings with exponential backoff while the server is unreachable, starting up
+// or timing out, and fails fast on anything else, such as rejected
+// credentials or a missing database, which waiting won't fix.
+func WaitReady(ctx context.Context, cfg Config, maxWait time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, maxWait)
+	defer cancel()
+
+	delay := waitReadyMinDelay
+	for attempt := 1; ; attempt++ {
+		db, err := Open(ctx, cfg)
+		if err == nil {
+			return db.Close()
+		}
+
+		switch CodeOf(err) {
+		case Unavailable, Timeout:
+		default:
+			return err
+		}
+
+		log.Printf("database not ready (attempt %d), retrying in %s: %v", attempt, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return fmt.Errorf("database not ready after %s: %w", maxWait, err)
+		}
+
+		delay *= 2
+		if delay > waitReadyMaxDelay {
+			delay = waitReadyMaxDelay
+		}
+	}
+}
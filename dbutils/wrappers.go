@@ -4,16 +4,17 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"reflect"
 
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/multierr"
 )
 
-func sqlErr(err error, query string, args ...interface{}) error {
-	return fmt.Errorf(`run query "%s" with args %+v: %w`, query, args, err)
-}
+func namedQuery(ctx context.Context, query string, arg interface{}) (nq string, args []interface{}, err error) {
+	if arg, err = EncryptFields(ctx, arg); err != nil {
+		return "", nil, sqlErr(err, query)
+	}
 
-func namedQuery(query string, arg interface{}) (nq string, args []interface{}, err error) {
 	nq, args, err = sqlx.Named(query, arg)
 	if err != nil {
 		return "", nil, sqlErr(err, query, args...)
@@ -21,8 +22,13 @@ func namedQuery(query string, arg interface{}) (nq string, args []interface{}, e
 	return nq, args, nil
 }
 
-func Exec(ctx context.Context, db sqlx.ExecerContext, query string, args ...interface{}) (sql.Result, error) {
-	res, err := db.ExecContext(ctx, query, args...)
+func Exec(ctx context.Context, db Execer, query string, args ...interface{}) (sql.Result, error) {
+	ctx, args = ApplyOptions(ctx, args)
+	var res sql.Result
+	err := RunQuery(ctx, db, query, args, func(ctx context.Context, q *Query) (err error) {
+		res, err = db.ExecContext(ctx, q.SQL, q.Args...)
+		return err
+	})
 	if err != nil {
 		return res, sqlErr(err, query, args...)
 	}
@@ -30,8 +36,8 @@ func Exec(ctx context.Context, db sqlx.ExecerContext, query string, args ...inte
 	return res, nil
 }
 
-func NamedExec(ctx context.Context, db sqlx.ExtContext, query string, arg interface{}) (sql.Result, error) {
-	nq, args, err := namedQuery(query, arg)
+func NamedExec(ctx context.Context, db NamedExecer, query string, arg interface{}) (sql.Result, error) {
+	nq, args, err := namedQuery(ctx, query, arg)
 	if err != nil {
 		return nil, err
 	}
@@ -39,16 +45,61 @@ func NamedExec(ctx context.Context, db sqlx.ExtContext, query string, arg interf
 	return Exec(ctx, db, db.Rebind(nq), args...)
 }
 
-func Select(ctx context.Context, db sqlx.QueryerContext, dest interface{}, query string, args ...interface{}) error {
-	if err := sqlx.SelectContext(ctx, db, dest, query, args...); err != nil {
+func Select(ctx context.Context, db Queryer, dest interface{}, query string, args ...interface{}) error {
+	ctx, args = ApplyOptions(ctx, args)
+	if c, ok := resultCaching(ctx, db, query); ok {
+		v, err := cachedResult(ctx, c, "select", dest, query, args, func(ctx context.Context, dest interface{}) error {
+			return Select(ctx, db, dest, query, args...)
+		})
+		if err != nil {
+			return err
+		}
+		dv := reflect.ValueOf(dest).Elem()
+		dv.Set(reflect.AppendSlice(dv, v))
+		return nil
+	}
+	if !coalescing(db, query) {
+		return selectInto(ctx, db, dest, query, args...)
+	}
+
+	v, err := coalesce(ctx, db, fmt.Sprintf("select %T", dest), query, args, func() (interface{}, error) {
+		rows := reflect.New(reflect.TypeOf(dest).Elem())
+		err := selectInto(ctx, db, rows.Interface(), query, args...)
+		return rows.Elem().Interface(), err
+	})
+	if err != nil {
+		return err
+	}
+
+	dv := reflect.ValueOf(dest).Elem()
+	dv.Set(reflect.AppendSlice(dv, reflect.ValueOf(v)))
+	return nil
+}
+
+func selectInto(ctx context.Context, db Queryer, dest interface{}, query string, args ...interface{}) error {
+	n := sliceLen(dest)
+	err := RunQuery(ctx, db, query, args, func(ctx context.Context, q *Query) error {
+		truncateSlice(dest, n)
+		var err error
+		if max := maxRows(ctx); max > 0 || needsRowMapper(ctx, dest) {
+			err = selectRows(ctx, db, dest, max, q.SQL, q.Args...)
+		} else {
+			err = sqlx.SelectContext(ctx, db, dest, q.SQL, q.Args...)
+		}
+		if err != nil {
+			return err
+		}
+		return DecryptFields(ctx, dest)
+	})
+	if err != nil {
 		return sqlErr(err, query, args...)
 	}
 
 	return nil
 }
 
-func NamedSelect(ctx context.Context, db sqlx.ExtContext, dest interface{}, query string, arg interface{}) error {
-	nq, args, err := namedQuery(query, arg)
+func NamedSelect(ctx context.Context, db NamedQueryer, dest interface{}, query string, arg interface{}) error {
+	nq, args, err := namedQuery(ctx, query, arg)
 	if err != nil {
 		return err
 	}
@@ -56,16 +107,59 @@ func NamedSelect(ctx context.Context, db sqlx.ExtContext, dest interface{}, quer
 	return Select(ctx, db, dest, db.Rebind(nq), args...)
 }
 
-func Get(ctx context.Context, db sqlx.QueryerContext, dest interface{}, query string, args ...interface{}) error {
-	if err := sqlx.GetContext(ctx, db, dest, query, args...); err != nil {
+func Get(ctx context.Context, db Queryer, dest interface{}, query string, args ...interface{}) error {
+	ctx, args = ApplyOptions(ctx, args)
+	if c, ok := resultCaching(ctx, db, query); ok {
+		v, err := cachedResult(ctx, c, "get", dest, query, args, func(ctx context.Context, dest interface{}) error {
+			return Get(ctx, db, dest, query, args...)
+		})
+		if err != nil {
+			return err
+		}
+		reflect.ValueOf(dest).Elem().Set(v)
+		return nil
+	}
+	if !coalescing(db, query) {
+		return getInto(ctx, db, dest, query, args...)
+	}
+
+	v, err := coalesce(ctx, db, fmt.Sprintf("get %T", dest), query, args, func() (interface{}, error) {
+		row := reflect.New(reflect.TypeOf(dest).Elem())
+		err := getInto(ctx, db, row.Interface(), query, args...)
+		return row.Elem().Interface(), err
+	})
+	if err != nil {
+		return err
+	}
+
+	reflect.ValueOf(dest).Elem().Set(reflect.ValueOf(v))
+	return nil
+}
+
+func getInto(ctx context.Context, db Queryer, dest interface{}, query string, args ...interface{}) error {
+	err := RunQuery(ctx, db, query, args, func(ctx context.Context, q *Query) error {
+		var err error
+		if needsRowMapper(ctx, dest) {
+			err = getRow(ctx, db, dest, q.SQL, q.Args...)
+		} else if strictGet(ctx) {
+			err = getStrict(ctx, db, dest, q.SQL, q.Args...)
+		} else {
+			err = sqlx.GetContext(ctx, db, dest, q.SQL, q.Args...)
+		}
+		if err != nil {
+			return err
+		}
+		return DecryptFields(ctx, dest)
+	})
+	if err != nil {
 		return sqlErr(err, query, args...)
 	}
 
 	return nil
 }
 
-func NamedGet(ctx context.Context, db sqlx.ExtContext, dest interface{}, query string, arg interface{}) error {
-	nq, args, err := namedQuery(query, arg)
+func NamedGet(ctx context.Context, db NamedQueryer, dest interface{}, query string, arg interface{}) error {
+	nq, args, err := namedQuery(ctx, query, arg)
 	if err != nil {
 		return err
 	}
@@ -73,17 +167,96 @@ func NamedGet(ctx context.Context, db sqlx.ExtContext, dest interface{}, query s
 	return Get(ctx, db, dest, db.Rebind(nq), args...)
 }
 
-func SelectMaps(ctx context.Context, db sqlx.QueryerContext, query string, args ...interface{}) (ret []map[string]interface{}, err error) {
-	rows, err := db.QueryxContext(ctx, query, args...)
+func SelectMaps(ctx context.Context, db Queryer, query string, args ...interface{}) (ret []map[string]interface{}, err error) {
+	ctx, args = ApplyOptions(ctx, args)
+	if c, ok := resultCaching(ctx, db, query); ok {
+		v, err := cachedResult(ctx, c, "selectmaps", &ret, query, args, func(ctx context.Context, dest interface{}) (err error) {
+			*dest.(*[]map[string]interface{}), err = SelectMaps(ctx, db, query, args...)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return v.Interface().([]map[string]interface{}), nil
+	}
+	if !coalescing(db, query) {
+		return selectMapsQuery(ctx, db, query, args...)
+	}
+
+	v, err := coalesce(ctx, db, "selectmaps", query, args, func() (interface{}, error) {
+		return selectMapsQuery(ctx, db, query, args...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	shared := v.([]map[string]interface{})
+	ret = make([]map[string]interface{}, len(shared))
+	for i, m := range shared {
+		ret[i] = copyMap(m)
+	}
+	return ret, nil
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		ret[k] = v
+	}
+	return ret
+}
+
+func selectMapsQuery(ctx context.Context, db Queryer, query string, args ...interface{}) (ret []map[string]interface{}, err error) {
+	err = RunQuery(ctx, db, query, args, func(ctx context.Context, q *Query) error {
+		ret, err = selectMaps(ctx, db, q.SQL, q.Args...)
+		return err
+	})
 	if err != nil {
 		return nil, sqlErr(err, query, args...)
 	}
 
+	return ret, nil
+}
+
+func selectMaps(ctx context.Context, db Queryer, query string, args ...interface{}) (ret []map[string]interface{}, err error) {
+	ret = []map[string]interface{}{}
+	max, maxBytes := maxRows(ctx), maxResultBytes(ctx)
+	size := 0
+	err = eachMap(ctx, db, query, args, func(m map[string]interface{}) error {
+		if max > 0 && len(ret) >= max {
+			return maxRowsErr(max)
+		}
+		if maxBytes > 0 {
+			if size += mapSize(m); size > maxBytes {
+				return resultTooLargeErr(maxBytes)
+			}
+		}
+		ret = append(ret, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func eachMap(ctx context.Context, db Queryer, query string, args []interface{}, f func(map[string]interface{}) error) (err error) {
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
 	defer func() {
 		err = multierr.Combine(err, rows.Close())
 	}()
 
-	ret = []map[string]interface{}{}
+	cts, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	arrays := arrayColumns(cts)
+
 	numCols := -1
 	for rows.Next() {
 		var m map[string]interface{}
@@ -94,21 +267,68 @@ func SelectMaps(ctx context.Context, db sqlx.QueryerContext, query string, args
 		}
 
 		if err = rows.MapScan(m); err != nil {
-			return nil, sqlErr(err, query, args...)
+			return err
+		}
+		if err = decodeArrays(m, arrays); err != nil {
+			return err
 		}
-		ret = append(ret, m)
 		numCols = len(m)
+		if err = f(TransformMap(ctx, m)); err != nil {
+			return err
+		}
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, sqlErr(err, query, args...)
+	return rows.Err()
+}
+
+// SelectMapsEach calls f for every row of the result as it's read, without
+// holding the whole result in memory. Stopping early is done by returning
+// an error from f. The statement isn't retried after a connection loss.
+func SelectMapsEach(ctx context.Context, db Queryer, query string, args []interface{}, f func(map[string]interface{}) error) error {
+	ctx, args = ApplyOptions(ctx, args)
+	err := RunQuery(withoutRetry(ctx), db, query, args, func(ctx context.Context, q *Query) error {
+		return eachMap(ctx, db, q.SQL, q.Args, f)
+	})
+	if err != nil {
+		return sqlErr(err, query, args...)
 	}
 
-	return ret, nil
+	return nil
 }
 
-func NamedSelectMaps(ctx context.Context, db sqlx.ExtContext, query string, arg interface{}) (ret []map[string]interface{}, err error) {
-	nq, args, err := namedQuery(query, arg)
+// SelectEach calls f for every row of the result as it's read, with rows
+// positioned on the row for f to scan, e.g. with rows.StructScan, so
+// results of any size are processed in constant memory. f must not call
+// rows.Next or rows.Close, the rows are closed when SelectEach returns.
+// Stopping early is done by returning an error from f. The statement isn't
+// retried after a connection loss.
+func SelectEach(ctx context.Context, db Queryer, query string, args []interface{}, f func(rows *sqlx.Rows) error) error {
+	ctx, args = ApplyOptions(ctx, args)
+	err := RunQuery(withoutRetry(ctx), db, query, args, func(ctx context.Context, q *Query) (err error) {
+		rows, err := db.QueryxContext(ctx, q.SQL, q.Args...)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err = multierr.Combine(err, rows.Close())
+		}()
+
+		for rows.Next() {
+			if err := f(rows); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return sqlErr(err, query, args...)
+	}
+
+	return nil
+}
+
+func NamedSelectMaps(ctx context.Context, db NamedQueryer, query string, arg interface{}) (ret []map[string]interface{}, err error) {
+	nq, args, err := namedQuery(ctx, query, arg)
 	if err != nil {
 		return nil, err
 	}
@@ -116,22 +336,75 @@ func NamedSelectMaps(ctx context.Context, db sqlx.ExtContext, query string, arg
 	return SelectMaps(ctx, db, db.Rebind(nq), args...)
 }
 
-func GetMap(ctx context.Context, db sqlx.QueryerContext, query string, args ...interface{}) (ret map[string]interface{}, err error) {
-	row := db.QueryRowxContext(ctx, query, args...)
-	if row.Err() != nil {
-		return nil, sqlErr(row.Err(), query, args...)
+func GetMap(ctx context.Context, db Queryer, query string, args ...interface{}) (ret map[string]interface{}, err error) {
+	ctx, args = ApplyOptions(ctx, args)
+	if c, ok := resultCaching(ctx, db, query); ok {
+		v, err := cachedResult(ctx, c, "getmap", &ret, query, args, func(ctx context.Context, dest interface{}) (err error) {
+			*dest.(*map[string]interface{}), err = GetMap(ctx, db, query, args...)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return v.Interface().(map[string]interface{}), nil
+	}
+	if !coalescing(db, query) {
+		return getMapQuery(ctx, db, query, args...)
+	}
+
+	v, err := coalesce(ctx, db, "getmap", query, args, func() (interface{}, error) {
+		return getMapQuery(ctx, db, query, args...)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return copyMap(v.(map[string]interface{})), nil
+}
+
+func getMapQuery(ctx context.Context, db Queryer, query string, args ...interface{}) (ret map[string]interface{}, err error) {
+	err = RunQuery(ctx, db, query, args, func(ctx context.Context, q *Query) error {
+		rows, err := db.QueryxContext(ctx, q.SQL, q.Args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
 
-	ret = map[string]interface{}{}
-	if err := row.MapScan(ret); err != nil {
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			return sql.ErrNoRows
+		}
+		cts, err := rows.ColumnTypes()
+		if err != nil {
+			return err
+		}
+
+		m := map[string]interface{}{}
+		if err := rows.MapScan(m); err != nil {
+			return err
+		}
+		if err := decodeArrays(m, arrayColumns(cts)); err != nil {
+			return err
+		}
+		if strictGet(ctx) && rows.Next() {
+			return ErrTooManyRows
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		ret = TransformMap(ctx, m)
+		return nil
+	})
+	if err != nil {
 		return nil, sqlErr(err, query, args...)
 	}
 
 	return ret, nil
 }
 
-func NamedGetMap(ctx context.Context, db sqlx.ExtContext, query string, arg interface{}) (ret map[string]interface{}, err error) {
-	nq, args, err := namedQuery(query, arg)
+func NamedGetMap(ctx context.Context, db NamedQueryer, query string, arg interface{}) (ret map[string]interface{}, err error) {
+	nq, args, err := namedQuery(ctx, query, arg)
 	if err != nil {
 		return nil, err
 	}
@@ -141,11 +414,10 @@ func NamedGetMap(ctx context.Context, db sqlx.ExtContext, query string, arg inte
 
 type TxFunc func(tx *sqlx.Tx) error
 
-type TxRunner interface {
-	BeginTxx(context.Context, *sql.TxOptions) (*sqlx.Tx, error)
-}
+// TxRunner is the former name of TxStarter.
+type TxRunner = TxStarter
 
-func RunTx(ctx context.Context, db TxRunner, f TxFunc) (err error) {
+func RunTx(ctx context.Context, db TxStarter, f TxFunc) (err error) {
 	var tx *sqlx.Tx
 
 	opts := &sql.TxOptions{
@@ -156,13 +428,29 @@ func RunTx(ctx context.Context, db TxRunner, f TxFunc) (err error) {
 	if err != nil {
 		return fmt.Errorf("begin transaction: %w", err)
 	}
+	untrack := trackTx(tx)
+	var info *txInfo
+	untrackInfo := func() {}
 	defer func() {
+		untrack()
+		untrackInfo()
 		if err != nil {
+			annotateTxErr(err, info)
 			err = multierr.Combine(err, tx.Rollback())
 		} else {
 			err = tx.Commit()
 		}
 	}()
 
+	if err = setTxOpName(ctx, tx); err != nil {
+		return err
+	}
+	if err = setTxDeadline(ctx, tx); err != nil {
+		return err
+	}
+	if info, untrackInfo, err = captureTxInfo(ctx, tx); err != nil {
+		return err
+	}
+
 	return f(tx)
 }
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"db-example/dbutils"
+	"db-example/usersrpc"
+)
+
+var grpcAddr = flag.String("grpc-addr", ":9090", "listen address of the grpc command")
+
+// usersService implements the users gRPC service over test_users.
+type usersService struct {
+	usersrpc.UnimplementedUsersServer
+	db *sqlx.DB
+}
+
+func serveGRPC(ctx context.Context, dbh *sqlx.DB) error {
+	if _, err := dbutils.Exec(ctx, dbh, createUsers); err != nil {
+		return err
+	}
+
+	lis, err := net.Listen("tcp", *grpcAddr)
+	if err != nil {
+		return err
+	}
+
+	// Statements carry the method and trace context of their call.
+	defer dbutils.Use(dbutils.AnnotateSQL)()
+
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(traceUnary))
+	usersrpc.RegisterUsersServer(srv, &usersService{db: dbh})
+
+	log.Printf("serving gRPC on %s", lis.Addr())
+	return srv.Serve(lis)
+}
+
+// traceUnary names the database operations of a call after its method and
+// gives them the trace context of the call, so they are annotated in the
+// query log, logs the call with its status and duration and converts
+// database errors to statuses.
+func traceUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	tp := callTraceParent(ctx)
+	_ = grpc.SetHeader(ctx, metadata.Pairs("traceparent", tp))
+	ctx = dbutils.WithTraceParent(ctx, tp)
+	ctx = dbutils.WithOpName(ctx, strings.TrimPrefix(info.FullMethod, "/"))
+
+	resp, err := handler(ctx, req)
+	err = grpcError(info.FullMethod, err)
+
+	log.Printf("%s %s %s traceparent=%s", info.FullMethod, status.Code(err), time.Since(start), tp)
+	return resp, err
+}
+
+// callTraceParent returns the W3C trace context of the span of the call: a
+// child of the caller's span from the traceparent metadata, or the root of
+// a new trace.
+func callTraceParent(ctx context.Context) string {
+	traceID, flags := randomHex(16), "01"
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("traceparent"); len(v) > 0 {
+		if id, _, fl, ok := dbutils.ParseTraceParent(v[0]); ok {
+			traceID, flags = id, fl
+		}
+	}
+	return "00-" + traceID + "-" + randomHex(8) + "-" + flags
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+var grpcCodes = map[dbutils.Code]codes.Code{
+	dbutils.NotFound:        codes.NotFound,
+	dbutils.Conflict:        codes.Aborted,
+	dbutils.Timeout:         codes.DeadlineExceeded,
+	dbutils.Canceled:        codes.Canceled,
+	dbutils.Unavailable:     codes.Unavailable,
+	dbutils.InvalidArgument: codes.InvalidArgument,
+}
+
+// grpcError maps database errors to statuses. As with writeError, details
+// are only logged.
+func grpcError(method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	code := dbutils.CodeOf(err)
+	c, ok := grpcCodes[code]
+	if !ok {
+		c = codes.Internal
+	}
+	if c == codes.Internal || c == codes.Unavailable || errors.Is(err, context.Canceled) {
+		log.Printf("%s failed: %v", method, err)
+	}
+
+	return status.Error(c, code.String())
+}
+
+func (u user) proto() *usersrpc.User {
+	return &usersrpc.User{Id: u.ID, Login: u.Login, Name: u.Name}
+}
+
+func (s *usersService) GetUser(ctx context.Context, req *usersrpc.GetUserRequest) (*usersrpc.User, error) {
+	var u user
+	if err := dbutils.Get(ctx, s.db, &u, `SELECT * FROM test_users WHERE id = $1`, req.Id); err != nil {
+		return nil, err
+	}
+	return u.proto(), nil
+}
+
+func (s *usersService) ListUsers(ctx context.Context, req *usersrpc.ListUsersRequest) (*usersrpc.ListUsersResponse, error) {
+	filter := map[string]interface{}{}
+	if req.Login != "" {
+		filter["login"] = req.Login
+	}
+	if req.Name != "" {
+		filter["name"] = req.Name
+	}
+
+	b := dbutils.NewSelect("test_users").OrderBy("id")
+	if len(filter) > 0 {
+		b.Where(dbutils.Filter(filter))
+	}
+	page, err := dbutils.SelectPage[user](ctx, s.db, b, dbutils.PageRequest{
+		Limit:     int(req.Limit),
+		Cursor:    req.Cursor,
+		WithTotal: req.WithTotal,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &usersrpc.ListUsersResponse{
+		NextCursor: page.NextCursor,
+		HasMore:    page.HasMore,
+		Total:      page.Total,
+	}
+	for _, u := range page.Items {
+		resp.Users = append(resp.Users, u.proto())
+	}
+	return resp, nil
+}
+
+func (s *usersService) CreateUser(ctx context.Context, req *usersrpc.CreateUserRequest) (*usersrpc.User, error) {
+	u, err := createUser(ctx, s.db, req)
+	if err != nil {
+		return nil, err
+	}
+	return u.proto(), nil
+}
+
+func (s *usersService) CreateUsers(ctx context.Context, req *usersrpc.CreateUsersRequest) (*usersrpc.CreateUsersResponse, error) {
+	resp := &usersrpc.CreateUsersResponse{}
+	// createUser joins the transaction carried by ctx, so the batch is
+	// created all or nothing.
+	err := dbutils.RunInTx(ctx, s.db, func(ctx context.Context, tx *sqlx.Tx) error {
+		resp.Users = resp.Users[:0]
+		for _, r := range req.Users {
+			u, err := createUser(ctx, s.db, r)
+			if err != nil {
+				return err
+			}
+			resp.Users = append(resp.Users, u.proto())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// createUser inserts a user in the transaction of ctx, if any, or in one
+// of its own.
+func createUser(ctx context.Context, db *sqlx.DB, req *usersrpc.CreateUserRequest) (u user, err error) {
+	if req.Login == "" {
+		return user{}, status.Error(codes.InvalidArgument, "login is required")
+	}
+
+	u = user{Login: req.Login, Name: req.Name}
+	q := `INSERT INTO test_users (login, name) VALUES (:login, :name) RETURNING *`
+	err = dbutils.RunInTx(ctx, db, func(ctx context.Context, tx *sqlx.Tx) error {
+		return dbutils.NamedGet(ctx, tx, &u, q, u)
+	})
+	return u, err
+}
+
+func (s *usersService) UpdateUser(ctx context.Context, req *usersrpc.UpdateUserRequest) (*usersrpc.User, error) {
+	if req.User == nil {
+		return nil, status.Error(codes.InvalidArgument, "user is required")
+	}
+
+	u := user{ID: req.User.Id, Login: req.User.Login, Name: req.User.Name}
+	q := `UPDATE test_users SET login = :login, name = :name WHERE id = :id RETURNING *`
+	if err := dbutils.NamedGet(ctx, s.db, &u, q, u); err != nil {
+		return nil, err
+	}
+	return u.proto(), nil
+}
+
+func (s *usersService) DeleteUser(ctx context.Context, req *usersrpc.DeleteUserRequest) (*usersrpc.DeleteUserResponse, error) {
+	var u user
+	if err := dbutils.Get(ctx, s.db, &u, `DELETE FROM test_users WHERE id = $1 RETURNING *`, req.Id); err != nil {
+		return nil, err
+	}
+	return &usersrpc.DeleteUserResponse{}, nil
+}
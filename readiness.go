@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"db-example/dbutils"
+)
+
+var (
+	waitTimeout   = flag.Duration("wait-timeout", time.Minute, "how long the wait command waits for the database")
+	schemaVersion = flag.Int64("schema-version", 0, "schema_migrations version the wait command waits for, 0 to skip the check")
+)
+
+// waitReady is the wait command: it succeeds once the database accepts
+// connections and, with -schema-version, is migrated to at least that
+// version, so it can serve as an initContainer or a compose healthcheck.
+// The version is read from schema_migrations as maintained by
+// golang-migrate.
+func waitReady(ctx context.Context, cfg dbutils.Config) error {
+	ctx, cancel := context.WithTimeout(ctx, *waitTimeout)
+	defer cancel()
+
+	if err := dbutils.WaitReady(ctx, cfg, *waitTimeout); err != nil {
+		return err
+	}
+	if *schemaVersion == 0 {
+		log.Print("database is ready")
+		return nil
+	}
+
+	dbh, err := dbutils.Open(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer dbh.Close()
+
+	for {
+		version, err := migratedVersion(ctx, dbh)
+		switch {
+		case err == nil && version >= *schemaVersion:
+			log.Printf("database is ready at schema version %d", version)
+			return nil
+		case errors.Is(err, errDirtySchema):
+			return err
+		case err == nil:
+			err = fmt.Errorf("schema version %d, waiting for %d", version, *schemaVersion)
+		}
+
+		log.Printf("database not migrated: %v", err)
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return fmt.Errorf("database not migrated after %s: %w", *waitTimeout, err)
+		}
+	}
+}
+
+var errDirtySchema = errors.New("a migration failed half-way, the schema is dirty")
+
+func migratedVersion(ctx context.Context, dbh *sqlx.DB) (int64, error) {
+	var m struct {
+		Version int64 `db:"version"`
+		Dirty   bool  `db:"dirty"`
+	}
+	if err := dbutils.Get(ctx, dbh, &m, `SELECT version, dirty FROM schema_migrations`); err != nil {
+		return 0, err
+	}
+	if m.Dirty {
+		return m.Version, fmt.Errorf("version %d: %w", m.Version, errDirtySchema)
+	}
+	return m.Version, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"db-example/dbutils"
+)
+
+var record = flag.String("record", "", "file to record the executed statements to, for the replay command")
+
+// startRecording makes the helpers record statements to the -record file.
+func startRecording() (stop func() error, err error) {
+	if *record == "" {
+		return func() error { return nil }, nil
+	}
+	f, err := os.Create(*record)
+	if err != nil {
+		return nil, err
+	}
+	remove := dbutils.Use(dbutils.RecordQueries(f))
+	return func() error {
+		remove()
+		return f.Close()
+	}, nil
+}
+
+// replay runs the statements of a log recorded with -record against the
+// database, keeping their original pacing, and reports the latencies:
+//
+//	replay [-concurrency 4] [-speed 1] file
+//
+// -speed 2 replays twice as fast, 0 as fast as possible.
+func replay(ctx context.Context, dbh *sqlx.DB, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	concurrency := fs.Int("concurrency", 4, "number of statements run concurrently")
+	speed := fs.Float64("speed", 1, "replay speed relative to the recording, 0 for no pauses")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *concurrency < 1 {
+		return errors.New("usage: replay [-concurrency n] [-speed x] file")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+		failed    int
+		wg        sync.WaitGroup
+	)
+	queries := make(chan dbutils.RecordedQuery)
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for q := range queries {
+				start := time.Now()
+				_, err := dbutils.Exec(ctx, dbh, q.SQL, q.Args...)
+				d := time.Since(start)
+
+				mu.Lock()
+				latencies = append(latencies, d)
+				if err != nil {
+					failed++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var recStart, start time.Time
+	err = dbutils.ReadRecordedQueries(f, func(q dbutils.RecordedQuery) error {
+		if recStart.IsZero() {
+			recStart, start = q.Time, time.Now()
+		}
+		if *speed > 0 {
+			at := start.Add(time.Duration(float64(q.Time.Sub(recStart)) / *speed))
+			time.Sleep(time.Until(at))
+		}
+		queries <- q
+		return nil
+	})
+	close(queries)
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+
+	if len(latencies) == 0 {
+		log.Print("no statements to replay")
+		return nil
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	pct := func(p float64) time.Duration {
+		return latencies[int(p*float64(len(latencies)-1))]
+	}
+	log.Printf("replayed %d statements in %s, %d failed: p50=%s p95=%s p99=%s max=%s",
+		len(latencies), time.Since(start).Round(time.Millisecond), failed,
+		pct(0.50), pct(0.95), pct(0.99), latencies[len(latencies)-1])
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"db-example/dbutils"
+)
+
+// seed fills tables with fake rows for load tests and demos:
+//
+//	seed -fake n=100000 [table ...]
+//
+// test_users is seeded if no table is given.
+func seed(ctx context.Context, dbh *sqlx.DB, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	fake := fs.String("fake", "n=1000", "number of fake rows per table")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	n, err := strconv.Atoi(strings.TrimPrefix(*fake, "n="))
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid -fake %q, want n=<rows>", *fake)
+	}
+
+	tables := fs.Args()
+	if len(tables) == 0 {
+		if _, err := dbutils.Exec(ctx, dbh, createUsers); err != nil {
+			return err
+		}
+		tables = []string{"test_users"}
+	}
+
+	for _, t := range tables {
+		rows, err := dbutils.Seed(ctx, dbh, t, n)
+		if err != nil {
+			return err
+		}
+		log.Printf("seeded %s with %d rows", t, rows)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"db-example/dbutils"
+)
+
+var addr = flag.String("addr", ":8080", "listen address of the serve command")
+
+const createUsers = `CREATE TABLE IF NOT EXISTS test_users (
+	id BIGSERIAL,
+	login TEXT,
+	name TEXT
+)`
+
+// usersAPI is a reference JSON API over test_users:
+//
+//	GET    /users?login=...&name=...&limit=...&cursor=...
+//	GET    /users/{id}
+//	POST   /users         {"login": ..., "name": ...}
+//	PUT    /users/{id}    {"login": ..., "name": ...}
+//	DELETE /users/{id}
+//
+// and lists the database sessions of the service at
+//
+//	GET    /debug/activity?app=...&state=...
+type usersAPI struct {
+	db *sqlx.DB
+}
+
+func serve(ctx context.Context, dbh *sqlx.DB) error {
+	if _, err := dbutils.Exec(ctx, dbh, createUsers); err != nil {
+		return err
+	}
+
+	api := &usersAPI{db: dbh}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users", api.collection)
+	mux.HandleFunc("/users/", api.item)
+	mux.HandleFunc("/debug/activity", api.activity)
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("serving on %s", *addr)
+	return srv.ListenAndServe()
+}
+
+func (api *usersAPI) collection(w http.ResponseWriter, r *http.Request) {
+	ctx := dbutils.WithOpName(r.Context(), "users."+strings.ToLower(r.Method))
+
+	switch r.Method {
+	case http.MethodGet:
+		api.list(ctx, w, r)
+	case http.MethodPost:
+		var u user
+		if !readJSON(w, r, &u) {
+			return
+		}
+		q := `INSERT INTO test_users (login, name) VALUES (:login, :name) RETURNING *`
+		if err := dbutils.NamedGet(ctx, api.db, &u, q, u); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, u)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (api *usersAPI) list(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	filter := map[string]interface{}{}
+	for _, col := range []string{"login", "name"} {
+		if v := r.URL.Query().Get(col); v != "" {
+			filter[col] = v
+		}
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	b := dbutils.NewSelect("test_users").OrderBy("id")
+	if len(filter) > 0 {
+		b.Where(dbutils.Filter(filter))
+	}
+	page, err := dbutils.SelectPage[user](ctx, api.db, b, dbutils.PageRequest{
+		Limit:     limit,
+		Cursor:    r.URL.Query().Get("cursor"),
+		WithTotal: r.URL.Query().Get("total") == "true",
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (api *usersAPI) item(w http.ResponseWriter, r *http.Request) {
+	ctx := dbutils.WithOpName(r.Context(), "users."+strings.ToLower(r.Method))
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/users/"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var u user
+	switch r.Method {
+	case http.MethodGet:
+		err = dbutils.Get(ctx, api.db, &u, `SELECT * FROM test_users WHERE id = $1`, id)
+	case http.MethodPut:
+		if !readJSON(w, r, &u) {
+			return
+		}
+		u.ID = id
+		q := `UPDATE test_users SET login = :login, name = :name WHERE id = :id RETURNING *`
+		err = dbutils.NamedGet(ctx, api.db, &u, q, u)
+	case http.MethodDelete:
+		q := `DELETE FROM test_users WHERE id = $1 RETURNING *`
+		if err = dbutils.Get(ctx, api.db, &u, q, id); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+func (api *usersAPI) activity(w http.ResponseWriter, r *http.Request) {
+	app := r.URL.Query().Get("app")
+	if app == "" {
+		app = "db-example"
+	}
+
+	backends, err := dbutils.Activity(r.Context(), api.db, dbutils.ActivityFilter{
+		ApplicationName: app,
+		State:           r.URL.Query().Get("state"),
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, backends)
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("write response: %v", err)
+	}
+}
+
+var httpStatuses = map[dbutils.Code]int{
+	dbutils.NotFound:        http.StatusNotFound,
+	dbutils.Conflict:        http.StatusConflict,
+	dbutils.Timeout:         http.StatusGatewayTimeout,
+	dbutils.Canceled:        499, // client closed request
+	dbutils.Unavailable:     http.StatusServiceUnavailable,
+	dbutils.InvalidArgument: http.StatusBadRequest,
+}
+
+// writeError maps database errors to statuses. The body is
+// dbutils.ErrorJSON, the full error with the query and arguments is only
+// logged.
+func writeError(w http.ResponseWriter, err error) {
+	code := dbutils.CodeOf(err)
+	status, ok := httpStatuses[code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	if status >= 500 || errors.Is(err, context.Canceled) {
+		log.Printf("request failed: %v", err)
+	}
+
+	writeJSON(w, status, dbutils.ErrorJSON(err))
+}
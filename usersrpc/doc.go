@@ -0,0 +1,4 @@
+// Package usersrpc is the gRPC API of the users service example.
+package usersrpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative users.proto